@@ -0,0 +1,19 @@
+package cluster
+
+import (
+	erro "github.com/njones/socketio/internal/errors"
+)
+
+// All of the possible errors the cluster transport can return
+const (
+	ErrSocketIDTransportNotFound erro.StringF = "socket id %q not found on any node"
+	ErrSocketIDDetailsNotFound   erro.StringF = "socket id %q details not found on any node"
+	ErrListenFailed              erro.StringF = "failed to listen on %s:: %w"
+	ErrDialFailed                erro.StringF = "failed to dial the node at %s:: %w"
+	ErrHandshakeFailed           erro.StringF = "failed the handshake with the node at %s:: %w"
+	ErrUnexpectedMessage         erro.StringF = "unexpected message type %d"
+	ErrEncodeFailed              erro.StringF = "failed to encode the %s message:: %w"
+	ErrRequestTimeout            erro.StringF = "timed out waiting for %d of %d nodes"
+	ErrNilTransporter            erro.String  = "expected a type of Transporter, found <nil>"
+	ErrTransportClosed           erro.String  = "the cluster transport is closed"
+)
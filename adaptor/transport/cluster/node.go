@@ -0,0 +1,473 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	siop "github.com/njones/socketio/protocol"
+	"github.com/vmihailenco/msgpack"
+)
+
+// The types of the messages that are sent between the nodes
+const (
+	helloMessage          byte = iota // the id and the address of the node, sent first
+	peersMessage                      // the addresses of the other nodes in the cluster
+	broadcastMessage                  // a packet for the sockets that are in the rooms
+	joinMessage                       // a socket joins a room on the node that has it
+	leaveMessage                      // a socket leaves a room on the node that has it
+	socketsMessage                    // the sockets of a node, with their rooms and details
+	serverSideEmitMessage             // an event for the server callbacks of a node
+	responseMessage                   // the answer to a message that wants an answer
+	ownerMessage                      // asks for the node that has a socket
+	disconnectMessage                 // a socket is disconnected by the node that has it
+)
+
+// queueSize is the number of messages from a node that wait to be handled, before the
+// messages from the node stop being read
+const queueSize = 256
+
+// message is sent as a msgpack map, one after the other on the connection. A message with
+// a request id wants a response, which is sent back with the same request id.
+type message struct {
+	Type      byte   `msgpack:"t"`
+	RequestID uint64 `msgpack:"r,omitempty"`
+
+	Node  string   `msgpack:"node,omitempty"`
+	Addr  string   `msgpack:"addr,omitempty"`
+	Peers []string `msgpack:"peers,omitempty"`
+
+	Namespace string   `msgpack:"nsp,omitempty"`
+	Rooms     []Room   `msgpack:"rooms,omitempty"`
+	Except    []Room   `msgpack:"except,omitempty"`
+	SocketID  SocketID `msgpack:"sid,omitempty"`
+	Room      Room     `msgpack:"room,omitempty"`
+
+	Packet   *packet      `msgpack:"packet,omitempty"`
+	Volatile bool         `msgpack:"volatile,omitempty"`
+	Data     interface{}  `msgpack:"data,omitempty"`
+	Sockets  []socketInfo `msgpack:"sockets,omitempty"`
+	Found    bool         `msgpack:"found,omitempty"` // the node has the socket of a join or leave
+	Close    bool         `msgpack:"close,omitempty"` // the connection of a disconnected socket is closed
+}
+
+// packet is the socket.io packet of a broadcast, the binary data is sent in place
+type packet struct {
+	Type  byte        `msgpack:"type"`
+	Data  interface{} `msgpack:"data,omitempty"`
+	AckID uint64      `msgpack:"id,omitempty"`
+}
+
+// socketInfo is what a node knows about one of its sockets
+type socketInfo struct {
+	ID    SocketID               `msgpack:"id"`
+	Rooms []Room                 `msgpack:"rooms"`
+	Auth  map[string]interface{} `msgpack:"auth,omitempty"`
+	Data  interface{}            `msgpack:"data,omitempty"`
+}
+
+// peer is the connection to another node
+type peer struct {
+	id     string
+	addr   string
+	dialed bool // this node opened the connection
+
+	conn  net.Conn
+	dec   *msgpack.Decoder
+	queue chan message // the messages that are handled in order, off of the read loop
+
+	ẇ   sync.Mutex
+	w   *bufio.Writer
+	enc *msgpack.Encoder
+}
+
+func newPeer(conn net.Conn, dialed bool) *peer {
+	p := &peer{conn: conn, dialed: dialed, w: bufio.NewWriter(conn), queue: make(chan message, queueSize)}
+	p.dec = msgpack.NewDecoder(bufio.NewReader(conn)).UseDecodeInterfaceLoose(true)
+	p.enc = msgpack.NewEncoder(p.w).UseCompactEncoding(true)
+	return p
+}
+
+// send writes the message, a node that does not read it within the timeout is dropped
+func (p *peer) send(msg message, timeout time.Duration) error {
+	p.ẇ.Lock()
+	defer p.ẇ.Unlock()
+
+	p.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := p.enc.Encode(msg); err != nil {
+		p.conn.Close()
+		return ErrEncodeFailed.F("node", err)
+	}
+	if err := p.w.Flush(); err != nil {
+		p.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (p *peer) receive() (msg message, err error) {
+	err = p.dec.Decode(&msg)
+	return msg, err
+}
+
+// accept adds the nodes that connect to this node, until the listener is closed
+func (tr *clusterTransport) accept() {
+	defer tr.wg.Done()
+
+	for {
+		conn, err := tr.ln.Accept()
+		if err != nil {
+			return
+		}
+		go tr.handshake(newPeer(conn, false))
+	}
+}
+
+// connect dials the node at the address, unless it's this node or it's already known
+func (tr *clusterTransport) connect(addr string) {
+	tr.ṗ.Lock()
+	_, known := tr.known[addr]
+	if known || addr == tr.addr || tr.isClosed() {
+		tr.ṗ.Unlock()
+		return
+	}
+	tr.known[addr] = struct{}{}
+	tr.ṗ.Unlock()
+
+	conn, err := net.DialTimeout("tcp", addr, tr.timeout)
+	if err != nil {
+		tr.forget(addr)
+		tr.redial(addr)
+		return
+	}
+
+	p := newPeer(conn, true)
+	p.addr = addr
+	tr.handshake(p)
+}
+
+// redial connects to one of the seed nodes again after a short wait
+func (tr *clusterTransport) redial(addr string) {
+	for _, seed := range tr.seeds {
+		if seed == addr {
+			select {
+			case <-tr.done:
+			case <-time.After(reconnectDelay):
+				go tr.connect(addr)
+			}
+			return
+		}
+	}
+}
+
+func (tr *clusterTransport) forget(addr string) {
+	tr.ṗ.Lock()
+	delete(tr.known, addr)
+	tr.ṗ.Unlock()
+}
+
+// handshake swaps the hello messages, and then reads the messages from the node
+func (tr *clusterTransport) handshake(p *peer) {
+	if err := p.send(message{Type: helloMessage, Node: tr.id, Addr: tr.addr}, tr.timeout); err != nil {
+		p.conn.Close()
+		tr.lost(p)
+		return
+	}
+
+	p.conn.SetReadDeadline(time.Now().Add(tr.timeout))
+	hello, err := p.receive()
+	p.conn.SetReadDeadline(time.Time{})
+	if err != nil || hello.Type != helloMessage || hello.Node == tr.id {
+		p.conn.Close()
+		tr.lost(p)
+		return
+	}
+	p.id = hello.Node
+	if !p.dialed {
+		p.addr = hello.Addr // the dialed address is kept, so that a seed can be dialed again
+	}
+
+	peers, ok := tr.register(p)
+	if !ok {
+		p.conn.Close()
+		return
+	}
+	if len(peers) > 0 {
+		p.send(message{Type: peersMessage, Peers: peers}, tr.timeout)
+	}
+
+	go tr.work(p)
+	defer close(p.queue)
+
+	for {
+		msg, err := p.receive()
+		if err != nil {
+			p.conn.Close()
+			tr.unregister(p)
+			tr.lost(p)
+			return
+		}
+		if msg.Type == responseMessage {
+			tr.answer(p, msg) // a response never waits, so the requests of the handled messages are answered
+			continue
+		}
+		select {
+		case p.queue <- msg:
+		case <-tr.done:
+			p.conn.Close()
+			return
+		}
+	}
+}
+
+// work handles the messages of the node in the order that they were received, until the
+// connection to the node is closed.
+func (tr *clusterTransport) work(p *peer) {
+	for msg := range p.queue {
+		tr.handle(p, msg)
+	}
+}
+
+// register adds the node, and returns the addresses of the other nodes. When two nodes
+// dial each other at the same time, they both keep the connection that was dialed by
+// the node with the lower id.
+func (tr *clusterTransport) register(p *peer) ([]string, bool) {
+	tr.ṗ.Lock()
+	defer tr.ṗ.Unlock()
+
+	if tr.isClosed() {
+		return nil, false
+	}
+
+	if old, ok := tr.peers[p.id]; ok {
+		if old.dialed != p.dialed {
+			if keep := (p.dialed && tr.id < p.id) || (!p.dialed && p.id < tr.id); !keep {
+				return nil, false
+			}
+		}
+		old.conn.Close()
+	}
+	tr.peers[p.id] = p
+	tr.known[p.addr] = struct{}{}
+
+	var addrs []string
+	for id, other := range tr.peers {
+		if id != p.id {
+			addrs = append(addrs, other.addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, true
+}
+
+func (tr *clusterTransport) unregister(p *peer) {
+	tr.ṗ.Lock()
+	defer tr.ṗ.Unlock()
+
+	if tr.peers[p.id] == p {
+		delete(tr.peers, p.id)
+		delete(tr.known, p.addr)
+	}
+}
+
+// lost dials a seed node again when the connection to it was lost
+func (tr *clusterTransport) lost(p *peer) {
+	if !p.dialed {
+		return
+	}
+
+	tr.ṗ.Lock()
+	_, replaced := tr.peers[p.id]
+	tr.ṗ.Unlock()
+
+	if !replaced {
+		tr.forget(p.addr)
+		tr.redial(p.addr)
+	}
+}
+
+// peer returns the connection to the node with the id
+func (tr *clusterTransport) peer(id string) (*peer, bool) {
+	tr.ṗ.Lock()
+	defer tr.ṗ.Unlock()
+	p, ok := tr.peers[id]
+	return p, ok
+}
+
+func (tr *clusterTransport) peerList() []*peer {
+	tr.ṗ.Lock()
+	defer tr.ṗ.Unlock()
+
+	rtn := make([]*peer, 0, len(tr.peers))
+	for _, p := range tr.peers {
+		rtn = append(rtn, p)
+	}
+	return rtn
+}
+
+// broadcast sends the message to every node, and returns the number of nodes it was sent to
+func (tr *clusterTransport) broadcast(msg message) int {
+	var n int
+	for _, p := range tr.peerList() {
+		if p.send(msg, tr.timeout) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// request sends the message to every node, and waits for each of them to answer or for the
+// ctx to be done. The responses that were received are returned with the timeout error.
+func (tr *clusterTransport) request(ctx context.Context, msg message) ([]message, error) {
+	responses, sent, done := tr.ask(msg)
+	defer done()
+
+	rtn := make([]message, 0, sent)
+	for len(rtn) < sent {
+		select {
+		case response := <-responses:
+			rtn = append(rtn, response)
+		case <-ctx.Done():
+			return rtn, ErrRequestTimeout.F(sent-len(rtn), sent)
+		case <-tr.done:
+			return rtn, ErrTransportClosed
+		}
+	}
+	return rtn, nil
+}
+
+// requestOwner sends the message for a socket to every node, and returns the id of the
+// node with the socket once it has answered. The other nodes aren't waited for.
+func (tr *clusterTransport) requestOwner(ctx context.Context, msg message) (string, error) {
+	responses, sent, done := tr.ask(msg)
+	defer done()
+
+	for n := 0; n < sent; n++ {
+		select {
+		case response := <-responses:
+			if response.Found {
+				return response.Node, nil
+			}
+		case <-ctx.Done():
+			return "", ErrRequestTimeout.F(sent-n, sent)
+		case <-tr.done:
+			return "", ErrTransportClosed
+		}
+	}
+	return "", ErrSocketIDTransportNotFound.F(msg.SocketID.String())
+}
+
+// ask sends the message with a new request id to every node. It returns the channel for the
+// responses with the number of nodes that it was sent to, and the function that stops
+// waiting for the responses.
+func (tr *clusterTransport) ask(msg message) (<-chan message, int, func()) {
+	msg.RequestID = atomic.AddUint64(&tr.requestCount, 1)
+
+	peers := tr.peerList()
+	responses := make(chan message, len(peers))
+
+	tr.ẇ.Lock()
+	tr.pending[msg.RequestID] = responses
+	tr.ẇ.Unlock()
+
+	var sent int
+	for _, p := range peers {
+		if p.send(msg, tr.timeout) == nil {
+			sent++
+		}
+	}
+
+	return responses, sent, func() {
+		tr.ẇ.Lock()
+		delete(tr.pending, msg.RequestID)
+		tr.ẇ.Unlock()
+	}
+}
+
+// requestWithTimeout is a request that waits for the request timeout of the transport
+func (tr *clusterTransport) requestWithTimeout(msg message) ([]message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+	defer cancel()
+	return tr.request(ctx, msg)
+}
+
+func (tr *clusterTransport) respond(p *peer, msg message, response message) {
+	if msg.RequestID == 0 {
+		return
+	}
+	response.Type, response.RequestID = responseMessage, msg.RequestID
+	p.send(response, tr.timeout)
+}
+
+// answer passes the response from the node on to the request that is waiting for it
+func (tr *clusterTransport) answer(p *peer, msg message) {
+	msg.Node = p.id // the node that answered
+
+	tr.ẇ.Lock()
+	responses, ok := tr.pending[msg.RequestID]
+	tr.ẇ.Unlock()
+	if ok {
+		select {
+		case responses <- msg:
+		default:
+		}
+	}
+}
+
+// handle does what the message from the node asks for, it's called by the worker of the
+// node. The server callbacks can make requests of their own, so they are called on their
+// own goroutine.
+func (tr *clusterTransport) handle(p *peer, msg message) {
+	switch msg.Type {
+	case peersMessage:
+		for _, addr := range msg.Peers {
+			go tr.connect(addr)
+		}
+	case broadcastMessage:
+		tr.deliver(msg)
+	case joinMessage:
+		found := tr.IsLocal(msg.SocketID)
+		if found {
+			tr.join(msg.Namespace, msg.SocketID, msg.Room)
+		}
+		tr.respond(p, msg, message{Found: found})
+	case leaveMessage:
+		found := tr.IsLocal(msg.SocketID)
+		if found {
+			tr.leave(msg.Namespace, msg.SocketID, msg.Room)
+		}
+		tr.respond(p, msg, message{Found: found})
+	case ownerMessage:
+		tr.respond(p, msg, message{Found: tr.IsLocal(msg.SocketID)})
+	case disconnectMessage:
+		if !tr.IsLocal(msg.SocketID) {
+			tr.respond(p, msg, message{})
+			return
+		}
+		go func() {
+			if disconnect := tr.disconnecter(); disconnect != nil {
+				disconnect(msg.Namespace, msg.SocketID, msg.Close)
+			}
+			tr.respond(p, msg, message{Found: true})
+		}()
+	case socketsMessage:
+		tr.respond(p, msg, message{Sockets: tr.localSockets(msg.Namespace, msg.SocketID)})
+	case serverSideEmitMessage:
+		go func() {
+			var ack []interface{}
+			if receive := tr.receiver(); receive != nil {
+				data, _ := siop.FromMsgpack(msg.Data).([]interface{})
+				ack = receive(msg.Namespace, data)
+			}
+			data, err := siop.ToMsgpack(ack)
+			if err != nil {
+				data = nil
+			}
+			tr.respond(p, msg, message{Data: data})
+		}()
+	}
+}
@@ -0,0 +1,34 @@
+package cluster
+
+import "time"
+
+// WithPeers sets the addresses of the nodes to join. The nodes share the addresses of their
+// peers with each other, so a single seed node is enough to join the whole cluster. The
+// nodes in this list are dialed again when the connection to them is lost.
+func WithPeers(addrs ...string) TransportOption {
+	return func(o TransportOptionWith) {
+		if v, ok := o.(*clusterTransport); ok {
+			v.seeds = append(v.seeds, addrs...)
+		}
+	}
+}
+
+// WithAdvertiseAddr sets the address that the other nodes use to reach this node, the
+// default is the address of the listener, which is not reachable when it's unspecified.
+func WithAdvertiseAddr(addr string) TransportOption {
+	return func(o TransportOptionWith) {
+		if v, ok := o.(*clusterTransport); ok {
+			v.addr = addr
+		}
+	}
+}
+
+// WithRequestTimeout sets how long a node waits for the other nodes to answer a request,
+// like fetching the sockets or joining a socket to a room. The default is five seconds.
+func WithRequestTimeout(timeout time.Duration) TransportOption {
+	return func(o TransportOptionWith) {
+		if v, ok := o.(*clusterTransport); ok {
+			v.timeout = timeout
+		}
+	}
+}
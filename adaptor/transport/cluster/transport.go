@@ -0,0 +1,514 @@
+// Package cluster provides a transport that connects the SocketIO servers to each other over
+// TCP, so that a socket that is connected to one server can be reached from all of them
+// without an external broker.
+//
+// The connections between the nodes are neither authenticated nor encrypted, any process
+// that can reach the listen address can join the cluster and send packets to the sockets.
+// The nodes must only listen on a trusted network.
+
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/njones/socketio/adaptor/transport/internal/local"
+	eiot "github.com/njones/socketio/engineio/transport"
+	with "github.com/njones/socketio/internal/option"
+	siop "github.com/njones/socketio/protocol"
+	siot "github.com/njones/socketio/transport"
+)
+
+type (
+	SessionID = eiot.SessionID
+	SocketID  = siot.SocketID
+
+	Option = siop.Option
+	Socket = siot.Socket
+	Data   = siot.Data
+
+	Namespace = string
+	Room      = string
+
+	TransportOption     = with.Option
+	TransportOptionWith = with.OptionWith
+)
+
+// reconnectDelay is the wait before a seed node is dialed again
+const reconnectDelay = 500 * time.Millisecond
+
+// clusterTransport keeps the sockets that are connected to this node in the local registry.
+// The packets for a socket on another node are sent to the node with the socket, which is
+// asked for from every node. A broadcast is sent to every node once, with
+// the rooms that each node sends it on to. The rooms and details of the sockets are asked
+// for from every node, so each node only knows about its own sockets.
+type clusterTransport struct {
+	*local.Registry
+
+	// The last id of a request to the other nodes
+	requestCount uint64
+
+	id      string        // the id of this node
+	addr    string        // the address that the other nodes use to reach this node
+	seeds   []string      // the nodes that are dialed again when the connection is lost
+	timeout time.Duration // how long to wait for the other nodes
+
+	ln net.Listener
+	wg sync.WaitGroup
+
+	// hold the node id to connection relationship, and the addresses that are connected
+	ṗ     *sync.Mutex
+	peers map[string]*peer
+	known map[string]struct{}
+
+	// hold the request id to response relationship
+	ẇ       *sync.Mutex
+	pending map[uint64]chan message
+
+	// hold the namespace/socketID to details relationship of the sockets on this node
+	ḋ *sync.Mutex
+	d map[Namespace]map[SocketID]siot.SocketDetails
+
+	// The function that receives the server side events from the other nodes
+	receive atomic.Value
+
+	// The function that disconnects the sockets of this node for the other nodes
+	disconnect atomic.Value
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewClusterTransport returns a transport that listens for the other nodes on the address,
+// and joins the nodes that are set with the WithPeers option. Pass in the version that must
+// be used for creating new packets based on the codec that is being used, the same as the
+// in-memory transport.
+func NewClusterTransport(addr string, fn siop.NewPacket, opts ...TransportOption) (*clusterTransport, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, ErrListenFailed.F(addr, err)
+	}
+
+	tr := &clusterTransport{
+		Registry: local.NewRegistry(fn),
+		id:       generateID(),
+		addr:     ln.Addr().String(),
+		timeout:  5 * time.Second,
+		ln:       ln,
+		ṗ:        new(sync.Mutex),
+		peers:    make(map[string]*peer),
+		known:    make(map[string]struct{}),
+		ẇ:        new(sync.Mutex),
+		pending:  make(map[uint64]chan message),
+		ḋ:        new(sync.Mutex),
+		d:        make(map[Namespace]map[SocketID]siot.SocketDetails),
+		done:     make(chan struct{}),
+	}
+	tr.With(opts...)
+
+	tr.wg.Add(1)
+	go tr.accept()
+
+	for _, seed := range tr.seeds {
+		go tr.connect(seed)
+	}
+	return tr, nil
+}
+
+func (tr *clusterTransport) With(opts ...TransportOption) {
+	for _, opt := range opts {
+		opt(tr)
+	}
+}
+
+// Addr returns the address that the other nodes use to reach this node
+func (tr *clusterTransport) Addr() string { return tr.addr }
+
+// Peers returns the sorted addresses of the nodes that this node is connected to
+func (tr *clusterTransport) Peers() []string {
+	var rtn []string
+	for _, p := range tr.peerList() {
+		rtn = append(rtn, p.addr)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+// Close stops listening, and closes the connections to the other nodes
+func (tr *clusterTransport) Close() error {
+	tr.once.Do(func() {
+		close(tr.done)
+		tr.ln.Close()
+
+		for _, p := range tr.peerList() {
+			p.conn.Close()
+		}
+		tr.wg.Wait()
+	})
+	return nil
+}
+
+func (tr *clusterTransport) isClosed() bool {
+	select {
+	case <-tr.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Send sends the data to the socket when it's on this node, otherwise the packet is sent to
+// the node that has the socket, once that node has answered that it does.
+func (tr *clusterTransport) Send(socketID SocketID, data Data, opts ...Option) error {
+	switch {
+	case tr.SendLocal(socketID, data, opts...):
+		return nil
+	case tr.IsLocal(socketID):
+		return ErrSocketIDTransportNotFound.F(socketID.String())
+	}
+	return tr.relay(socketID, data, false, opts)
+}
+
+// SendVolatile is the same as Send, except the data is dropped when the EngineIO
+// transport is not writable. Dropped data is counted, and is not an error.
+func (tr *clusterTransport) SendVolatile(socketID SocketID, data Data, opts ...Option) error {
+	switch {
+	case tr.SendVolatileLocal(socketID, data, opts...):
+		return nil
+	case tr.IsLocal(socketID):
+		return ErrSocketIDTransportNotFound.F(socketID.String())
+	}
+	return tr.relay(socketID, data, true, opts)
+}
+
+// Join adds the socket to the room. The room of a socket on another node is changed by that
+// node, so this waits for that node to answer, for up to the request timeout.
+func (tr *clusterTransport) Join(ns Namespace, socketID SocketID, room Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+	defer cancel()
+	return tr.JoinContext(ctx, ns, socketID, room)
+}
+
+// JoinContext is the same as Join, except a socket on another node is waited for until the
+// ctx is done.
+func (tr *clusterTransport) JoinContext(ctx context.Context, ns Namespace, socketID SocketID, room Room) error {
+	if !tr.IsLocal(socketID) {
+		_, err := tr.requestOwner(ctx, message{Type: joinMessage, Namespace: ns, SocketID: socketID, Room: room})
+		return err
+	}
+	return tr.join(ns, socketID, room)
+}
+
+// Leave removes the socket from the room. The room of a socket on another node is changed
+// by that node, so this waits for that node to answer, for up to the request timeout.
+func (tr *clusterTransport) Leave(ns Namespace, socketID SocketID, room Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+	defer cancel()
+	return tr.LeaveContext(ctx, ns, socketID, room)
+}
+
+// LeaveContext is the same as Leave, except a socket on another node is waited for until
+// the ctx is done.
+func (tr *clusterTransport) LeaveContext(ctx context.Context, ns Namespace, socketID SocketID, room Room) error {
+	if !tr.IsLocal(socketID) {
+		_, err := tr.requestOwner(ctx, message{Type: leaveMessage, Namespace: ns, SocketID: socketID, Room: room})
+		return err
+	}
+	return tr.leave(ns, socketID, room)
+}
+
+func (tr *clusterTransport) join(ns Namespace, socketID SocketID, room Room) error {
+	tr.JoinLocal(ns, socketID, room)
+	return nil
+}
+
+func (tr *clusterTransport) leave(ns Namespace, socketID SocketID, room Room) error {
+	if _, empty := tr.LeaveLocal(ns, socketID, room); empty {
+		tr.ḋ.Lock()
+		delete(tr.d[ns], socketID) // the socket is no longer in the namespace
+		tr.ḋ.Unlock()
+	}
+	return nil
+}
+
+// SetDetails keeps the details of the socket in the namespace, on the node with the socket
+func (tr *clusterTransport) SetDetails(ns Namespace, socketID SocketID, details siot.SocketDetails) error {
+	tr.ḋ.Lock()
+	defer tr.ḋ.Unlock()
+
+	if _, ok := tr.d[ns]; !ok {
+		tr.d[ns] = make(map[SocketID]siot.SocketDetails)
+	}
+	tr.d[ns][socketID] = details
+	return nil
+}
+
+// Details returns the details of the socket in the namespace, from the node with the socket
+func (tr *clusterTransport) Details(ns Namespace, socketID SocketID) (siot.SocketDetails, error) {
+	tr.ḋ.Lock()
+	details, ok := tr.d[ns][socketID]
+	tr.ḋ.Unlock()
+
+	if ok {
+		return details, nil
+	}
+	if info, ok := tr.remoteSocket(ns, socketID); ok {
+		return siot.SocketDetails{Auth: info.Auth, Data: info.Data}, nil
+	}
+	return siot.SocketDetails{}, ErrSocketIDDetailsNotFound.F(socketID.String())
+}
+
+// Sockets returns the sockets in the namespace from every node, the rooms of the sockets
+// are asked for once for each returned array. The nodes that don't answer in time are left
+// out.
+func (tr *clusterTransport) Sockets(namespace Namespace) siot.SocketArray {
+	sockets := tr.localSockets(namespace, "")
+	responses, _ := tr.requestWithTimeout(message{Type: socketsMessage, Namespace: namespace})
+	for _, response := range responses {
+		sockets = append(sockets, response.Sockets...)
+	}
+	sort.Slice(sockets, func(i, j int) bool { return sockets[i].ID < sockets[j].ID })
+
+	ids := make([]SocketID, len(sockets))
+	rooms := make(map[SocketID]map[Room]struct{}, len(sockets))
+	for i, info := range sockets {
+		ids[i] = info.ID
+		rooms[info.ID] = make(map[Room]struct{}, len(info.Rooms))
+		for _, room := range info.Rooms {
+			rooms[info.ID][room] = struct{}{}
+		}
+	}
+
+	return siot.InitSocketArray(namespace, ids, siot.WithSocketRoomFilter(
+		func(ns Namespace, rm Room, id SocketID) (bool, error) {
+			_, ok := rooms[id][rm]
+			return ok, nil
+		},
+	))
+}
+
+// Rooms returns the rooms of the socket in the namespace, from the node with the socket
+func (tr *clusterTransport) Rooms(namespace Namespace, socketID SocketID) siot.RoomArray {
+	if sockets := tr.localSockets(namespace, socketID); len(sockets) > 0 {
+		return siot.RoomArray{Rooms: sockets[0].Rooms}
+	}
+	if info, ok := tr.remoteSocket(namespace, socketID); ok {
+		return siot.RoomArray{Rooms: info.Rooms}
+	}
+	return siot.RoomArray{}
+}
+
+// ServerSideEmit sends the data to the receive function of the other nodes
+func (tr *clusterTransport) ServerSideEmit(ns Namespace, data []interface{}) error {
+	d, err := siop.ToMsgpack(data)
+	if err != nil {
+		return ErrEncodeFailed.F("server side emit", err)
+	}
+	tr.broadcast(message{Type: serverSideEmitMessage, Namespace: ns, Data: d})
+	return nil
+}
+
+// ServerSideEmitWithAck sends the data to the receive function of the other nodes, and
+// returns what each of them returned. The acknowledgements that were received are returned
+// with an error when a node has not answered before the ctx is done.
+func (tr *clusterTransport) ServerSideEmitWithAck(ctx context.Context, ns Namespace, data []interface{}) ([][]interface{}, error) {
+	d, err := siop.ToMsgpack(data)
+	if err != nil {
+		return nil, ErrEncodeFailed.F("server side emit", err)
+	}
+
+	responses, err := tr.request(ctx, message{Type: serverSideEmitMessage, Namespace: ns, Data: d})
+
+	rtn := make([][]interface{}, len(responses))
+	for i, response := range responses {
+		rtn[i], _ = siop.FromMsgpack(response.Data).([]interface{})
+	}
+	return rtn, err
+}
+
+// OnServerSideEmit sets the function that receives the data from the other nodes
+func (tr *clusterTransport) OnServerSideEmit(receive func(Namespace, []interface{}) []interface{}) {
+	tr.receive.Store(receive)
+}
+
+func (tr *clusterTransport) receiver() func(Namespace, []interface{}) []interface{} {
+	receive, _ := tr.receive.Load().(func(Namespace, []interface{}) []interface{})
+	return receive
+}
+
+// DisconnectRemote asks the node with the socket to disconnect it from the namespace, and
+// waits for that node to answer. It returns false when the socket is on this node.
+func (tr *clusterTransport) DisconnectRemote(ns Namespace, socketID SocketID, close bool) (bool, error) {
+	if tr.IsLocal(socketID) {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+	defer cancel()
+
+	_, err := tr.requestOwner(ctx, message{Type: disconnectMessage, Namespace: ns, SocketID: socketID, Close: close})
+	return true, err
+}
+
+// OnRemoteDisconnect sets the function that disconnects the sockets of this node, when the
+// other nodes ask for it
+func (tr *clusterTransport) OnRemoteDisconnect(disconnect func(Namespace, SocketID, bool) error) {
+	tr.disconnect.Store(disconnect)
+}
+
+func (tr *clusterTransport) disconnecter() func(Namespace, SocketID, bool) error {
+	disconnect, _ := tr.disconnect.Load().(func(Namespace, SocketID, bool) error)
+	return disconnect
+}
+
+// localSockets returns the sockets of this node in the namespace, or only the socket when
+// the socket id is not empty.
+func (tr *clusterTransport) localSockets(ns Namespace, socketID SocketID) []socketInfo {
+	sockets := tr.LocalRooms(ns, socketID)[ns]
+
+	tr.ḋ.Lock()
+	defer tr.ḋ.Unlock()
+
+	var rtn []socketInfo
+	for id, rooms := range sockets {
+		info := socketInfo{ID: id, Rooms: rooms}
+		if details, ok := tr.d[ns][id]; ok {
+			info.Auth = details.Auth
+			info.Data, _ = siop.ToMsgpack(details.Data)
+		}
+		rtn = append(rtn, info)
+	}
+	return rtn
+}
+
+// remoteSocket asks the other nodes for the socket, and returns the answer of the node with it
+func (tr *clusterTransport) remoteSocket(ns Namespace, socketID SocketID) (socketInfo, bool) {
+	responses, _ := tr.requestWithTimeout(message{Type: socketsMessage, Namespace: ns, SocketID: socketID})
+	for _, response := range responses {
+		for _, info := range response.Sockets {
+			if info.ID == socketID {
+				info.Auth, _ = siop.FromMsgpack(info.Auth).(map[string]interface{})
+				info.Data = siop.FromMsgpack(info.Data)
+				return info, true
+			}
+		}
+	}
+	return socketInfo{}, false
+}
+
+// Broadcast sends the data to the sockets of this node that the options are for, and sends
+// it once to each of the other nodes, which send it on to their own sockets.
+func (tr *clusterTransport) Broadcast(bopts siot.BroadcastOptions, data Data, opts ...Option) error {
+	msg, err := tr.encode(data, opts)
+	if err != nil {
+		return err
+	}
+	msg.Rooms, msg.Except, msg.Volatile = bopts.Rooms, bopts.Except, bopts.Volatile
+
+	tr.deliver(msg)
+	tr.broadcast(msg)
+	return nil
+}
+
+// relay sends the packet to the node with the socket, for the room of the socket id
+func (tr *clusterTransport) relay(socketID SocketID, data Data, volatile bool, opts []Option) error {
+	msg, err := tr.encode(data, opts)
+	if err != nil {
+		return err
+	}
+	msg.Rooms, msg.Volatile = []Room{socketID.String()}, volatile
+
+	ctx, cancel := context.WithTimeout(context.Background(), tr.timeout)
+	defer cancel()
+
+	node, err := tr.requestOwner(ctx, message{Type: ownerMessage, SocketID: socketID})
+	if err != nil {
+		return err
+	}
+	p, ok := tr.peer(node)
+	if !ok {
+		return ErrSocketIDTransportNotFound.F(socketID.String())
+	}
+	return p.send(msg, tr.timeout)
+}
+
+// encode returns the broadcast message of the packet, without the rooms
+func (tr *clusterTransport) encode(data Data, opts []Option) (message, error) {
+	pac := tr.NewPacket().WithOption(opts...).(interface {
+		GetType() byte
+		GetNamespace() string
+		GetAckID() uint64
+	})
+
+	ns := pac.GetNamespace()
+	if ns == "" {
+		ns = "/"
+	}
+
+	d, err := siop.ToMsgpack(data)
+	if err != nil {
+		return message{}, ErrEncodeFailed.F("broadcast", err)
+	}
+
+	return message{
+		Type:      broadcastMessage,
+		Namespace: ns,
+		Packet:    &packet{Type: pac.GetType(), Data: d, AckID: pac.GetAckID()},
+	}, nil
+}
+
+// deliver sends the packet from another node to the sockets of this node that it's for
+func (tr *clusterTransport) deliver(msg message) {
+	if msg.Packet == nil {
+		return
+	}
+
+	opts := []Option{siop.WithType(msg.Packet.Type), siop.WithNamespace(msg.Namespace)}
+	if msg.Packet.AckID > 0 {
+		opts = append(opts, siop.WithAckID(msg.Packet.AckID))
+	}
+
+	tr.Deliver(msg.Namespace, msg.Rooms, msg.Except, msg.Volatile, func() (Data, []Option, error) {
+		// each socket is sent its own copy of the data, binary data can only be read once
+		return siop.FromMsgpack(clone(msg.Packet.Data)), opts, nil
+	})
+}
+
+// clone copies the arrays and maps of the decoded data, which are changed in place when
+// the data is converted back from msgpack.
+func clone(data interface{}) interface{} {
+	switch val := data.(type) {
+	case []interface{}:
+		rtn := make([]interface{}, len(val))
+		for i, v := range val {
+			rtn[i] = clone(v)
+		}
+		return rtn
+	case map[string]interface{}:
+		rtn := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			rtn[k] = clone(v)
+		}
+		return rtn
+	case map[interface{}]interface{}:
+		rtn := make(map[interface{}]interface{}, len(val))
+		for k, v := range val {
+			rtn[k] = clone(v)
+		}
+		return rtn
+	}
+	return data
+}
+
+// generateID returns a random id for the node
+func generateID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
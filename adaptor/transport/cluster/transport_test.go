@@ -0,0 +1,372 @@
+package cluster_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	sio "github.com/njones/socketio"
+	tclu "github.com/njones/socketio/adaptor/transport/cluster"
+	"github.com/njones/socketio/callback"
+	"github.com/njones/socketio/client"
+	"github.com/njones/socketio/engineio"
+	eiop "github.com/njones/socketio/engineio/protocol"
+	eiot "github.com/njones/socketio/engineio/transport"
+	siop "github.com/njones/socketio/protocol"
+	ser "github.com/njones/socketio/serialize"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack"
+)
+
+var testingOptions = []sio.Option{
+	engineio.WithPingTimeout(1 * time.Second),
+	engineio.WithPingInterval(500 * time.Millisecond),
+}
+
+// receive returns the value from the channel, or fails the test after a few seconds
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	return ""
+}
+
+func TestClusterTransportMesh(t *testing.T) {
+	seed, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer seed.Close()
+
+	nodes := []interface {
+		Addr() string
+		Peers() []string
+		Close() error
+	}{seed}
+	for i := 0; i < 2; i++ {
+		node, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5, tclu.WithPeers(seed.Addr()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer node.Close()
+		nodes = append(nodes, node)
+	}
+
+	// every node is connected to the others, the last node only knew about the seed
+	assert.Eventually(t, func() bool {
+		for _, node := range nodes {
+			if len(node.Peers()) != len(nodes)-1 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a node that leaves is dropped by the others
+	nodes[2].Close()
+	assert.Eventually(t, func() bool {
+		return len(nodes[0].Peers()) == 1 && len(nodes[1].Peers()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestClusterTransportServers(t *testing.T) {
+	type node struct {
+		server *sio.ServerV4
+		events chan string
+		ids    chan sio.SocketID
+	}
+
+	var seed string
+	nodes := make([]node, 3)
+	for i := range nodes {
+		i := i
+		opts := []tclu.TransportOption{tclu.WithRequestTimeout(500 * time.Millisecond)}
+		if seed != "" {
+			opts = append(opts, tclu.WithPeers(seed))
+		}
+		tr, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5, opts...)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer tr.Close()
+		if seed == "" {
+			seed = tr.Addr()
+		}
+
+		n := node{
+			server: sio.NewServerV4(append(testingOptions, sio.WithAdaptor(tr))...),
+			events: make(chan string, 10),
+			ids:    make(chan sio.SocketID, 1),
+		}
+		n.server.OnConnect(func(socket *sio.SocketV4) error {
+			socket.Data().Set("node", float64(i))
+			socket.OnDisconnectReason(func(reason sio.DisconnectReason) {
+				select {
+				case n.events <- "disconnect: " + reason.String():
+				default:
+				}
+			})
+			n.ids <- socket.ID()
+			return nil
+		})
+		n.server.On("count", callback.Func(func(from string) (float64, error) {
+			n.events <- "count from " + from
+			return float64(i), nil
+		}))
+		nodes[i] = n
+
+		assert.Eventually(t, func() bool { return len(tr.Peers()) == i }, 5*time.Second, 10*time.Millisecond)
+
+		server := httptest.NewServer(n.server)
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		c, err := client.Dial(ctx, server.URL, client.WithUpgrade(false))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer c.Close()
+
+		socket := c.Socket("/")
+		socket.On("news", callback.FuncString(func(msg string) { n.events <- msg }))
+		if !assert.NoError(t, socket.Connect(ctx)) {
+			return
+		}
+	}
+
+	var ids = []sio.SocketID{<-nodes[0].ids, <-nodes[1].ids, <-nodes[2].ids}
+
+	// a broadcast from one node reaches the clients of every node
+	assert.NoError(t, nodes[0].server.Emit("news", ser.String("everyone")))
+	for _, n := range nodes {
+		assert.Equal(t, "everyone", receive(t, n.events))
+	}
+
+	// the sockets of every node are fetched, with their details
+	sockets, err := nodes[1].server.FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 3) {
+		var got = map[sio.SocketID]interface{}{}
+		for _, socket := range sockets {
+			got[socket.ID()], _ = socket.Data().Get("node")
+		}
+		assert.Equal(t, map[sio.SocketID]interface{}{ids[0]: float64(0), ids[1]: float64(1), ids[2]: float64(2)}, got)
+	}
+
+	// the sockets on other nodes join a room, and leave it again
+	assert.NoError(t, nodes[0].server.In(ids[1].String(), ids[2].String()).SocketsJoin("game"))
+
+	sockets, err = nodes[0].server.In("game").FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 2) {
+		assert.ElementsMatch(t, []sio.SocketID{ids[1], ids[2]}, []sio.SocketID{sockets[0].ID(), sockets[1].ID()})
+	}
+	sockets, err = nodes[2].server.In(ids[1].String()).FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 1) {
+		assert.ElementsMatch(t, []string{"game", ids[1].String()}, sockets[0].Rooms())
+	}
+
+	assert.NoError(t, nodes[1].server.In(ids[2].String()).SocketsLeave("game"))
+
+	// a room broadcast only reaches the sockets in the room
+	assert.NoError(t, nodes[2].server.To("game").Emit("news", ser.String("players")))
+	assert.Equal(t, "players", receive(t, nodes[1].events))
+	select {
+	case msg := <-nodes[0].events:
+		t.Errorf("unexpected broadcast %q", msg)
+	case msg := <-nodes[2].events:
+		t.Errorf("unexpected broadcast %q", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// a server side emit reaches the callbacks of the other nodes, and each node answers
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	acks, err := nodes[0].server.ServerSideEmitWithAck(ctx, "count", ser.String("zero"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]interface{}{{float64(1)}, {float64(2)}}, acks)
+	assert.Equal(t, "count from zero", receive(t, nodes[1].events))
+	assert.Equal(t, "count from zero", receive(t, nodes[2].events))
+
+	assert.NoError(t, nodes[2].server.ServerSideEmit("count", ser.String("two")))
+	assert.Equal(t, "count from two", receive(t, nodes[0].events))
+	assert.Equal(t, "count from two", receive(t, nodes[1].events))
+
+	assert.Error(t, nodes[0].server.ServerSideEmit("connect"))
+
+	// a socket on another node is disconnected by that node
+	sockets, err = nodes[0].server.In(ids[2].String()).FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 1) {
+		assert.NoError(t, sockets[0].Disconnect(false))
+	}
+	assert.Equal(t, "disconnect: server namespace disconnect", receive(t, nodes[2].events))
+
+	sockets, err = nodes[0].server.FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 2) {
+		assert.ElementsMatch(t, []sio.SocketID{ids[0], ids[1]}, []sio.SocketID{sockets[0].ID(), sockets[1].ID()})
+	}
+}
+
+func TestClusterTransportServerSideEmitTimeout(t *testing.T) {
+	slow, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer slow.Close()
+
+	fast, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5, tclu.WithPeers(slow.Addr()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fast.Close()
+
+	wait := make(chan struct{})
+	defer close(wait)
+	slow.OnServerSideEmit(func(ns string, data []interface{}) []interface{} {
+		<-wait
+		return nil
+	})
+
+	assert.Eventually(t, func() bool { return len(fast.Peers()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	acks, err := fast.ServerSideEmitWithAck(ctx, "/", []interface{}{"hello"})
+	assert.Equal(t, tclu.ErrRequestTimeout.F(1, 1).Error(), err.Error())
+	assert.Empty(t, acks)
+}
+
+// sendRecorder keeps the packets that are sent to the client
+type sendRecorder struct {
+	eiot.Transporter
+	sent chan eiop.Packet
+}
+
+func (r sendRecorder) Send(packet eiop.Packet) { r.sent <- packet }
+
+// silentNode is a node that says hello, and then never answers. It returns the types of
+// the messages that it has read.
+func silentNode(t *testing.T) (addr string, types func() []int, close func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var read []int
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				msgpack.NewEncoder(conn).Encode(map[string]interface{}{"t": 0, "node": "silent", "addr": ln.Addr().String()})
+				dec := msgpack.NewDecoder(conn).UseDecodeInterfaceLoose(true)
+				for {
+					var msg map[string]interface{}
+					if err := dec.Decode(&msg); err != nil {
+						return
+					}
+					mu.Lock()
+					read = append(read, int(msg["t"].(int64)))
+					mu.Unlock()
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), read...)
+	}, func() { ln.Close() }
+}
+
+func TestClusterTransportJoinOwner(t *testing.T) {
+	silent, _, closeSilent := silentNode(t)
+	defer closeSilent()
+
+	owner, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer owner.Close()
+
+	tr, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5, tclu.WithPeers(owner.Addr(), silent), tclu.WithRequestTimeout(2*time.Second))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer tr.Close()
+
+	assert.Eventually(t, func() bool { return len(tr.Peers()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	socketID, err := owner.Add(eiot.NewPollingTransport(10)("abc", eiot.Codec{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, owner.Join("/", socketID, socketID.String()))
+
+	// the join returns once the node with the socket has answered, without the silent node
+	start := time.Now()
+	assert.NoError(t, tr.Join("/", socketID, "game"))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.ElementsMatch(t, []string{socketID.String(), "game"}, owner.Rooms("/", socketID).Rooms)
+
+	start = time.Now()
+	assert.NoError(t, tr.Leave("/", socketID, "game"))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.ElementsMatch(t, []string{socketID.String()}, owner.Rooms("/", socketID).Rooms)
+
+	// a socket that isn't on any node is waited for until the ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, tclu.ErrRequestTimeout.F(1, 2).Error(), tr.JoinContext(ctx, "/", "unknown", "game").Error())
+}
+
+func TestClusterTransportSendOwner(t *testing.T) {
+	silent, types, closeSilent := silentNode(t)
+	defer closeSilent()
+
+	owner, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer owner.Close()
+
+	tr, err := tclu.NewClusterTransport("127.0.0.1:0", siop.NewPacketV5, tclu.WithPeers(owner.Addr(), silent))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer tr.Close()
+
+	assert.Eventually(t, func() bool { return len(tr.Peers()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	et := sendRecorder{Transporter: eiot.NewPollingTransport(10)("abc", eiot.Codec{}), sent: make(chan eiop.Packet, 10)}
+	socketID, err := owner.Add(et)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, owner.Join("/", socketID, socketID.String()))
+
+	// the packet is only sent to the node with the socket, the other nodes are only asked
+	// for the socket
+	assert.NoError(t, tr.Send(socketID, []interface{}{"hello"}, siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/")))
+	select {
+	case <-et.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	assert.Eventually(t, func() bool { return len(types()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.NotContains(t, types(), 2) // a broadcast message
+}
@@ -0,0 +1,333 @@
+// Package local keeps the sockets that are connected to this server for the transports
+// that share the sockets between servers.
+package local
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	eiot "github.com/njones/socketio/engineio/transport"
+	erro "github.com/njones/socketio/internal/errors"
+	siop "github.com/njones/socketio/protocol"
+	sios "github.com/njones/socketio/session"
+	siot "github.com/njones/socketio/transport"
+)
+
+type (
+	SessionID = eiot.SessionID
+	SocketID  = siot.SocketID
+
+	Option = siop.Option
+	Socket = siot.Socket
+	Data   = siot.Data
+
+	Namespace = string
+	Room      = string
+)
+
+const ErrNilTransporter erro.String = "expected a type of Transporter, found <nil>"
+
+// Registry keeps the sockets that are connected to this server in memory, the same as the
+// in-memory transport, with the rooms that they are in. It's embedded by the transports
+// that send the packets for the sockets that aren't in it on to the other servers.
+type Registry struct {
+	// The current ACK id number
+	ackCount uint64
+
+	// The number of volatile packets that have been dropped
+	dropped uint64
+
+	// The EngineIO (SessionID) to SocketIO (SocketID) relationship
+	ṁ *sync.RWMutex
+	m map[SessionID]SocketID
+
+	// hold the socketID to transport relationship
+	ṡ *sync.RWMutex
+	s map[SocketID]*siot.Transport
+
+	// hold the namespace/socketID to room relationship of the sockets on this server
+	ṙ *sync.Mutex
+	r map[Namespace]map[SocketID]map[Room]struct{}
+
+	// The function that will provide a New Packet based on the supplied codec
+	f siop.NewPacket
+
+	// The parser that encodes and decodes the packets, if it's set
+	parser siop.Parser
+}
+
+// NewRegistry returns an empty registry that creates the packets with the function
+func NewRegistry(fn siop.NewPacket) *Registry {
+	return &Registry{
+		ṁ: new(sync.RWMutex),
+		m: make(map[SessionID]SocketID),
+		ṡ: new(sync.RWMutex),
+		s: make(map[SocketID]*siot.Transport),
+		ṙ: new(sync.Mutex),
+		r: make(map[Namespace]map[SocketID]map[Room]struct{}),
+		f: fn,
+	}
+}
+
+// AckID returns a new Ack Id based on an incrementing number.
+func (reg *Registry) AckID() uint64 {
+	return atomic.AddUint64(&reg.ackCount, 1)
+}
+
+// Dropped returns the number of volatile packets that have been dropped on this server.
+func (reg *Registry) Dropped() uint64 { return atomic.LoadUint64(&reg.dropped) }
+
+// NewPacket returns a new packet from the function that is used for the sockets
+func (reg *Registry) NewPacket() siop.Packet {
+	reg.ṡ.RLock()
+	defer reg.ṡ.RUnlock()
+	return reg.f()
+}
+
+// Transport returns the socket transport of the socket when it's on this server
+func (reg *Registry) Transport(socketID SocketID) *siot.Transport {
+	reg.ṡ.RLock()
+	defer reg.ṡ.RUnlock()
+	return reg.s[socketID]
+}
+
+// Add creates a new socket id based on adding the EngineIO transport
+// to the internal map. It returns the new socket id and any errors.
+func (reg *Registry) Add(et eiot.Transporter) (SocketID, error) {
+	sessionID := et.ID()
+
+	reg.ṁ.Lock()
+	if _, ok := reg.m[sessionID]; !ok {
+		reg.m[sessionID] = sios.GenerateID(sessionID.String())
+	}
+	socketID := reg.m[et.ID()]
+	reg.ṁ.Unlock()
+
+	return socketID, reg.Set(socketID, et)
+}
+
+// Set sets an explicit mapping between the socketID and the EngineIO et Transporter
+func (reg *Registry) Set(socketID SocketID, et eiot.Transporter) error {
+	reg.ṡ.Lock()
+	defer reg.ṡ.Unlock()
+
+	if et == nil {
+		return ErrNilTransporter
+	}
+
+	reg.s[socketID] = siot.NewTransport(socketID, et, reg.f)
+	if reg.parser != nil {
+		reg.s[socketID].SetParser(reg.parser)
+	}
+	return nil
+}
+
+// SetNewPacket changes the function that provides new packets, it's used for the
+// sockets that are added after it's called.
+func (reg *Registry) SetNewPacket(fn siop.NewPacket) {
+	reg.ṡ.Lock()
+	defer reg.ṡ.Unlock()
+	reg.f = fn
+}
+
+// SetParser sets the parser that encodes and decodes the packets, it's used for the
+// sockets that are added after it's called.
+func (reg *Registry) SetParser(p siop.Parser) {
+	reg.ṡ.Lock()
+	defer reg.ṡ.Unlock()
+	reg.parser = p
+}
+
+// CloseSession removes the EngineIO session, and the transport of the socket that used the
+// session. The socket stays in its rooms, so the returned namespaces can be disconnected by
+// the caller.
+func (reg *Registry) CloseSession(sessionID SessionID) (SocketID, []Namespace) {
+	reg.ṁ.Lock()
+	socketID, ok := reg.m[sessionID]
+	delete(reg.m, sessionID)
+	reg.ṁ.Unlock()
+
+	if !ok {
+		return "", nil
+	}
+
+	reg.ṡ.Lock()
+	delete(reg.s, socketID)
+	reg.ṡ.Unlock()
+
+	var namespaces []Namespace
+
+	reg.ṙ.Lock()
+	for ns, sockets := range reg.r {
+		if _, ok := sockets[socketID]; ok {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	reg.ṙ.Unlock()
+
+	sort.Strings(namespaces)
+	return socketID, namespaces
+}
+
+// Receive takes a socketIO socketID and receives sockets on a channel. These should come from an EngineIO transport.
+func (reg *Registry) Receive(socketID SocketID) <-chan Socket {
+	reg.ṡ.Lock()
+	defer reg.ṡ.Unlock()
+
+	if _, ok := reg.s[socketID]; ok {
+		return reg.s[socketID].Receive()
+	}
+	return nil
+}
+
+// SendLocal sends the data to the socket when it has a transport on this server, it
+// returns false when it doesn't.
+func (reg *Registry) SendLocal(socketID SocketID, data Data, opts ...Option) bool {
+	t := reg.Transport(socketID)
+	if t == nil {
+		return false
+	}
+	t.Send(data, opts...)
+	return true
+}
+
+// SendVolatileLocal is the same as SendLocal, except the data is dropped when the
+// EngineIO transport is not writable. Dropped data is counted.
+func (reg *Registry) SendVolatileLocal(socketID SocketID, data Data, opts ...Option) bool {
+	t := reg.Transport(socketID)
+	if t == nil {
+		return false
+	}
+	if !t.SendVolatile(data, opts...) {
+		atomic.AddUint64(&reg.dropped, 1)
+	}
+	return true
+}
+
+// Deliver sends a packet to each socket of this server in the namespace that is in any of
+// the rooms, or every socket when there are no rooms, without the sockets in the except
+// rooms. The packet function is called for each socket, as binary data can only be read
+// once, and the delivery stops when it returns an error.
+func (reg *Registry) Deliver(ns Namespace, rooms, except []Room, volatile bool, packet func() (Data, []Option, error)) {
+	for _, socketID := range reg.Local(ns, rooms, except) {
+		t := reg.Transport(socketID)
+		if t == nil {
+			continue
+		}
+
+		data, opts, err := packet()
+		if err != nil {
+			return
+		}
+		if volatile {
+			if !t.SendVolatile(data, opts...) {
+				atomic.AddUint64(&reg.dropped, 1)
+			}
+			continue
+		}
+		t.Send(data, opts...)
+	}
+}
+
+// JoinLocal adds the socket of this server to the room
+func (reg *Registry) JoinLocal(ns Namespace, socketID SocketID, room Room) {
+	reg.ṙ.Lock()
+	defer reg.ṙ.Unlock()
+
+	if _, ok := reg.r[ns]; !ok {
+		reg.r[ns] = make(map[SocketID]map[Room]struct{})
+	}
+	if _, ok := reg.r[ns][socketID]; !ok {
+		reg.r[ns][socketID] = make(map[Room]struct{})
+	}
+	reg.r[ns][socketID][room] = struct{}{}
+}
+
+// LeaveLocal removes the socket of this server from the room. It returns false when the
+// socket isn't in the namespace, and if the socket is no longer in the namespace after.
+func (reg *Registry) LeaveLocal(ns Namespace, socketID SocketID, room Room) (ok, empty bool) {
+	reg.ṙ.Lock()
+	defer reg.ṙ.Unlock()
+
+	if _, ok := reg.r[ns][socketID]; !ok {
+		return false, false
+	}
+
+	delete(reg.r[ns][socketID], room)
+	if empty = len(reg.r[ns][socketID]) == 0; empty {
+		delete(reg.r[ns], socketID) // the socket is no longer in the namespace
+	}
+	return true, empty
+}
+
+// IsLocal reports if the socket is connected to this server, or was until its session
+// closed and it's still in its rooms.
+func (reg *Registry) IsLocal(socketID SocketID) bool {
+	if reg.Transport(socketID) != nil {
+		return true
+	}
+
+	reg.ṙ.Lock()
+	defer reg.ṙ.Unlock()
+	for _, sockets := range reg.r {
+		if _, ok := sockets[socketID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Local returns the sockets of this server in the namespace that are in any of the rooms,
+// or all of them when there are no rooms, without the sockets in the except rooms.
+func (reg *Registry) Local(ns Namespace, rooms, except []Room) []SocketID {
+	reg.ṙ.Lock()
+	defer reg.ṙ.Unlock()
+
+	in := func(socketID SocketID, list []Room) bool {
+		for _, room := range list {
+			if _, ok := reg.r[ns][socketID][room]; ok || room == socketID.String() {
+				return true
+			}
+		}
+		return false
+	}
+
+	var rtn []SocketID
+	for socketID := range reg.r[ns] {
+		if (len(rooms) == 0 || in(socketID, rooms)) && !in(socketID, except) {
+			rtn = append(rtn, socketID)
+		}
+	}
+	return rtn
+}
+
+// LocalRooms returns the sorted rooms of the sockets of this server in the namespace, or
+// of only the socket when the socket id is not empty. An empty namespace is every
+// namespace, with the rooms by namespace.
+func (reg *Registry) LocalRooms(ns Namespace, socketID SocketID) map[Namespace]map[SocketID][]Room {
+	reg.ṙ.Lock()
+	defer reg.ṙ.Unlock()
+
+	var rtn = make(map[Namespace]map[SocketID][]Room)
+	for namespace, sockets := range reg.r {
+		if ns != "" && namespace != ns {
+			continue
+		}
+		for id, rooms := range sockets {
+			if socketID != "" && id != socketID {
+				continue
+			}
+			if _, ok := rtn[namespace]; !ok {
+				rtn[namespace] = make(map[SocketID][]Room)
+			}
+			list := make([]Room, 0, len(rooms))
+			for room := range rooms {
+				list = append(list, room)
+			}
+			sort.Strings(list)
+			rtn[namespace][id] = list
+		}
+	}
+	return rtn
+}
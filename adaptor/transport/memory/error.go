@@ -7,5 +7,10 @@ import (
 // All of the possible errors the map transport can return
 const (
 	ErrSocketIDTransportNotFound erro.StringF = "socket id %q not found in the in-memory map"
+	ErrSocketIDDetailsNotFound   erro.StringF = "socket id %q details not found in the in-memory map"
+	ErrSessionNotFound           erro.StringF = "session %q not found in the in-memory map"
+	ErrSessionExpired            erro.StringF = "session %q has packets past the max disconnection duration"
+	ErrOffsetNotFound            erro.StringF = "offset %q not found in the replay buffer"
+	ErrSocketIDInUse             erro.StringF = "socket id %q is in use and can not be moved"
 	ErrNilTransporter            erro.String  = "expected a type of Transporter, found <nil>"
 )
@@ -3,8 +3,11 @@
 package memory
 
 import (
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	eiot "github.com/njones/socketio/engineio/transport"
 	siop "github.com/njones/socketio/protocol"
@@ -16,6 +19,8 @@ type (
 	SessionID = eiot.SessionID
 	SocketID  = siot.SocketID
 
+	PrivateID = siot.PrivateID
+
 	Option = siop.Option
 	Socket = siot.Socket
 	Data   = siot.Data
@@ -30,6 +35,12 @@ type inMemoryTransport struct {
 	// The current ACK id number
 	ackCount uint64
 
+	// The number of volatile packets that have been dropped
+	dropped uint64
+
+	// The last offset that was added to an event packet
+	offsetCount uint64
+
 	// The EngineIO (SessionID) to SocketIO (SocketID) relationship
 	ṁ *sync.RWMutex
 	m map[SessionID]SocketID
@@ -42,8 +53,18 @@ type inMemoryTransport struct {
 	ṙ *sync.Mutex
 	r map[Namespace]map[SocketID]map[Room]struct{}
 
+	// hold the namespace/socketID to details relationship, this uses the room mutex
+	d map[Namespace]map[SocketID]siot.SocketDetails
+
+	// hold the namespace/socketID to connection state recovery relationship
+	ṗ *sync.Mutex
+	p map[Namespace]map[SocketID]*session
+
 	// The function that will provide a New Packet based on the supplied codec
 	f siop.NewPacket
+
+	// The parser that encodes and decodes the packets, if it's set
+	parser siop.Parser
 }
 
 // NewInMemoryTransport returns a mapTransport object with all defaults.
@@ -57,6 +78,9 @@ func NewInMemoryTransport(fn siop.NewPacket) *inMemoryTransport {
 		s: make(map[SocketID]*siot.Transport),
 		ṙ: new(sync.Mutex),
 		r: make(map[Namespace]map[SocketID]map[Room]struct{}),
+		d: make(map[Namespace]map[SocketID]siot.SocketDetails),
+		ṗ: new(sync.Mutex),
+		p: make(map[Namespace]map[SocketID]*session),
 		f: fn,
 	}
 }
@@ -101,9 +125,59 @@ func (tr *inMemoryTransport) Set(socketID SocketID, et eiot.Transporter) error {
 	}
 
 	tr.s[socketID] = siot.NewTransport(socketID, et, tr.f)
+	if tr.parser != nil {
+		tr.s[socketID].SetParser(tr.parser)
+	}
 	return nil
 }
 
+// SetNewPacket changes the function that provides new packets, it's used for the
+// sockets that are added after it's called.
+func (tr *inMemoryTransport) SetNewPacket(fn siop.NewPacket) {
+	tr.ṡ.Lock()
+	defer tr.ṡ.Unlock()
+	tr.f = fn
+}
+
+// SetParser sets the parser that encodes and decodes the packets, it's used for the
+// sockets that are added after it's called.
+func (tr *inMemoryTransport) SetParser(p siop.Parser) {
+	tr.ṡ.Lock()
+	defer tr.ṡ.Unlock()
+	tr.parser = p
+}
+
+// CloseSession removes the EngineIO session, and the transport of the socket that used the
+// session. The socket stays in its rooms, so the returned namespaces can be disconnected by
+// the caller. Nothing is returned when the socket has moved to a newer session.
+func (tr *inMemoryTransport) CloseSession(sessionID SessionID) (SocketID, []Namespace) {
+	tr.ṁ.Lock()
+	socketID, ok := tr.m[sessionID] // a moved socket has no entry for its older sessions
+	delete(tr.m, sessionID)
+	tr.ṁ.Unlock()
+
+	if !ok {
+		return "", nil
+	}
+
+	tr.ṡ.Lock()
+	delete(tr.s, socketID)
+	tr.ṡ.Unlock()
+
+	var namespaces []Namespace
+
+	tr.ṙ.Lock()
+	for ns, sockets := range tr.r {
+		if _, ok := sockets[socketID]; ok {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	tr.ṙ.Unlock()
+
+	sort.Strings(namespaces)
+	return socketID, namespaces
+}
+
 // Receive takes a socketIO socketID and receives sockets on a channel. These should come from an EngineIO transport.
 func (tr *inMemoryTransport) Receive(socketID SocketID) <-chan Socket {
 	tr.ṡ.Lock()
@@ -122,13 +196,34 @@ func (tr *inMemoryTransport) Send(socketID SocketID, data Data, opts ...Option)
 	defer tr.ṡ.Unlock()
 
 	if _, ok := tr.s[socketID]; !ok {
+		tr.offset(socketID, data, opts) // kept for the connection state recovery
 		return ErrSocketIDTransportNotFound.F(socketID.String())
 	}
 
-	tr.s[socketID].Send(data, opts...)
+	tr.s[socketID].Send(tr.offset(socketID, data, opts), opts...)
 	return nil
 }
 
+// SendVolatile is the same as Send, except the data is dropped when the EngineIO
+// transport is not writable. Dropped data is counted, and is not an error.
+func (tr *inMemoryTransport) SendVolatile(socketID SocketID, data Data, opts ...Option) error {
+	tr.ṡ.Lock()
+	defer tr.ṡ.Unlock()
+
+	if _, ok := tr.s[socketID]; !ok {
+		tr.offset(socketID, data, opts) // kept for the connection state recovery
+		return ErrSocketIDTransportNotFound.F(socketID.String())
+	}
+
+	if !tr.s[socketID].SendVolatile(tr.offset(socketID, data, opts), opts...) {
+		atomic.AddUint64(&tr.dropped, 1)
+	}
+	return nil
+}
+
+// Dropped returns the number of volatile packets that have been dropped.
+func (tr *inMemoryTransport) Dropped() uint64 { return atomic.LoadUint64(&tr.dropped) }
+
 // namespace/socketID to room relationship
 
 func (tr *inMemoryTransport) Join(ns Namespace, socketID SocketID, room Room) error {
@@ -157,10 +252,42 @@ func (tr *inMemoryTransport) Leave(ns Namespace, socketID SocketID, room Room) e
 	}
 
 	delete(tr.r[ns][socketID], room)
+	if len(tr.r[ns][socketID]) == 0 {
+		delete(tr.r[ns], socketID) // the socket is no longer in the namespace
+		delete(tr.d[ns], socketID)
+
+		tr.ṗ.Lock()
+		delete(tr.p[ns], socketID)
+		tr.ṗ.Unlock()
+	}
+	return nil
+}
+
+// SetDetails keeps the details of the socket in the namespace
+func (tr *inMemoryTransport) SetDetails(ns Namespace, socketID SocketID, details siot.SocketDetails) error {
+	tr.ṙ.Lock()
+	defer tr.ṙ.Unlock()
+
+	if _, ok := tr.d[ns]; !ok {
+		tr.d[ns] = make(map[SocketID]siot.SocketDetails)
+	}
+	tr.d[ns][socketID] = details
 	return nil
 }
 
+// Details returns the details of the socket in the namespace
+func (tr *inMemoryTransport) Details(ns Namespace, socketID SocketID) (siot.SocketDetails, error) {
+	tr.ṙ.Lock()
+	defer tr.ṙ.Unlock()
+
+	if details, ok := tr.d[ns][socketID]; ok {
+		return details, nil
+	}
+	return siot.SocketDetails{}, ErrSocketIDDetailsNotFound.F(socketID.String())
+}
+
 func (tr *inMemoryTransport) Sockets(namespace Namespace) siot.SocketArray {
+	tr.ṙ.Lock()
 	var ids []SocketID
 	for ns, socketIDs := range tr.r {
 		if ns == namespace {
@@ -169,9 +296,13 @@ func (tr *inMemoryTransport) Sockets(namespace Namespace) siot.SocketArray {
 			}
 		}
 	}
+	tr.ṙ.Unlock()
 
 	return siot.InitSocketArray(namespace, ids, siot.WithSocketRoomFilter(
 		func(ns Namespace, rm Room, id SocketID) (bool, error) {
+			tr.ṙ.Lock()
+			defer tr.ṙ.Unlock()
+
 			if _ns, ok := tr.r[ns]; ok {
 				if _id, ok := _ns[id]; ok {
 					if _, ok := _id[rm]; ok {
@@ -184,7 +315,25 @@ func (tr *inMemoryTransport) Sockets(namespace Namespace) siot.SocketArray {
 	))
 }
 
+// Namespaces returns the sorted namespaces that have sockets in them
+func (tr *inMemoryTransport) Namespaces() []Namespace {
+	tr.ṙ.Lock()
+	defer tr.ṙ.Unlock()
+
+	var rtn []Namespace
+	for ns, sockets := range tr.r {
+		if len(sockets) > 0 {
+			rtn = append(rtn, ns)
+		}
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
 func (tr *inMemoryTransport) Rooms(namespace Namespace, socketID SocketID) siot.RoomArray {
+	tr.ṙ.Lock()
+	defer tr.ṙ.Unlock()
+
 	var names []Room
 
 FindingRoomNames:
@@ -202,3 +351,197 @@ FindingRoomNames:
 	}
 	return siot.RoomArray{Rooms: names}
 }
+
+// ReplayBufferSize is the most event packets that are kept for each persisted socket
+var ReplayBufferSize = 1000
+
+// session is the connection state recovery of a socket in a namespace
+type session struct {
+	pid    PrivateID
+	maxAge time.Duration
+
+	first, last string // the offset before the kept packets, and the offset of the last packet
+	packets     []replay
+}
+
+// replay is an event packet that was sent to the socket of the session
+type replay struct {
+	offset string
+	at     time.Time
+	socket Socket
+}
+
+// add keeps the packet, and drops the packets that are past the max age or the buffer size
+func (s *session) add(r replay) {
+	s.last = r.offset
+	s.packets = append(s.packets, r)
+
+	var i int
+	for i < len(s.packets) && r.at.Sub(s.packets[i].at) > s.maxAge {
+		i++
+	}
+	if n := len(s.packets) - ReplayBufferSize; n > i {
+		i = n
+	}
+	if i > 0 {
+		s.first = s.packets[i-1].offset
+		s.packets = s.packets[i:]
+	}
+}
+
+// missed returns the packets that were sent after the offset, the packets are only
+// returned when none of them were sent longer than the max age ago.
+func (s *session) missed(offset string, now time.Time) ([]Socket, error) {
+	i := len(s.packets)
+	if offset != s.last {
+		for i = 0; i < len(s.packets) && s.packets[i].offset != offset; i++ {
+		}
+		switch {
+		case offset == s.first:
+			i = 0
+		case i == len(s.packets):
+			return nil, ErrOffsetNotFound.F(offset)
+		default:
+			i++
+		}
+	}
+
+	rtn := make([]Socket, 0, len(s.packets)-i)
+	for _, r := range s.packets[i:] {
+		if now.Sub(r.at) > s.maxAge {
+			return nil, ErrSessionExpired.F(s.pid.String())
+		}
+		rtn = append(rtn, r.socket)
+	}
+	return rtn, nil
+}
+
+// offset adds the next offset as the last value of the event data that is sent to a
+// persisted socket, and keeps the packet so that it can be replayed when restored.
+func (tr *inMemoryTransport) offset(socketID SocketID, data Data, opts []Option) Data {
+	pac, ok := tr.f().WithOption(opts...).(interface {
+		GetType() byte
+		GetNamespace() string
+		GetAckID() uint64
+	})
+	if !ok || pac.GetType() != siop.EventPacket.Byte() {
+		return data
+	}
+
+	val, ok := data.([]interface{})
+	if !ok {
+		return data
+	}
+
+	tr.ṗ.Lock()
+	defer tr.ṗ.Unlock()
+
+	sess, ok := tr.p[pac.GetNamespace()][socketID]
+	if !ok {
+		return data
+	}
+
+	offset := strconv.FormatUint(atomic.AddUint64(&tr.offsetCount, 1), 36)
+	data = append(val[:len(val):len(val)], offset)
+
+	sess.add(replay{
+		offset: offset,
+		at:     time.Now(),
+		socket: Socket{Type: pac.GetType(), Namespace: pac.GetNamespace(), AckID: pac.GetAckID(), Data: data},
+	})
+	return data
+}
+
+// PersistSession starts adding offsets to the event packets that are sent to the socket
+// in the namespace, and keeping them for up to the maxDisconnection duration. It returns
+// the private id that restores the socket, which is the same for an already persisted socket.
+func (tr *inMemoryTransport) PersistSession(ns Namespace, socketID SocketID, maxDisconnection time.Duration) (PrivateID, error) {
+	tr.ṗ.Lock()
+	defer tr.ṗ.Unlock()
+
+	if _, ok := tr.p[ns]; !ok {
+		tr.p[ns] = make(map[SocketID]*session)
+	}
+	if sess, ok := tr.p[ns][socketID]; ok {
+		sess.maxAge = maxDisconnection
+		return sess.pid, nil
+	}
+
+	sess := &session{pid: sios.GeneratePrivateID(), maxAge: maxDisconnection}
+	tr.p[ns][socketID] = sess
+	return sess.pid, nil
+}
+
+// RestoreSession returns the state of the socket that was persisted with the private id,
+// and the packets that were sent after the offset. The EngineIO transport of the socketID
+// is moved over to the restored socket id.
+func (tr *inMemoryTransport) RestoreSession(ns Namespace, pid PrivateID, offset string, socketID SocketID) (siot.SessionState, error) {
+	var restoreID SocketID
+	var missed []Socket
+	var err error
+
+	tr.ṗ.Lock()
+	for id, sess := range tr.p[ns] {
+		if sess.pid == pid {
+			restoreID = id
+			missed, err = sess.missed(offset, time.Now())
+			break
+		}
+	}
+	tr.ṗ.Unlock()
+
+	switch {
+	case err != nil:
+		return siot.SessionState{}, err
+	case restoreID == "":
+		return siot.SessionState{}, ErrSessionNotFound.F(pid.String())
+	case restoreID != socketID:
+		if err := tr.move(socketID, restoreID); err != nil {
+			return siot.SessionState{}, err
+		}
+	}
+
+	details, _ := tr.Details(ns, restoreID)
+	return siot.SessionState{SocketID: restoreID, Details: details, Missed: missed}, nil
+}
+
+// move maps the EngineIO session and transport of the from socket id to the to socket id,
+// the from socket id can not be used in any of the namespaces. The EngineIO session that
+// the to socket id still has is unmapped and closed, so that closing it later does not
+// remove the moved transport.
+func (tr *inMemoryTransport) move(from, to SocketID) error {
+	tr.ṙ.Lock()
+	for _, sockets := range tr.r {
+		if _, ok := sockets[from]; ok {
+			tr.ṙ.Unlock()
+			return ErrSocketIDInUse.F(from.String())
+		}
+	}
+	tr.ṙ.Unlock()
+
+	tr.ṡ.Lock()
+	if _, ok := tr.s[from]; !ok {
+		tr.ṡ.Unlock()
+		return ErrSocketIDTransportNotFound.F(from.String())
+	}
+	stale := tr.s[to]
+	tr.s[to] = tr.s[from]
+	delete(tr.s, from)
+	tr.ṡ.Unlock()
+
+	tr.ṁ.Lock()
+	for sessionID, socketID := range tr.m {
+		switch socketID {
+		case to:
+			delete(tr.m, sessionID)
+		case from:
+			tr.m[sessionID] = to
+		}
+	}
+	tr.ṁ.Unlock()
+
+	if stale != nil {
+		stale.Shutdown()
+	}
+	return nil
+}
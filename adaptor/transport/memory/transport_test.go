@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	tmap "github.com/njones/socketio/adaptor/transport/memory"
 	eiop "github.com/njones/socketio/engineio/protocol"
@@ -388,3 +389,219 @@ func TestTransportMapJoinLeaveRooms(t *testing.T) {
 		})
 	}
 }
+
+type mockWritableTransporter struct {
+	mockTransporter
+	writable bool
+	sent     *[]eiop.Packet
+}
+
+func (mt mockWritableTransporter) Writable() bool { return mt.writable }
+
+func (mt mockWritableTransporter) Send(packet eiop.Packet) {
+	*mt.sent = append(*mt.sent, packet)
+}
+
+func (mt mockWritableTransporter) Shutdown() {
+	mt.Send(eiop.Packet{T: eiop.ClosePacket})
+}
+
+func TestTransportSendVolatile(t *testing.T) {
+	memTransport := tmap.NewInMemoryTransport(siop.NewPacketV2)
+
+	var sentReady, sentBusy []eiop.Packet
+	ready := mockWritableTransporter{mockTransporter: newMockTransporter("eio:ready"), writable: true, sent: &sentReady}
+	busy := mockWritableTransporter{mockTransporter: newMockTransporter("eio:busy"), writable: false, sent: &sentBusy}
+
+	sidReady, sidBusy := siot.SocketID("sio:ready"), siot.SocketID("sio:busy")
+	assert.NoError(t, memTransport.Set(sidReady, ready))
+	assert.NoError(t, memTransport.Set(sidBusy, busy))
+
+	assert.NoError(t, memTransport.SendVolatile(sidReady, []interface{}{"cursor", 1}))
+	assert.NoError(t, memTransport.SendVolatile(sidBusy, []interface{}{"cursor", 1}))
+	assert.NoError(t, memTransport.SendVolatile(sidBusy, []interface{}{"cursor", 2}))
+
+	assert.Len(t, sentReady, 1)
+	assert.Len(t, sentBusy, 0)
+	assert.Equal(t, uint64(2), memTransport.Dropped())
+
+	err := memTransport.SendVolatile(siot.SocketID("sio:missing"), []interface{}{"cursor", 3})
+	assert.ErrorIs(t, err, tmap.ErrSocketIDTransportNotFound)
+}
+
+func TestTransportSocketDetails(t *testing.T) {
+	memTransport := tmap.NewInMemoryTransport(siop.NewPacketV2)
+
+	sid := siot.SocketID("sio:details")
+	details := siot.SocketDetails{Auth: map[string]interface{}{"token": "abc"}, Data: "data"}
+
+	assert.NoError(t, memTransport.Join("/", sid, "room1"))
+	assert.NoError(t, memTransport.SetDetails("/", sid, details))
+
+	have, err := memTransport.Details("/", sid)
+	assert.NoError(t, err)
+	assert.Equal(t, details, have)
+
+	_, err = memTransport.Details("/other", sid)
+	assert.ErrorIs(t, err, tmap.ErrSocketIDDetailsNotFound)
+
+	// leaving the last room removes the socket, and the details, from the namespace
+	assert.NoError(t, memTransport.Leave("/", sid, "room1"))
+	assert.Empty(t, memTransport.Sockets("/").IDs())
+
+	_, err = memTransport.Details("/", sid)
+	assert.ErrorIs(t, err, tmap.ErrSocketIDDetailsNotFound)
+}
+
+func TestTransportRecoverSession(t *testing.T) {
+	memTransport := tmap.NewInMemoryTransport(siop.NewPacketV2)
+
+	var sent []eiop.Packet
+	sidOld, sidNew := siot.SocketID("sio:old"), siot.SocketID("sio:new")
+	assert.NoError(t, memTransport.Set(sidOld, mockWritableTransporter{mockTransporter: newMockTransporter("eio:old"), writable: true, sent: &sent}))
+	assert.NoError(t, memTransport.Join("/", sidOld, "room"))
+
+	pid, err := memTransport.PersistSession("/", sidOld, time.Minute)
+	assert.NoError(t, err)
+
+	samePID, err := memTransport.PersistSession("/", sidOld, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, pid, samePID)
+
+	event := []siop.Option{siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/")}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, memTransport.Send(sidOld, []interface{}{"tick", i}, event...))
+	}
+	assert.NoError(t, memTransport.Send(sidOld, []interface{}{"ok"}, siop.WithType(siop.AckPacket.Byte()), siop.WithNamespace("/")))
+
+	var offsets []string
+	for _, packet := range sent {
+		data := packet.D.(interface{ GetData() interface{} }).GetData().([]interface{})
+		if offset, ok := data[len(data)-1].(string); ok && len(data) == 3 {
+			offsets = append(offsets, offset)
+		}
+	}
+	if !assert.Len(t, offsets, 3) {
+		return
+	}
+
+	_, err = memTransport.RestoreSession("/", pid, "unknown", sidNew)
+	assert.ErrorIs(t, err, tmap.ErrOffsetNotFound)
+
+	_, err = memTransport.RestoreSession("/", "unknown", offsets[0], sidNew)
+	assert.ErrorIs(t, err, tmap.ErrSessionNotFound)
+
+	assert.NoError(t, memTransport.Set(sidNew, newMockTransporter("eio:new")))
+
+	state, err := memTransport.RestoreSession("/", pid, offsets[0], sidNew)
+	assert.NoError(t, err)
+	assert.Equal(t, sidOld, state.SocketID)
+	if assert.Len(t, state.Missed, 2) {
+		assert.Equal(t, []interface{}{"tick", 1, offsets[1]}, state.Missed[0].Data)
+		assert.Equal(t, []interface{}{"tick", 2, offsets[2]}, state.Missed[1].Data)
+	}
+
+	// the transport of the new socket id is moved to the restored socket id
+	assert.Nil(t, memTransport.Transport(sidNew))
+	assert.NotNil(t, memTransport.Transport(sidOld))
+
+	state, err = memTransport.RestoreSession("/", pid, offsets[2], sidOld)
+	assert.NoError(t, err)
+	assert.Len(t, state.Missed, 0)
+
+	// leaving the last room removes the session
+	assert.NoError(t, memTransport.Leave("/", sidOld, "room"))
+	_, err = memTransport.RestoreSession("/", pid, offsets[2], sidOld)
+	assert.ErrorIs(t, err, tmap.ErrSessionNotFound)
+}
+
+func TestTransportRecoverSessionWhileOpen(t *testing.T) {
+	var ids = []tmap.SocketID{"sio:old", "sio:new"}
+	defer func(fn func(string) tmap.SocketID) { sess.GenerateID = fn }(sess.GenerateID)
+	sess.GenerateID = func(string) tmap.SocketID { id := ids[0]; ids = ids[1:]; return id }
+
+	memTransport := tmap.NewInMemoryTransport(siop.NewPacketV2)
+
+	var sentOld, sentNew []eiop.Packet
+	sidOld, err := memTransport.Add(mockWritableTransporter{mockTransporter: newMockTransporter("eio:old"), writable: true, sent: &sentOld})
+	assert.NoError(t, err)
+	assert.NoError(t, memTransport.Join("/", sidOld, "room"))
+
+	pid, err := memTransport.PersistSession("/", sidOld, time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, memTransport.Send(sidOld, []interface{}{"tick"}, siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/")))
+	data := sentOld[0].D.(interface{ GetData() interface{} }).GetData().([]interface{})
+
+	// the client reconnects before the server has noticed that the old session is gone
+	sidNew, err := memTransport.Add(mockWritableTransporter{mockTransporter: newMockTransporter("eio:new"), writable: true, sent: &sentNew})
+	assert.NoError(t, err)
+
+	state, err := memTransport.RestoreSession("/", pid, data[len(data)-1].(string), sidNew)
+	assert.NoError(t, err)
+	assert.Equal(t, sidOld, state.SocketID)
+
+	// the old session is closed, and closing it does not remove the restored socket
+	if assert.Len(t, sentOld, 2) {
+		assert.Equal(t, eiop.ClosePacket, sentOld[1].T)
+	}
+	socketID, namespaces := memTransport.CloseSession("eio:old")
+	assert.Empty(t, socketID)
+	assert.Empty(t, namespaces)
+	assert.NotNil(t, memTransport.Transport(sidOld))
+
+	assert.NoError(t, memTransport.Send(sidOld, []interface{}{"tock"}, siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/")))
+	assert.Len(t, sentNew, 1)
+
+	socketID, namespaces = memTransport.CloseSession("eio:new")
+	assert.Equal(t, sidOld, socketID)
+	assert.Equal(t, []string{"/"}, namespaces)
+	assert.Nil(t, memTransport.Transport(sidOld))
+}
+
+func TestTransportReplayBufferSize(t *testing.T) {
+	defer func(size int) { tmap.ReplayBufferSize = size }(tmap.ReplayBufferSize)
+	tmap.ReplayBufferSize = 2
+
+	memTransport := tmap.NewInMemoryTransport(siop.NewPacketV2)
+
+	var sent []eiop.Packet
+	sid := siot.SocketID("sio:bounded")
+	assert.NoError(t, memTransport.Set(sid, mockWritableTransporter{mockTransporter: newMockTransporter("eio:bounded"), writable: true, sent: &sent}))
+
+	pid, err := memTransport.PersistSession("/", sid, time.Minute)
+	assert.NoError(t, err)
+
+	var offsets []string
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, memTransport.Send(sid, []interface{}{"tick", i}, siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/")))
+		data := sent[i].D.(interface{ GetData() interface{} }).GetData().([]interface{})
+		offsets = append(offsets, data[len(data)-1].(string))
+	}
+
+	_, err = memTransport.RestoreSession("/", pid, offsets[0], sid)
+	assert.ErrorIs(t, err, tmap.ErrOffsetNotFound)
+
+	state, err := memTransport.RestoreSession("/", pid, offsets[1], sid)
+	assert.NoError(t, err)
+	assert.Len(t, state.Missed, 2)
+}
+
+func TestTransportCloseSession(t *testing.T) {
+	sess.GenerateID = func(string) tmap.SocketID { return tmap.SocketID("sio:a") }
+	memTransport := tmap.NewInMemoryTransport(siop.NewPacketV2)
+
+	sid, err := memTransport.Add(newMockTransporter("eio:a"))
+	assert.NoError(t, err)
+	assert.NoError(t, memTransport.Join("/", sid, "room"))
+	assert.NoError(t, memTransport.Join("/chat", sid, "room"))
+
+	socketID, namespaces := memTransport.CloseSession("eio:a")
+	assert.Equal(t, sid, socketID)
+	assert.Equal(t, []string{"/", "/chat"}, namespaces)
+	assert.Nil(t, memTransport.Receive(sid), "the transport is removed")
+	assert.Equal(t, []string{"room"}, memTransport.Rooms("/", sid).Rooms, "the rooms are left by the caller")
+
+	socketID, namespaces = memTransport.CloseSession("eio:a")
+	assert.Empty(t, socketID)
+	assert.Empty(t, namespaces)
+}
@@ -0,0 +1,16 @@
+package redis
+
+import (
+	erro "github.com/njones/socketio/internal/errors"
+)
+
+// All of the possible errors the redis transport can return
+const (
+	ErrSocketIDTransportNotFound erro.StringF = "socket id %q not found on this server"
+	ErrSocketIDDetailsNotFound   erro.StringF = "socket id %q details not found in redis"
+	ErrDialFailed                erro.StringF = "failed to dial redis:: %w"
+	ErrCommandFailed             erro.StringF = "redis command %s failed:: %w"
+	ErrUnexpectedReply           erro.StringF = "unexpected redis reply %q"
+	ErrEncodeFailed              erro.StringF = "failed to encode the %s message:: %w"
+	ErrNilTransporter            erro.String  = "expected a type of Transporter, found <nil>"
+)
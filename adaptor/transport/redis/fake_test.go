@@ -0,0 +1,269 @@
+package redis_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeRedis is an in-process Redis server that speaks RESP over net.Pipe connections. It
+// only has the commands that the transport sends, and a pattern can only end with a '*'.
+type fakeRedis struct {
+	mu        sync.Mutex
+	sets      map[string]map[string]struct{}
+	strs      map[string]string
+	expires   map[string]time.Time
+	subs      map[*subscriber][]string
+	published []published
+}
+
+type published struct{ channel, payload string }
+
+// subscriber queues the messages, like the output buffer of Redis, so that a publisher
+// doesn't wait on the subscriber to read them.
+type subscriber struct {
+	queue chan string
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		sets:    make(map[string]map[string]struct{}),
+		strs:    make(map[string]string),
+		expires: make(map[string]time.Time),
+		subs:    make(map[*subscriber][]string),
+	}
+}
+
+// Dial returns the client end of a new connection to the server
+func (f *fakeRedis) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	go f.serve(server)
+	return client, nil
+}
+
+// Published returns the messages that were published on the channel
+func (f *fakeRedis) Published(channel string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rtn []string
+	for _, msg := range f.published {
+		if msg.channel == channel {
+			rtn = append(rtn, msg.payload)
+		}
+	}
+	return rtn
+}
+
+// Members returns the members of the set at the key
+func (f *fakeRedis) Members(key string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rtn []string
+	for member := range f.sets[key] {
+		rtn = append(rtn, member)
+	}
+	return rtn
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+
+	var (
+		r   = bufio.NewReader(c)
+		ẇ   sync.Mutex
+		sub *subscriber
+	)
+	write := func(reply string) error {
+		ẇ.Lock()
+		defer ẇ.Unlock()
+		_, err := io.WriteString(c, reply)
+		return err
+	}
+	defer func() {
+		if sub != nil {
+			f.mu.Lock()
+			delete(f.subs, sub)
+			f.mu.Unlock()
+			close(sub.queue)
+		}
+	}()
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		if strings.ToUpper(args[0]) == "PSUBSCRIBE" {
+			if sub == nil {
+				sub = &subscriber{queue: make(chan string, 1024)}
+				go func(sub *subscriber) {
+					for msg := range sub.queue {
+						if write(msg) != nil {
+							c.Close()
+						}
+					}
+				}(sub)
+			}
+			f.mu.Lock()
+			f.subs[sub] = append(f.subs[sub], args[1:]...)
+			count := len(f.subs[sub])
+			f.mu.Unlock()
+			for _, pattern := range args[1:] {
+				sub.queue <- array(bulk("psubscribe"), bulk(pattern), fmt.Sprintf(":%d\r\n", count))
+			}
+			continue
+		}
+
+		if write(f.do(args)) != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) do(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SADD":
+		if _, ok := f.sets[args[1]]; !ok {
+			f.sets[args[1]] = make(map[string]struct{})
+		}
+		var n int
+		for _, member := range args[2:] {
+			if _, ok := f.sets[args[1]][member]; !ok {
+				f.sets[args[1]][member] = struct{}{}
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SREM":
+		var n int
+		for _, member := range args[2:] {
+			if _, ok := f.sets[args[1]][member]; ok {
+				delete(f.sets[args[1]], member)
+				n++
+			}
+		}
+		if len(f.sets[args[1]]) == 0 {
+			delete(f.sets, args[1])
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SMEMBERS":
+		var members []string
+		for member := range f.sets[args[1]] {
+			members = append(members, bulk(member))
+		}
+		return array(members...)
+	case "SET":
+		f.strs[args[1]] = args[2]
+		delete(f.expires, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "GET":
+		if str, ok := f.str(args[1]); ok {
+			return bulk(str)
+		}
+		return "$-1\r\n"
+	case "EXISTS":
+		var n int
+		for _, key := range args[1:] {
+			if _, ok := f.sets[key]; ok {
+				n++
+			} else if _, ok := f.str(key); ok {
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "DEL":
+		var n int
+		for _, key := range args[1:] {
+			if _, ok := f.sets[key]; ok {
+				n++
+			}
+			if _, ok := f.strs[key]; ok {
+				n++
+			}
+			delete(f.sets, key)
+			delete(f.strs, key)
+			delete(f.expires, key)
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "PUBLISH":
+		f.published = append(f.published, published{channel: args[1], payload: args[2]})
+		var n int
+		for sub, patterns := range f.subs {
+			for _, pattern := range patterns {
+				if strings.HasPrefix(args[1], strings.TrimSuffix(pattern, "*")) {
+					sub.queue <- array(bulk("pmessage"), bulk(pattern), bulk(args[1]), bulk(args[2]))
+					n++
+					break
+				}
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+// str returns the string at the key, when it hasn't expired
+func (f *fakeRedis) str(key string) (string, bool) {
+	if at, ok := f.expires[key]; ok && !time.Now().Before(at) {
+		delete(f.strs, key)
+		delete(f.expires, key)
+	}
+	str, ok := f.strs[key]
+	return str, ok
+}
+
+func bulk(str string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(str), str) }
+
+func array(items ...string) string {
+	return fmt.Sprintf("*%d\r\n", len(items)) + strings.Join(items, "")
+}
+
+// readCommand reads a command that is sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected argument %q", line)
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"net"
+	"time"
+)
+
+// WithPrefix sets the prefix of the Redis keys and the pub/sub channels, the default is
+// "socket.io", which is the same as the socket.io redis-adapter.
+func WithPrefix(prefix string) TransportOption {
+	return func(o TransportOptionWith) {
+		if v, ok := o.(*redisTransport); ok {
+			v.prefix = prefix
+		}
+	}
+}
+
+// WithDialer sets the function that opens the connections to Redis, in place of dialing
+// TCP to the address. It can be used to add TLS, or to connect to an in-process server.
+func WithDialer(dial func() (net.Conn, error)) TransportOption {
+	return func(o TransportOptionWith) {
+		if v, ok := o.(*redisTransport); ok {
+			v.dial = dial
+		}
+	}
+}
+
+// WithHeartbeat sets how often the server refreshes its heartbeat key in Redis, and how long
+// the key lasts. The sockets of a server that stops without closing its transport are
+// removed from Redis by the other servers once its key has expired. The defaults are five
+// and ten seconds.
+func WithHeartbeat(interval, timeout time.Duration) TransportOption {
+	return func(o TransportOptionWith) {
+		if v, ok := o.(*redisTransport); ok {
+			v.interval, v.timeout = interval, timeout
+		}
+	}
+}
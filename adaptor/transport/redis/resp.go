@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// respError is an error reply from the Redis server
+type respError string
+
+func (e respError) Error() string { return string(e) }
+
+// conn is a connection to a Redis server that speaks the RESP protocol, only the
+// commands that the transport needs are sent, so there is no command mapping.
+type conn struct {
+	net.Conn
+
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+}
+
+// writeCommand writes the command as an array of bulk strings
+func (c *conn) writeCommand(args ...string) error {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.w.Flush()
+}
+
+// readReply reads the next reply, which is a string, an int64, a []interface{}, nil or
+// a respError.
+func (c *conn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, ErrUnexpectedReply.F(line)
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, ErrUnexpectedReply.F(line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, ErrUnexpectedReply.F(line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2) // +2 is the CRLF
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, ErrUnexpectedReply.F(line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		rtn := make([]interface{}, n)
+		for i := range rtn {
+			if rtn[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return rtn, nil
+	}
+	return nil, ErrUnexpectedReply.F(line)
+}
+
+func (c *conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", ErrUnexpectedReply.F(line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// client sends the commands one at a time over a single connection, the connection is
+// dialed again after it fails.
+type client struct {
+	dial func() (net.Conn, error)
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// do sends the command and returns the reply, an error reply is returned as the error.
+func (c *client) do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		nc, err := c.dial()
+		if err != nil {
+			return nil, ErrDialFailed.F(err)
+		}
+		c.conn = newConn(nc)
+	}
+
+	reply, err := c.send(args...)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return nil, ErrCommandFailed.F(args[0], err)
+	}
+	if err, ok := reply.(respError); ok {
+		return nil, ErrCommandFailed.F(args[0], err)
+	}
+	return reply, nil
+}
+
+func (c *client) send(args ...string) (interface{}, error) {
+	if err := c.conn.writeCommand(args...); err != nil {
+		return nil, err
+	}
+	return c.conn.readReply()
+}
+
+func (c *client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// strings returns the reply of a command that replies with an array of strings
+func (c *client) strings(args ...string) ([]string, error) {
+	reply, err := c.do(args...)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := reply.([]interface{})
+	rtn := make([]string, 0, len(list))
+	for _, v := range list {
+		if str, ok := v.(string); ok {
+			rtn = append(rtn, str)
+		}
+	}
+	return rtn, nil
+}
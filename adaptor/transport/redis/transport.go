@@ -0,0 +1,763 @@
+// Package redis provides a transport that connects the SocketIO servers through Redis, so
+// that a socket that is connected to one server can be reached from all of them.
+
+package redis
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/njones/socketio/adaptor/transport/internal/local"
+	eiot "github.com/njones/socketio/engineio/transport"
+	"github.com/njones/socketio/internal/binary"
+	with "github.com/njones/socketio/internal/option"
+	siop "github.com/njones/socketio/protocol"
+	siot "github.com/njones/socketio/transport"
+	"github.com/vmihailenco/msgpack"
+)
+
+type (
+	SessionID = eiot.SessionID
+	SocketID  = siot.SocketID
+
+	Option = siop.Option
+	Socket = siot.Socket
+	Data   = siot.Data
+
+	Namespace = string
+	Room      = string
+
+	TransportOption     = with.Option
+	TransportOptionWith = with.OptionWith
+)
+
+// The request types of the socket.io redis-adapter, only the room operations and the
+// disconnects are sent
+const (
+	requestRemoteJoin       = 2
+	requestRemoteLeave      = 3
+	requestRemoteDisconnect = 4
+)
+
+// reconnectDelay is the longest wait between the attempts to subscribe again
+const reconnectDelay = 1 * time.Second
+
+// The default heartbeat of a server, a server that hasn't refreshed its heartbeat key within
+// the timeout is taken to be down, and its sockets are removed from Redis.
+const (
+	heartbeatInterval = 5 * time.Second
+	heartbeatTimeout  = 10 * time.Second
+)
+
+// redisPacket is a socket.io packet as it's published by the socket.io redis-adapter
+type redisPacket struct {
+	Type      byte        `msgpack:"type"`
+	Data      interface{} `msgpack:"data,omitempty"`
+	Namespace string      `msgpack:"nsp"`
+	AckID     uint64      `msgpack:"id,omitempty"`
+}
+
+// broadcastOptions are the rooms that a packet is sent to, without the sockets that are
+// in the except rooms. A socket is always in the room of its own socket id.
+type broadcastOptions struct {
+	Rooms  []Room                 `msgpack:"rooms" json:"rooms"`
+	Except []Room                 `msgpack:"except" json:"except"`
+	Flags  map[string]interface{} `msgpack:"flags,omitempty" json:"flags,omitempty"`
+}
+
+// broadcastMessage is published as a msgpack array of the server uid, the packet and
+// the options. A server skips the messages that it has published.
+type broadcastMessage struct {
+	_msgpack struct{} `msgpack:",asArray"` //lint:ignore U1000 msgpack option
+
+	UID    string
+	Packet redisPacket
+	Opts   broadcastOptions
+}
+
+// request is published as JSON on the request channel of the namespace. The room
+// operations use the opts and rooms fields, the sid and room fields are read from the
+// older versions of the redis-adapter.
+type request struct {
+	UID       string            `json:"uid"`
+	RequestID string            `json:"requestId,omitempty"`
+	Type      int               `json:"type"`
+	Opts      *broadcastOptions `json:"opts,omitempty"`
+	Rooms     []Room            `json:"rooms,omitempty"`
+	SID       SocketID          `json:"sid,omitempty"`
+	Room      Room              `json:"room,omitempty"`
+	Close     bool              `json:"close,omitempty"`
+}
+
+// redisTransport keeps the sockets that are connected to this server in the local registry,
+// and keeps the rooms and details of the sockets in Redis.
+// The packets for a socket on another server are published to Redis, and the server
+// with the socket sends them on.
+type redisTransport struct {
+	*local.Registry
+
+	uid    string // the id of this server in the published messages
+	prefix string // the prefix of the keys and the channels
+	dial   func() (net.Conn, error)
+
+	interval time.Duration // how often the heartbeat key of this server is refreshed
+	timeout  time.Duration // how long the heartbeat key lasts without being refreshed
+
+	cmd *client
+
+	// The function that disconnects the sockets of this server for the other servers
+	disconnect atomic.Value
+
+	ẋ   *sync.Mutex
+	sub *conn // the subscribed connection
+
+	done    chan struct{}
+	beating chan struct{} // closed once the heartbeat has stopped
+	once    sync.Once
+}
+
+// NewRedisTransport returns a transport that connects to the Redis server at the address.
+// Pass in the version that must be used for creating new packets based on the codec that
+// is being used, the same as the in-memory transport.
+func NewRedisTransport(addr string, fn siop.NewPacket, opts ...TransportOption) (*redisTransport, error) {
+	tr := &redisTransport{
+		Registry: local.NewRegistry(fn),
+		uid:      generateUID(),
+		prefix:   "socket.io",
+		dial:     func() (net.Conn, error) { return net.Dial("tcp", addr) },
+		interval: heartbeatInterval,
+		timeout:  heartbeatTimeout,
+		ẋ:        new(sync.Mutex),
+		done:     make(chan struct{}),
+		beating:  make(chan struct{}),
+	}
+	tr.With(opts...)
+	tr.cmd = &client{dial: tr.dial}
+
+	if _, err := tr.cmd.do("PING"); err != nil {
+		return nil, err
+	}
+	if err := tr.heartbeat(); err != nil {
+		return nil, err
+	}
+
+	sub, err := tr.subscribe()
+	if err != nil {
+		tr.cmd.close()
+		return nil, err
+	}
+	go tr.listen(sub)
+	go tr.beat()
+
+	return tr, nil
+}
+
+func (tr *redisTransport) With(opts ...TransportOption) {
+	for _, opt := range opts {
+		opt(tr)
+	}
+}
+
+// Close stops receiving the published packets, and removes the sockets of this server
+// from their rooms in Redis.
+func (tr *redisTransport) Close() error {
+	tr.once.Do(func() {
+		close(tr.done)
+		<-tr.beating
+
+		tr.ẋ.Lock()
+		tr.sub.Close()
+		tr.ẋ.Unlock()
+
+		for ns, sockets := range tr.LocalRooms("", "") {
+			for socketID, rooms := range sockets {
+				for _, room := range rooms {
+					tr.leave(ns, socketID, room)
+				}
+			}
+		}
+		tr.remove(tr.uid)
+		tr.cmd.close()
+	})
+	return nil
+}
+
+// Send sends the data to the socket when it's on this server, otherwise the packet is
+// published to Redis for the server that has the socket.
+func (tr *redisTransport) Send(socketID SocketID, data Data, opts ...Option) error {
+	switch {
+	case tr.SendLocal(socketID, data, opts...):
+		return nil
+	case tr.IsLocal(socketID):
+		return ErrSocketIDTransportNotFound.F(socketID.String())
+	}
+	return tr.publishTo(socketID, data, nil, opts)
+}
+
+// SendVolatile is the same as Send, except the data is dropped when the EngineIO
+// transport is not writable. Dropped data is counted, and is not an error.
+func (tr *redisTransport) SendVolatile(socketID SocketID, data Data, opts ...Option) error {
+	switch {
+	case tr.SendVolatileLocal(socketID, data, opts...):
+		return nil
+	case tr.IsLocal(socketID):
+		return ErrSocketIDTransportNotFound.F(socketID.String())
+	}
+	return tr.publishTo(socketID, data, map[string]interface{}{"volatile": true}, opts)
+}
+
+// Join adds the socket to the room. The room of a socket on another server is changed by
+// that server, so a request is published for it.
+func (tr *redisTransport) Join(ns Namespace, socketID SocketID, room Room) error {
+	if !tr.IsLocal(socketID) {
+		return tr.request(ns, requestRemoteJoin, socketID, room)
+	}
+	return tr.join(ns, socketID, room)
+}
+
+// Leave removes the socket from the room. The room of a socket on another server is
+// changed by that server, so a request is published for it.
+func (tr *redisTransport) Leave(ns Namespace, socketID SocketID, room Room) error {
+	if !tr.IsLocal(socketID) {
+		return tr.request(ns, requestRemoteLeave, socketID, room)
+	}
+	return tr.leave(ns, socketID, room)
+}
+
+func (tr *redisTransport) join(ns Namespace, socketID SocketID, room Room) error {
+	tr.JoinLocal(ns, socketID, room)
+
+	for _, args := range [][]string{
+		{"SADD", tr.nodeKey(tr.uid, "namespaces"), ns},
+		{"SADD", tr.key(ns, "node", tr.uid), socketID.String()},
+		{"SADD", tr.key(ns, "sockets"), socketID.String()},
+		{"SADD", tr.key(ns, "rooms", socketID.String()), room},
+		{"SADD", tr.key(ns, "room", room), socketID.String()},
+	} {
+		if _, err := tr.cmd.do(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tr *redisTransport) leave(ns Namespace, socketID SocketID, room Room) error {
+	ok, empty := tr.LeaveLocal(ns, socketID, room)
+	if !ok {
+		return nil
+	}
+
+	commands := [][]string{
+		{"SREM", tr.key(ns, "rooms", socketID.String()), room},
+		{"SREM", tr.key(ns, "room", room), socketID.String()},
+	}
+	if empty {
+		commands = append(commands,
+			[]string{"SREM", tr.key(ns, "sockets"), socketID.String()},
+			[]string{"SREM", tr.key(ns, "node", tr.uid), socketID.String()},
+			[]string{"DEL", tr.key(ns, "rooms", socketID.String()), tr.key(ns, "details", socketID.String())},
+		)
+	}
+	for _, args := range commands {
+		if _, err := tr.cmd.do(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDetails keeps the details of the socket in the namespace in Redis, so that they can
+// be read from every server.
+func (tr *redisTransport) SetDetails(ns Namespace, socketID SocketID, details siot.SocketDetails) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return ErrEncodeFailed.F("details", err)
+	}
+	_, err = tr.cmd.do("SET", tr.key(ns, "details", socketID.String()), string(b))
+	return err
+}
+
+// Details returns the details of the socket in the namespace
+func (tr *redisTransport) Details(ns Namespace, socketID SocketID) (siot.SocketDetails, error) {
+	reply, err := tr.cmd.do("GET", tr.key(ns, "details", socketID.String()))
+	if err != nil {
+		return siot.SocketDetails{}, err
+	}
+
+	str, ok := reply.(string)
+	if !ok {
+		return siot.SocketDetails{}, ErrSocketIDDetailsNotFound.F(socketID.String())
+	}
+
+	var details siot.SocketDetails
+	if err := json.Unmarshal([]byte(str), &details); err != nil {
+		return siot.SocketDetails{}, ErrSocketIDDetailsNotFound.F(socketID.String())
+	}
+	return details, nil
+}
+
+// Sockets returns the sockets in the namespace from every server. The members of a room
+// are read from Redis once for each returned array, an error reading from Redis is
+// returned by the Err method of the array.
+func (tr *redisTransport) Sockets(namespace Namespace) siot.SocketArray {
+	ids, err := tr.cmd.strings("SMEMBERS", tr.key(namespace, "sockets"))
+	sort.Strings(ids)
+
+	socketIDs := make([]SocketID, len(ids))
+	for i, id := range ids {
+		socketIDs[i] = SocketID(id)
+	}
+
+	var ṙ sync.Mutex
+	var members = make(map[Room]map[SocketID]struct{})
+
+	return siot.InitSocketArray(namespace, socketIDs, siot.WithSocketError(err), siot.WithSocketRoomFilter(
+		func(ns Namespace, rm Room, id SocketID) (bool, error) {
+			ṙ.Lock()
+			defer ṙ.Unlock()
+
+			if _, ok := members[rm]; !ok {
+				ids, err := tr.cmd.strings("SMEMBERS", tr.key(ns, "room", rm))
+				if err != nil {
+					return false, err
+				}
+				members[rm] = make(map[SocketID]struct{}, len(ids))
+				for _, id := range ids {
+					members[rm][SocketID(id)] = struct{}{}
+				}
+			}
+			_, ok := members[rm][id]
+			return ok, nil
+		},
+	))
+}
+
+// Rooms returns the rooms of the socket in the namespace, from any of the servers
+func (tr *redisTransport) Rooms(namespace Namespace, socketID SocketID) siot.RoomArray {
+	names, _ := tr.cmd.strings("SMEMBERS", tr.key(namespace, "rooms", socketID.String()))
+	sort.Strings(names)
+	return siot.RoomArray{Rooms: names}
+}
+
+func (tr *redisTransport) key(ns Namespace, parts ...string) string {
+	return strings.Join(append([]string{tr.prefix, ns}, parts...), "#")
+}
+
+// nodeKey is the key of a server, the heartbeat key when there are no parts
+func (tr *redisTransport) nodeKey(uid string, parts ...string) string {
+	return strings.Join(append([]string{tr.prefix, "node", uid}, parts...), "#")
+}
+
+// heartbeat refreshes the heartbeat key of this server, and adds it to the servers
+func (tr *redisTransport) heartbeat() error {
+	ttl := strconv.FormatInt(tr.timeout.Milliseconds(), 10)
+	if _, err := tr.cmd.do("SET", tr.nodeKey(tr.uid), "1", "PX", ttl); err != nil {
+		return err
+	}
+	_, err := tr.cmd.do("SADD", tr.prefix+"#nodes", tr.uid)
+	return err
+}
+
+// beat refreshes the heartbeat until the transport is closed, and removes the sockets of
+// the servers that have stopped without closing their transport.
+func (tr *redisTransport) beat() {
+	defer close(tr.beating)
+
+	ticker := time.NewTicker(tr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tr.done:
+			return
+		case <-ticker.C:
+		}
+		if tr.heartbeat() == nil {
+			tr.reap()
+		}
+	}
+}
+
+// reap removes the sockets of the servers whose heartbeat key has expired
+func (tr *redisTransport) reap() {
+	uids, err := tr.cmd.strings("SMEMBERS", tr.prefix+"#nodes")
+	if err != nil {
+		return
+	}
+	for _, uid := range uids {
+		if uid == tr.uid {
+			continue
+		}
+		if n, err := tr.cmd.do("EXISTS", tr.nodeKey(uid)); err != nil || n != int64(0) {
+			continue
+		}
+		tr.remove(uid)
+	}
+}
+
+// remove takes the sockets of the server out of their rooms, then removes the server
+func (tr *redisTransport) remove(uid string) error {
+	namespaces, err := tr.cmd.strings("SMEMBERS", tr.nodeKey(uid, "namespaces"))
+	if err != nil {
+		return err
+	}
+
+	for _, ns := range namespaces {
+		ids, err := tr.cmd.strings("SMEMBERS", tr.key(ns, "node", uid))
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			rooms, err := tr.cmd.strings("SMEMBERS", tr.key(ns, "rooms", id))
+			if err != nil {
+				return err
+			}
+			commands := [][]string{
+				{"SREM", tr.key(ns, "sockets"), id},
+				{"DEL", tr.key(ns, "rooms", id), tr.key(ns, "details", id)},
+			}
+			for _, room := range rooms {
+				commands = append(commands, []string{"SREM", tr.key(ns, "room", room), id})
+			}
+			for _, args := range commands {
+				if _, err := tr.cmd.do(args...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, args := range [][]string{
+		{"DEL", tr.nodeKey(uid), tr.nodeKey(uid, "namespaces")},
+		{"SREM", tr.prefix + "#nodes", uid},
+	} {
+		if _, err := tr.cmd.do(args...); err != nil {
+			return err
+		}
+	}
+	for _, ns := range namespaces {
+		if _, err := tr.cmd.do("DEL", tr.key(ns, "node", uid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Broadcast sends the data to the sockets of this server that the options are for, and
+// publishes it once for the other servers. The channel is the one the socket.io
+// redis-adapter uses, with the room when there is a single room.
+func (tr *redisTransport) Broadcast(bopts siot.BroadcastOptions, data Data, opts ...Option) error {
+	var flags map[string]interface{}
+	if bopts.Volatile {
+		flags = map[string]interface{}{"volatile": true}
+	}
+
+	ns, payload, err := tr.encode(data, broadcastOptions{Rooms: bopts.Rooms, Except: bopts.Except, Flags: flags}, opts)
+	if err != nil {
+		return err
+	}
+
+	tr.deliver(payload)
+	return tr.publish(ns, bopts.Rooms, payload)
+}
+
+// encode returns the namespace and the packet as it's published by the socket.io
+// redis-adapter, for the rooms of the options.
+func (tr *redisTransport) encode(data Data, bopts broadcastOptions, opts []Option) (Namespace, []byte, error) {
+	pac := tr.NewPacket().WithOption(opts...).(interface {
+		GetType() byte
+		GetNamespace() string
+		GetAckID() uint64
+	})
+
+	ns := pac.GetNamespace()
+	if ns == "" {
+		ns = "/"
+	}
+
+	d, err := siop.ToMsgpack(data)
+	if err != nil {
+		return "", nil, ErrEncodeFailed.F("broadcast", err)
+	}
+
+	// the binary data is sent in place, so the binary packet types are not used
+	_type := pac.GetType()
+	switch _type {
+	case siop.BinaryEventPacket.Byte():
+		_type = siop.EventPacket.Byte()
+	case siop.BinaryAckPacket.Byte():
+		_type = siop.AckPacket.Byte()
+	}
+
+	// the redis-adapter expects arrays for the rooms, not nil
+	if bopts.Rooms == nil {
+		bopts.Rooms = []Room{}
+	}
+	if bopts.Except == nil {
+		bopts.Except = []Room{}
+	}
+
+	msg := broadcastMessage{
+		UID:    tr.uid,
+		Packet: redisPacket{Type: _type, Data: d, Namespace: ns, AckID: pac.GetAckID()},
+		Opts:   bopts,
+	}
+
+	var buf = new(bytes.Buffer)
+	if err := msgpack.NewEncoder(buf).SortMapKeys(true).UseCompactEncoding(true).Encode(msg); err != nil {
+		return "", nil, ErrEncodeFailed.F("broadcast", err)
+	}
+	return ns, buf.Bytes(), nil
+}
+
+// publish sends the encoded packet on the broadcast channel of the namespace, or of the
+// room when there is a single room.
+func (tr *redisTransport) publish(ns Namespace, rooms []Room, payload []byte) error {
+	channel := tr.prefix + "#" + ns + "#"
+	if len(rooms) == 1 {
+		channel += rooms[0] + "#"
+	}
+	_, err := tr.cmd.do("PUBLISH", channel, string(payload))
+	return err
+}
+
+// publishTo publishes the packet for the socket on another server, to the room of the
+// socket id.
+func (tr *redisTransport) publishTo(socketID SocketID, data Data, flags map[string]interface{}, opts []Option) error {
+	ns, payload, err := tr.encode(data, broadcastOptions{Rooms: []Room{socketID.String()}, Flags: flags}, opts)
+	if err != nil {
+		return err
+	}
+	return tr.publish(ns, []Room{socketID.String()}, payload)
+}
+
+// request publishes the room operation for the socket on the request channel
+func (tr *redisTransport) request(ns Namespace, _type int, socketID SocketID, room Room) error {
+	b, err := json.Marshal(request{
+		UID:       tr.uid,
+		RequestID: generateUID(),
+		Type:      _type,
+		Opts:      &broadcastOptions{Rooms: []Room{socketID.String()}, Except: []Room{}},
+		Rooms:     []Room{room},
+	})
+	if err != nil {
+		return ErrEncodeFailed.F("request", err)
+	}
+
+	_, err = tr.cmd.do("PUBLISH", tr.prefix+"-request#"+ns+"#", string(b))
+	return err
+}
+
+// subscribe opens a connection that's subscribed to the broadcast and request channels of
+// every namespace, it returns after Redis has confirmed the subscriptions.
+func (tr *redisTransport) subscribe() (*conn, error) {
+	nc, err := tr.dial()
+	if err != nil {
+		return nil, ErrDialFailed.F(err)
+	}
+
+	c := newConn(nc)
+	patterns := []string{tr.prefix + "#*", tr.prefix + "-request#*"}
+	if err := c.writeCommand(append([]string{"PSUBSCRIBE"}, patterns...)...); err != nil {
+		c.Close()
+		return nil, ErrCommandFailed.F("PSUBSCRIBE", err)
+	}
+	for range patterns {
+		reply, err := c.readReply()
+		if err == nil {
+			if e, ok := reply.(respError); ok {
+				err = e
+			}
+		}
+		if err != nil {
+			c.Close()
+			return nil, ErrCommandFailed.F("PSUBSCRIBE", err)
+		}
+	}
+
+	tr.ẋ.Lock()
+	tr.sub = c
+	tr.ẋ.Unlock()
+	return c, nil
+}
+
+// listen reads the published messages until the transport is closed, the connection is
+// subscribed again when it fails.
+func (tr *redisTransport) listen(c *conn) {
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			c.Close()
+			if c = tr.resubscribe(); c == nil {
+				return
+			}
+			continue
+		}
+
+		// a pattern message is ["pmessage", pattern, channel, payload]
+		if msg, ok := reply.([]interface{}); ok && len(msg) == 4 && msg[0] == "pmessage" {
+			channel, _ := msg[2].(string)
+			payload, _ := msg[3].(string)
+			tr.message(channel, []byte(payload))
+		}
+	}
+}
+
+// resubscribe subscribes again with a growing delay between the attempts, it returns nil
+// when the transport has been closed.
+func (tr *redisTransport) resubscribe() *conn {
+	for delay := 10 * time.Millisecond; ; delay *= 2 {
+		if delay > reconnectDelay {
+			delay = reconnectDelay
+		}
+		select {
+		case <-tr.done:
+			return nil
+		case <-time.After(delay):
+		}
+		if c, err := tr.subscribe(); err == nil {
+			return c
+		}
+	}
+}
+
+func (tr *redisTransport) message(channel string, payload []byte) {
+	requestPrefix := tr.prefix + "-request#"
+	if strings.HasPrefix(channel, requestPrefix) {
+		ns := strings.TrimSuffix(strings.TrimPrefix(channel, requestPrefix), "#")
+		tr.onRequest(ns, payload)
+		return
+	}
+	tr.onBroadcast(payload)
+}
+
+// onBroadcast sends the packet that another server published to the sockets of this
+// server that it's for
+func (tr *redisTransport) onBroadcast(payload []byte) {
+	var msg broadcastMessage
+	if err := decodeBroadcast(payload, &msg); err != nil || msg.UID == tr.uid {
+		return
+	}
+	tr.deliver(payload)
+}
+
+// deliver sends the encoded packet to the sockets of this server that it's for
+func (tr *redisTransport) deliver(payload []byte) {
+	var msg broadcastMessage
+	if err := decodeBroadcast(payload, &msg); err != nil {
+		return
+	}
+
+	ns := msg.Packet.Namespace
+	if ns == "" {
+		ns = "/"
+	}
+	volatile, _ := msg.Opts.Flags["volatile"].(bool)
+
+	tr.Deliver(ns, msg.Opts.Rooms, msg.Opts.Except, volatile, func() (Data, []Option, error) {
+		// each socket is sent its own copy of the data, binary data can only be read once
+		var cp broadcastMessage
+		if err := decodeBroadcast(payload, &cp); err != nil {
+			return nil, nil, err
+		}
+		data := siop.FromMsgpack(cp.Packet.Data)
+
+		_type := cp.Packet.Type
+		if binary.Has(data) {
+			switch _type {
+			case siop.EventPacket.Byte():
+				_type = siop.BinaryEventPacket.Byte()
+			case siop.AckPacket.Byte():
+				_type = siop.BinaryAckPacket.Byte()
+			}
+		}
+
+		opts := []Option{siop.WithType(_type), siop.WithNamespace(ns)}
+		if cp.Packet.AckID > 0 {
+			opts = append(opts, siop.WithAckID(cp.Packet.AckID))
+		}
+		return data, opts, nil
+	})
+}
+
+// DisconnectRemote publishes the request for the server with the socket to disconnect it
+// from the namespace. It returns false when the socket is on this server.
+func (tr *redisTransport) DisconnectRemote(ns Namespace, socketID SocketID, close bool) (bool, error) {
+	if tr.IsLocal(socketID) {
+		return false, nil
+	}
+
+	b, err := json.Marshal(request{
+		UID:       tr.uid,
+		RequestID: generateUID(),
+		Type:      requestRemoteDisconnect,
+		Opts:      &broadcastOptions{Rooms: []Room{socketID.String()}, Except: []Room{}},
+		Close:     close,
+	})
+	if err != nil {
+		return true, ErrEncodeFailed.F("request", err)
+	}
+
+	_, err = tr.cmd.do("PUBLISH", tr.prefix+"-request#"+ns+"#", string(b))
+	return true, err
+}
+
+// OnRemoteDisconnect sets the function that disconnects the sockets of this server, when
+// the other servers ask for it
+func (tr *redisTransport) OnRemoteDisconnect(disconnect func(Namespace, SocketID, bool) error) {
+	tr.disconnect.Store(disconnect)
+}
+
+// onRequest does the room operations and the disconnects for the sockets of this server,
+// the other requests of the socket.io redis-adapter are not answered.
+func (tr *redisTransport) onRequest(ns Namespace, payload []byte) {
+	var req request
+	if err := json.Unmarshal(payload, &req); err != nil || req.UID == tr.uid {
+		return
+	}
+
+	var opts broadcastOptions
+	switch {
+	case req.SID != "":
+		opts.Rooms, req.Rooms = []Room{req.SID.String()}, []Room{req.Room}
+	case req.Opts != nil:
+		opts = *req.Opts
+	}
+
+	for _, socketID := range tr.Local(ns, opts.Rooms, opts.Except) {
+		if req.Type == requestRemoteDisconnect {
+			if disconnect, ok := tr.disconnect.Load().(func(Namespace, SocketID, bool) error); ok {
+				go disconnect(ns, socketID, req.Close) // the callbacks can publish of their own
+			}
+			continue
+		}
+		for _, room := range req.Rooms {
+			switch req.Type {
+			case requestRemoteJoin:
+				tr.join(ns, socketID, room)
+			case requestRemoteLeave:
+				tr.leave(ns, socketID, room)
+			}
+		}
+	}
+}
+
+func decodeBroadcast(payload []byte, msg *broadcastMessage) error {
+	return msgpack.NewDecoder(bytes.NewReader(payload)).UseDecodeInterfaceLoose(true).Decode(msg)
+}
+
+// generateUID returns a random id, the same length as the ids of the redis-adapter
+func generateUID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
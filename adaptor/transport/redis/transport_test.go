@@ -0,0 +1,271 @@
+package redis_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	sio "github.com/njones/socketio"
+	tred "github.com/njones/socketio/adaptor/transport/redis"
+	"github.com/njones/socketio/callback"
+	"github.com/njones/socketio/client"
+	"github.com/njones/socketio/engineio"
+	eiot "github.com/njones/socketio/engineio/transport"
+	siop "github.com/njones/socketio/protocol"
+	ser "github.com/njones/socketio/serialize"
+	siot "github.com/njones/socketio/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack"
+)
+
+var testingOptions = []sio.Option{
+	engineio.WithPingTimeout(1 * time.Second),
+	engineio.WithPingInterval(500 * time.Millisecond),
+}
+
+// receive returns the value from the channel, or fails the test after a few seconds
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	return ""
+}
+
+func TestRedisTransportPublish(t *testing.T) {
+	fake := newFakeRedis()
+
+	tr, err := tred.NewRedisTransport("", siop.NewPacketV5, tred.WithDialer(fake.Dial), tred.WithPrefix("app"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer tr.Close()
+
+	err = tr.Send("abc", []interface{}{"hello", "world"}, siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/chat"))
+	assert.NoError(t, err)
+
+	if msgs := fake.Published("app#/chat#abc#"); assert.Len(t, msgs, 1) {
+		var msg []interface{}
+		err := msgpack.NewDecoder(bytes.NewReader([]byte(msgs[0]))).UseDecodeInterfaceLoose(true).Decode(&msg)
+		if assert.NoError(t, err) && assert.Len(t, msg, 3) {
+			assert.NotEmpty(t, msg[0])
+			assert.Equal(t, map[string]interface{}{"type": int64(2), "data": []interface{}{"hello", "world"}, "nsp": "/chat"}, msg[1])
+			assert.Equal(t, map[string]interface{}{"rooms": []interface{}{"abc"}, "except": []interface{}{}}, msg[2])
+		}
+	}
+
+	// a broadcast is published once, with the rooms for the other servers to send it to
+	bopts := siot.BroadcastOptions{Rooms: []string{"lobby", "game"}, Except: []string{"abc"}}
+	err = tr.Broadcast(bopts, []interface{}{"hello", "rooms"}, siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/chat"))
+	assert.NoError(t, err)
+
+	if msgs := fake.Published("app#/chat#"); assert.Len(t, msgs, 1) {
+		var msg []interface{}
+		err := msgpack.NewDecoder(bytes.NewReader([]byte(msgs[0]))).UseDecodeInterfaceLoose(true).Decode(&msg)
+		if assert.NoError(t, err) && assert.Len(t, msg, 3) {
+			assert.Equal(t, map[string]interface{}{"type": int64(2), "data": []interface{}{"hello", "rooms"}, "nsp": "/chat"}, msg[1])
+			assert.Equal(t, map[string]interface{}{"rooms": []interface{}{"lobby", "game"}, "except": []interface{}{"abc"}}, msg[2])
+		}
+	}
+
+	err = tr.Broadcast(siot.BroadcastOptions{Rooms: []string{"lobby"}}, []interface{}{"hello"}, siop.WithType(siop.EventPacket.Byte()), siop.WithNamespace("/chat"))
+	assert.NoError(t, err)
+	assert.Len(t, fake.Published("app#/chat#lobby#"), 1)
+
+	assert.NoError(t, tr.Join("/chat", "abc", "lobby"))
+
+	if msgs := fake.Published("app-request#/chat#"); assert.Len(t, msgs, 1) {
+		var req map[string]interface{}
+		if assert.NoError(t, json.Unmarshal([]byte(msgs[0]), &req)) {
+			assert.Equal(t, float64(2), req["type"])
+			assert.Equal(t, map[string]interface{}{"rooms": []interface{}{"abc"}, "except": []interface{}{}}, req["opts"])
+			assert.Equal(t, []interface{}{"lobby"}, req["rooms"])
+		}
+	}
+
+	// a socket on another server is not added to a room in redis by this server
+	assert.Empty(t, fake.Members("app#/chat#room#lobby"))
+}
+
+func TestRedisTransportServers(t *testing.T) {
+	fake := newFakeRedis()
+
+	type node struct {
+		server *sio.ServerV4
+		events chan string
+		ids    chan sio.SocketID
+	}
+
+	nodes := make([]node, 2)
+	for i := range nodes {
+		tr, err := tred.NewRedisTransport("", siop.NewPacketV5, tred.WithDialer(fake.Dial))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer tr.Close()
+
+		n := node{
+			server: sio.NewServerV4(append(testingOptions, sio.WithAdaptor(tr))...),
+			events: make(chan string, 10),
+			ids:    make(chan sio.SocketID, 1),
+		}
+		n.server.OnConnect(func(socket *sio.SocketV4) error {
+			socket.Data().Set("node", float64(i))
+			socket.OnDisconnectReason(func(reason sio.DisconnectReason) {
+				select {
+				case n.events <- "disconnect: " + reason.String():
+				default:
+				}
+			})
+			n.ids <- socket.ID()
+			return nil
+		})
+		nodes[i] = n
+
+		server := httptest.NewServer(n.server)
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		c, err := client.Dial(ctx, server.URL, client.WithUpgrade(false))
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer c.Close()
+
+		socket := c.Socket("/")
+		socket.On("news", callback.FuncString(func(msg string) { n.events <- msg }))
+		if !assert.NoError(t, socket.Connect(ctx)) {
+			return
+		}
+	}
+
+	var ids = []sio.SocketID{<-nodes[0].ids, <-nodes[1].ids}
+
+	// a broadcast from one server reaches the clients of both servers
+	assert.NoError(t, nodes[0].server.Emit("news", ser.String("everyone")))
+	assert.Equal(t, "everyone", receive(t, nodes[0].events))
+	assert.Equal(t, "everyone", receive(t, nodes[1].events))
+	assert.Len(t, fake.Published("socket.io#/#"), 1)
+
+	// the sockets of both servers are fetched, with their details
+	sockets, err := nodes[0].server.FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 2) {
+		var got = map[sio.SocketID]interface{}{}
+		for _, socket := range sockets {
+			got[socket.ID()], _ = socket.Data().Get("node")
+		}
+		assert.Equal(t, map[sio.SocketID]interface{}{ids[0]: float64(0), ids[1]: float64(1)}, got)
+	}
+
+	// the socket on the second server joins a room from the first server
+	sockets, err = nodes[0].server.In(ids[1].String()).FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 1) {
+		assert.NoError(t, sockets[0].Join("game"))
+	}
+	assert.Eventually(t, func() bool {
+		sockets, err := nodes[0].server.In("game").FetchSockets()
+		return err == nil && len(sockets) == 1 && sockets[0].ID() == ids[1]
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sockets, err = nodes[1].server.In(ids[1].String()).FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 1) {
+		assert.ElementsMatch(t, []string{"game", ids[1].String()}, sockets[0].Rooms())
+	}
+
+	// a room broadcast only reaches the socket in the room
+	assert.NoError(t, nodes[0].server.To("game").Emit("news", ser.String("players")))
+	assert.Equal(t, "players", receive(t, nodes[1].events))
+	assert.Len(t, fake.Published("socket.io#/#game#"), 1)
+	select {
+	case msg := <-nodes[0].events:
+		t.Errorf("unexpected broadcast %q", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// a socket on the other server is disconnected by that server
+	sockets, err = nodes[0].server.In(ids[1].String()).FetchSockets()
+	if assert.NoError(t, err) && assert.Len(t, sockets, 1) {
+		assert.NoError(t, sockets[0].Disconnect(false))
+	}
+	assert.Equal(t, "disconnect: server namespace disconnect", receive(t, nodes[1].events))
+	assert.Eventually(t, func() bool {
+		sockets, err := nodes[0].server.FetchSockets()
+		return err == nil && len(sockets) == 1 && sockets[0].ID() == ids[0]
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// crashDialer dials the fake server until it crashes, then it closes the connections and
+// fails to dial, like a server that stopped without closing its transport.
+type crashDialer struct {
+	mu      sync.Mutex
+	fake    *fakeRedis
+	conns   []net.Conn
+	crashed bool
+}
+
+func (d *crashDialer) Dial() (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.crashed {
+		return nil, errors.New("crashed")
+	}
+	c, err := d.fake.Dial()
+	if err == nil {
+		d.conns = append(d.conns, c)
+	}
+	return c, err
+}
+
+func (d *crashDialer) Crash() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.crashed = true
+	for _, c := range d.conns {
+		c.Close()
+	}
+}
+
+func TestRedisTransportReap(t *testing.T) {
+	fake := newFakeRedis()
+	dialer := &crashDialer{fake: fake}
+
+	down, err := tred.NewRedisTransport("", siop.NewPacketV5, tred.WithDialer(dialer.Dial), tred.WithHeartbeat(10*time.Millisecond, 50*time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	up, err := tred.NewRedisTransport("", siop.NewPacketV5, tred.WithDialer(fake.Dial), tred.WithHeartbeat(10*time.Millisecond, 50*time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer up.Close()
+
+	socketID, err := down.Add(eiot.NewPollingTransport(10)("abc", eiot.Codec{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, down.Join("/", socketID, "lobby"))
+	assert.Equal(t, []sio.SocketID{socketID}, up.Sockets("/").IDs())
+
+	// the sockets stay while the server is up
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []sio.SocketID{socketID}, up.Sockets("/").IDs())
+
+	dialer.Crash()
+	assert.Eventually(t, func() bool {
+		return len(up.Sockets("/").IDs()) == 0 && len(fake.Members("socket.io#/#room#lobby")) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
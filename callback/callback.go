@@ -99,6 +99,8 @@ func (fn Wrap) Callback(data ...interface{}) (err error) {
 
 		var v string
 		switch data[i].(type) {
+		case nil:
+			in[i] = reflect.Zero(f.Type().In(i))
 		case error:
 			in[i] = reflect.ValueOf(data[i].(error))
 		case io.Reader:
@@ -205,3 +205,86 @@ func ExampleCustomWrapMap() {
 	// Error: invalid character 'o' in literal null (expecting 'u')
 	// Error: no key found
 }
+
+type ChatMessage struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+}
+
+func ExampleFunc() {
+
+	// The JSON arguments of an event are decoded into the parameter types
+
+	err := eventCallback(map[string]interface{}{"from": "Tink", "text": "Hi!"}, "lagoon")(
+		Func(func(msg ChatMessage, room string) error {
+			fmt.Printf("%s in %s: %s\n", msg.From, room, msg.Text)
+			return nil
+		}),
+	)
+	fmt.Println("Error:", err)
+
+	// The non-error return value is the acknowledgement reply
+
+	reply, err := Func(func(id int, attachment io.Reader) (ChatMessage, error) {
+		text, err := io.ReadAll(attachment)
+		return ChatMessage{From: fmt.Sprintf("Lost Boy #%d", id), Text: string(text)}, err
+	}).CallbackAckErr(float64(6), strings.NewReader("Tootles"))
+	fmt.Printf("Reply: %+v %v\n", reply, err)
+
+	// The arguments that can not be converted are an error
+
+	err = eventCallback("six")(Func(func(id int) error { return nil }))
+	fmt.Println("Error:", err)
+
+	// Output:
+	// Tink in lagoon: Hi!
+	// Error: <nil>
+	// Reply: [{From:Lost Boy #6 Text:Tootles}] <nil>
+	// Error: cannot convert callback parameter 0 to int: json: cannot unmarshal string into Go value of type int
+}
+
+type Photo struct {
+	Name  string    `json:"name"`
+	Image []byte    `json:"image"`
+	Thumb io.Reader `json:"thumb"`
+}
+
+func ExampleFunc_binary() {
+
+	// Binary data is passed as is to an interface{} parameter
+
+	err := eventCallback(strings.NewReader("raw"))(
+		Func(func(v interface{}) error {
+			b, err := io.ReadAll(v.(io.Reader))
+			fmt.Println("Raw:", string(b))
+			return err
+		}),
+	)
+	fmt.Println("Error:", err)
+
+	// Binary data inside of the arguments ends up in the io.Reader and []byte values
+
+	photo := map[string]interface{}{"name": "wendy.png", "image": strings.NewReader("\x89PNG"), "thumb": strings.NewReader("tiny")}
+	err = eventCallback(photo, []interface{}{strings.NewReader("one"), strings.NewReader("two")})(
+		Func(func(p Photo, pages [][]byte) error {
+			thumb, err := io.ReadAll(p.Thumb)
+			fmt.Printf("Photo: %s %q %q\n", p.Name, p.Image, thumb)
+			fmt.Printf("Pages: %q\n", pages)
+			return err
+		}),
+	)
+	fmt.Println("Error:", err)
+
+	// Binary data that has nowhere to go is an error, instead of being thrown away
+
+	err = eventCallback(map[string]interface{}{"name": strings.NewReader("?")})(Func(func(p Photo) error { return nil }))
+	fmt.Println("Error:", err)
+
+	// Output:
+	// Raw: raw
+	// Error: <nil>
+	// Photo: wendy.png "\x89PNG" "tiny"
+	// Pages: ["one" "two"]
+	// Error: <nil>
+	// Error: cannot convert callback parameter 0 to callback.Photo: expected an io.Reader or []byte parameter for binary data
+}
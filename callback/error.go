@@ -12,4 +12,9 @@ const (
 	ErrUnexpectedSingleOutParam erro.StringF = "expected a single error return parameter, found %d return parameters"
 	ErrInterfaceNotFound        erro.String  = "interface not found for serialize"
 	ErrUnknownPanic             erro.State   = "unknown panic"
+	ErrFuncNotAFunction         erro.StringF = "expected a function, found %T"
+	ErrFuncVariadic             erro.StringF = "expected a function without variadic parameters, found %v"
+	ErrFuncReturnParams         erro.StringF = "expected no return parameters, an error, a value, or a value and an error, found %v"
+	ErrFuncConvertParam         erro.StringF = "cannot convert callback parameter %d to %v: %v"
+	ErrFuncBinaryParam          erro.String  = "expected an io.Reader or []byte parameter for binary data"
 )
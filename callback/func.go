@@ -0,0 +1,292 @@
+package callback
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+)
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// TypedFunc is an event callback for a function with typed parameters, it's returned from Func.
+type TypedFunc struct {
+	fn  reflect.Value
+	err error // the reason that the function can't be called
+}
+
+// Func wraps any function as an event callback, without a hand-written Callback method. The
+// event arguments are converted to the types of the function parameters: values that are
+// assignable are passed as is, binary attachments are passed to io.Reader or []byte parameters,
+// or fields and elements when they're inside of a map or slice, and everything else is decoded
+// from its JSON form, so structs can use json tags. The function
+// can return nothing, an error, a reply value, or a reply value and an error. A reply value is
+// sent back to the client when the event is acknowledged.
+//
+//	socket.On("chat", callback.Func(func(msg ChatMessage, room string) error { ... }))
+//	socket.On("lookup", callback.Func(func(id int) (Reply, error) { ... }))
+func Func(fn interface{}) TypedFunc {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func || f.IsNil() {
+		return TypedFunc{err: ErrFuncNotAFunction.F(fn)}
+	}
+
+	typ := f.Type()
+	if typ.IsVariadic() {
+		return TypedFunc{err: ErrFuncVariadic.F(typ)}
+	}
+
+	switch typ.NumOut() {
+	case 0, 1:
+	case 2:
+		if typ.Out(0) == errorType || typ.Out(1) != errorType {
+			return TypedFunc{err: ErrFuncReturnParams.F(typ)}
+		}
+	default:
+		return TypedFunc{err: ErrFuncReturnParams.F(typ)}
+	}
+
+	return TypedFunc{fn: f}
+}
+
+func (fn TypedFunc) Callback(data ...interface{}) error {
+	_, err := fn.CallbackAckErr(data...)
+	return err
+}
+
+func (fn TypedFunc) CallbackAck(data ...interface{}) []interface{} {
+	rtn, _ := fn.CallbackAckErr(data...)
+	return rtn
+}
+
+// CallbackAckErr calls the function with the data, and returns the reply value when there is
+// one. An error is returned when the data can't be converted, or the function returned one.
+func (fn TypedFunc) CallbackAckErr(data ...interface{}) (rtn []interface{}, err error) {
+	if fn.err != nil {
+		return nil, fn.err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case string:
+				err = errors.New(e)
+			case error:
+				err = e
+			default:
+				err = ErrUnknownPanic
+			}
+		}
+	}()
+
+	typ := fn.fn.Type()
+	if len(data) != typ.NumIn() {
+		return nil, ErrUnexpectedDataInParams.F(typ.NumIn(), len(data))
+	}
+
+	in := make([]reflect.Value, typ.NumIn())
+	for i := range in {
+		if in[i], err = convert(data[i], typ.In(i)); err != nil {
+			return nil, ErrFuncConvertParam.F(i, typ.In(i), err)
+		}
+	}
+
+	rtn = []interface{}{}
+	for _, out := range fn.fn.Call(in) {
+		if out.Type() == errorType {
+			if !out.IsNil() {
+				err = out.Interface().(error)
+			}
+			continue
+		}
+		val := out.Interface()
+		if x, ok := val.(interface{ Interface() interface{} }); ok {
+			val = x.Interface()
+		}
+		rtn = append(rtn, val)
+	}
+	return rtn, err
+}
+
+func (TypedFunc) Serialize() (string, error) { return "", ErrUnimplementedSerialize }
+func (TypedFunc) Unserialize(string) error   { return ErrUnimplementedUnserialize }
+
+// convert returns the data as a value of the typ, the data is decoded from JSON if it can't
+// be used directly. Data with binary attachments inside of it is walked instead, because the
+// attachments can't be decoded from JSON.
+func convert(data interface{}, typ reflect.Type) (reflect.Value, error) {
+	if data == nil {
+		return reflect.Zero(typ), nil
+	}
+
+	if val := reflect.ValueOf(data); val.Type().AssignableTo(typ) {
+		return val, nil
+	}
+
+	if r, ok := data.(io.Reader); ok {
+		if typ == bytesType {
+			b, err := io.ReadAll(r)
+			return reflect.ValueOf(b), err
+		}
+		return reflect.Value{}, ErrFuncBinaryParam
+	}
+
+	if hasReader(data) {
+		return convertBinary(data, typ)
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	ptr := reflect.New(typ)
+	if err := json.Unmarshal(b, ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr.Elem(), nil
+}
+
+// convertBinary returns the map or slice data that has binary attachments inside of it as a
+// value of the typ. Each of the values is converted on its own, so the attachments end up in
+// the io.Reader or []byte values of the typ.
+func convertBinary(data interface{}, typ reflect.Type) (reflect.Value, error) {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		elem, err := convert(data, typ.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+
+	switch data := data.(type) {
+	case []interface{}:
+		switch typ.Kind() {
+		case reflect.Slice:
+			val := reflect.MakeSlice(typ, len(data), len(data))
+			for i, v := range data {
+				elem, err := convert(v, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				val.Index(i).Set(elem)
+			}
+			return val, nil
+		case reflect.Array:
+			val := reflect.New(typ).Elem()
+			for i, v := range data {
+				if i >= typ.Len() {
+					break
+				}
+				elem, err := convert(v, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				val.Index(i).Set(elem)
+			}
+			return val, nil
+		}
+	case map[string]interface{}:
+		switch typ.Kind() {
+		case reflect.Map:
+			if typ.Key().Kind() != reflect.String {
+				break
+			}
+			val := reflect.MakeMapWithSize(typ, len(data))
+			for k, v := range data {
+				elem, err := convert(v, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				val.SetMapIndex(reflect.ValueOf(k).Convert(typ.Key()), elem)
+			}
+			return val, nil
+		case reflect.Struct:
+			val := reflect.New(typ).Elem()
+			for k, v := range data {
+				field, ok := jsonField(typ, k)
+				if !ok {
+					if hasReader(v) {
+						return reflect.Value{}, ErrFuncBinaryParam // there's no field for the binary data
+					}
+					continue
+				}
+				elem, err := convert(v, field.Type)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				val.FieldByIndex(field.Index).Set(elem)
+			}
+			return val, nil
+		}
+	}
+	return reflect.Value{}, ErrFuncBinaryParam
+}
+
+// jsonField returns the exported struct field that the JSON key is decoded to, matching the
+// json tag name first and then the field name without case, like encoding/json does.
+func jsonField(typ reflect.Type, key string) (reflect.StructField, bool) {
+	var fold *reflect.StructField
+	for _, field := range reflect.VisibleFields(typ) {
+		if !field.IsExported() || field.Anonymous || throughPointer(typ, field.Index) {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+		}
+		if name == key {
+			return field, true
+		}
+		if fold == nil && strings.EqualFold(name, key) {
+			field := field
+			fold = &field
+		}
+	}
+	if fold != nil {
+		return *fold, true
+	}
+	return reflect.StructField{}, false
+}
+
+// throughPointer is true when the field is promoted from an embedded struct pointer, which
+// would have to be allocated before the field can be set
+func throughPointer(typ reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		if typ = typ.Field(i).Type; typ.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
+// hasReader is true when there is a binary attachment anywhere in the data
+func hasReader(data interface{}) bool {
+	switch data := data.(type) {
+	case io.Reader:
+		return true
+	case []interface{}:
+		for _, v := range data {
+			if hasReader(v) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, v := range data {
+			if hasReader(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
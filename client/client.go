@@ -0,0 +1,401 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/njones/socketio/engineio"
+	eios "github.com/njones/socketio/engineio/session"
+	siop "github.com/njones/socketio/protocol"
+	siot "github.com/njones/socketio/transport"
+)
+
+// DisconnectReason is the reason that is passed to the OnDisconnect callbacks, they are
+// the same strings as the reasons of the JS client.
+type DisconnectReason string
+
+const (
+	ServerDisconnect DisconnectReason = "io server disconnect" // the server disconnected the socket
+	ClientDisconnect DisconnectReason = "io client disconnect" // the socket or the client was closed
+	PingTimeout      DisconnectReason = "ping timeout"         // the server didn't send anything in time
+	TransportClose   DisconnectReason = "transport close"      // the server closed the connection
+	TransportError   DisconnectReason = "transport error"      // the connection failed
+	ParseError       DisconnectReason = "parse error"          // the server sent data that couldn't be decoded
+)
+
+func (r DisconnectReason) String() string { return string(r) }
+
+// reconnectTimeout is how long a reconnection attempt can take, the same as the JS client
+const reconnectTimeout = 20 * time.Second
+
+// ackFunc receives the acknowledgement of an emit, or the error when the connection is
+// lost before the server acknowledged it.
+type ackFunc func([]interface{}, error)
+
+// ack is an ackFunc that's waiting for the server, with the namespace that it was sent to
+type ack struct {
+	namespace string
+	fn        ackFunc
+}
+
+// Client is a connection to a socket.io server, the namespaces are multiplexed over
+// the one engine.io session. The session is re-opened when it's lost, and the sockets
+// are connected to their namespaces again.
+type Client struct {
+	mu sync.Mutex
+
+	url      *url.URL
+	protocol Protocol
+	path     string
+	auth     map[string]interface{}
+
+	engine struct {
+		version    int
+		query      url.Values
+		header     http.Header
+		httpClient *http.Client
+		upgrade    bool
+	}
+	reconnect struct {
+		enabled  bool
+		attempts int
+		delay    time.Duration
+		maxDelay time.Duration
+	}
+
+	newPacket siop.NewPacket
+	eio       *engineio.Client
+	tr        *siot.Transport
+
+	sockets map[string]*Socket
+	acks    map[uint64]ack
+	ackID   uint64
+
+	closed bool
+	done   chan struct{}
+}
+
+// Dial opens a connection to the socket.io server at the url, the path of the url is
+// ignored in favor of the WithPath option. The sockets are connected to a namespace
+// with the Connect method.
+func Dial(ctx context.Context, rawurl string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, engineio.ErrInvalidURL.F(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, engineio.ErrInvalidURL.F(engineio.ErrUnsupportedScheme.F(u.Scheme))
+	}
+
+	c := &Client{
+		protocol: ProtocolV5,
+		path:     "/socket.io/",
+		sockets:  make(map[string]*Socket),
+		acks:     make(map[uint64]ack),
+		done:     make(chan struct{}),
+	}
+	c.engine.upgrade = true
+	c.reconnect.enabled = true
+	c.reconnect.delay, c.reconnect.maxDelay = 1*time.Second, 5*time.Second
+	c.With(opts...)
+
+	switch c.protocol {
+	case ProtocolV2:
+		c.engine.version, c.newPacket = 2, siop.NewPacketV2
+	case ProtocolV3:
+		c.engine.version, c.newPacket = 3, siop.NewPacketV3
+	case ProtocolV4:
+		c.engine.version, c.newPacket = 3, siop.NewPacketV4
+	case ProtocolV5:
+		c.engine.version, c.newPacket = 4, siop.NewPacketV5
+	default:
+		return nil, ErrUnsupportedProtocol.F(c.protocol)
+	}
+
+	if !strings.HasSuffix(c.path, "/") {
+		c.path += "/"
+	}
+	u.Path = c.path
+	if c.engine.query != nil {
+		q := u.Query()
+		for k, v := range c.engine.query {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+	}
+	c.url = u
+
+	if c.protocol < ProtocolV5 {
+		// the server connects the socket to the default namespace without asking
+		c.sockets["/"] = newSocket(c, "/")
+		c.sockets["/"].active = true
+	}
+
+	if err := c.open(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) With(opts ...Option) {
+	for _, opt := range opts {
+		opt(c)
+	}
+}
+
+// Socket returns the socket for the namespace, the same socket is returned for each
+// call with the same namespace. The socket isn't connected until its Connect method is
+// called, so the callbacks can be added first.
+func (c *Client) Socket(namespace string) *Socket {
+	if namespace == "" {
+		namespace = "/"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	socket, ok := c.sockets[namespace]
+	if !ok {
+		socket = newSocket(c, namespace)
+		c.sockets[namespace] = socket
+	}
+	return socket
+}
+
+// Connect connects the socket of the namespace, and waits until the server accepts or
+// rejects the connection. It's the same as calling Connect on the socket from the
+// Socket method.
+func (c *Client) Connect(ctx context.Context, namespace string) (*Socket, error) {
+	socket := c.Socket(namespace)
+	if err := socket.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return socket, nil
+}
+
+// Close disconnects all of the sockets and closes the engine.io session, the client
+// is not reconnected.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.closed = true
+	close(c.done)
+
+	tr := c.tr
+	for _, socket := range c.sockets {
+		if socket.connected {
+			c.send(nil, siop.WithType(siop.DisconnectPacket.Byte()), siop.WithNamespace(socket.namespace))
+		}
+		socket.active = false
+	}
+	c.mu.Unlock()
+
+	if tr != nil {
+		tr.Shutdown()
+	}
+	return nil
+}
+
+// open opens an engine.io session and starts receiving from it, the sockets that are
+// active are connected to their namespace.
+func (c *Client) open(ctx context.Context) error {
+	opts := []engineio.Option{
+		engineio.WithProtocolVersion(c.engine.version),
+		engineio.WithUpgrade(c.engine.upgrade),
+		engineio.WithHeader(c.engine.header),
+	}
+	if c.engine.httpClient != nil {
+		opts = append(opts, engineio.WithHTTPClient(c.engine.httpClient))
+	}
+
+	eio, err := engineio.Dial(ctx, c.url.String(), opts...)
+	if err != nil {
+		return err
+	}
+	tr := siot.NewTransport(siot.SocketID(eio.ID()), eio, c.newPacket)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		eio.Shutdown()
+		return ErrClientClosed
+	}
+	c.eio, c.tr = eio, tr
+	for _, socket := range c.sockets {
+		if c.protocol < ProtocolV5 && socket.namespace == "/" {
+			continue // the server connects the socket to the default namespace
+		}
+		if socket.active {
+			c.sendConnect(socket)
+		}
+	}
+	c.mu.Unlock()
+
+	go c.run(eio, tr)
+	return nil
+}
+
+// run receives the packets of the session until it ends, then the client reconnects.
+func (c *Client) run(eio *engineio.Client, tr *siot.Transport) {
+	for socket := range tr.Receive() {
+		c.dispatch(socket)
+		siop.CloseAttachments(socket.Data) // unread attachments would hold up the next packet
+	}
+
+	reason := disconnectReason(eio.Reason())
+
+	c.mu.Lock()
+	acks := c.acks
+	c.acks = make(map[uint64]ack)
+	var disconnected []*Socket
+	for _, socket := range c.sockets {
+		if socket.connected {
+			socket.connected = false
+			disconnected = append(disconnected, socket)
+		}
+	}
+	c.eio, c.tr = nil, nil
+	closed := c.closed
+	c.mu.Unlock()
+
+	for _, ack := range acks {
+		ack.fn(nil, ErrSocketDisconnected)
+	}
+	for _, socket := range disconnected {
+		socket.callDisconnect(reason)
+	}
+
+	if closed || !c.reconnect.enabled {
+		return
+	}
+	c.reconnecting()
+}
+
+// reconnecting opens a new session with a backoff between the attempts, until there is
+// a session, the attempts have run out or the client is closed.
+func (c *Client) reconnecting() {
+	for attempt := 1; c.reconnect.attempts == 0 || attempt <= c.reconnect.attempts; attempt++ {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.backoff(attempt)):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+		err := c.open(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+}
+
+// backoff is the delay before the reconnection attempt, it's doubled for each attempt
+// up to the max delay, with a random jitter of 50% either way.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.reconnect.delay
+	for i := 1; i < attempt && delay < c.reconnect.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.reconnect.maxDelay {
+		delay = c.reconnect.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// disconnectReason returns the reason of the engine.io session, a session that's closed
+// by the client is a client disconnect. The other reasons are the same strings.
+func disconnectReason(reason eios.CloseReason) DisconnectReason {
+	if reason == eios.ForcedClose {
+		return ClientDisconnect
+	}
+	return DisconnectReason(reason)
+}
+
+// dispatch passes the packet on to the socket of the namespace.
+func (c *Client) dispatch(packet siot.Socket) {
+	if packet.Namespace == "" {
+		packet.Namespace = "/"
+	}
+
+	switch packet.Type {
+	case siop.AckPacket.Byte(), siop.BinaryAckPacket.Byte():
+		c.mu.Lock()
+		ack, ok := c.acks[packet.AckID]
+		if ok && ack.namespace == packet.Namespace {
+			delete(c.acks, packet.AckID)
+		}
+		c.mu.Unlock()
+
+		if ok && ack.namespace == packet.Namespace {
+			ack.fn(dataArgs(packet.Data), nil)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	socket, ok := c.sockets[packet.Namespace]
+	c.mu.Unlock()
+
+	if ok {
+		socket.dispatch(packet)
+	}
+}
+
+// sendConnect sends the CONNECT packet for the socket, the auth is only sent with
+// ProtocolV5. It's called with the lock held.
+func (c *Client) sendConnect(socket *Socket) {
+	var data interface{}
+	if c.protocol == ProtocolV5 && c.auth != nil {
+		data = c.auth
+	}
+	c.send(data, siop.WithType(siop.ConnectPacket.Byte()), siop.WithNamespace(socket.namespace))
+}
+
+// send sends the data when there is a session, it's called with the lock held.
+func (c *Client) send(data interface{}, opts ...siop.Option) bool {
+	if c.tr == nil {
+		return false
+	}
+	c.tr.Send(data, opts...)
+	return true
+}
+
+// addAck keeps the ack function until the server sends the acknowledgement, it returns
+// the ack ID that is sent. It's called with the lock held.
+func (c *Client) addAck(namespace string, fn ackFunc) uint64 {
+	c.ackID++
+	c.acks[c.ackID] = ack{namespace: namespace, fn: fn}
+	return c.ackID
+}
+
+// removeAcks removes the ack functions of the namespace, and returns them so they can be
+// called with an error. It's called with the lock held.
+func (c *Client) removeAcks(namespace string) (fns []ackFunc) {
+	for id, ack := range c.acks {
+		if ack.namespace == namespace {
+			fns = append(fns, ack.fn)
+			delete(c.acks, id)
+		}
+	}
+	return fns
+}
+
+// engineID returns the engine.io session ID, it's called with the lock held.
+func (c *Client) engineID() string {
+	if c.eio == nil {
+		return ""
+	}
+	return c.eio.ID().String()
+}
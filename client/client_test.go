@@ -0,0 +1,280 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sio "github.com/njones/socketio"
+	"github.com/njones/socketio/callback"
+	"github.com/njones/socketio/client"
+	"github.com/njones/socketio/engineio"
+	"github.com/njones/socketio/serialize"
+	"github.com/stretchr/testify/assert"
+)
+
+var testingOptions = []sio.Option{
+	engineio.WithPingTimeout(1 * time.Second),
+	engineio.WithPingInterval(500 * time.Millisecond),
+}
+
+// receive returns the value from the channel, or fails the test after a few seconds
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	return ""
+}
+
+func TestClient(t *testing.T) {
+	for name, upgrade := range map[string]bool{"Polling": false, "Websocket": true} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				v4     = sio.NewServerV4(testingOptions...)
+				events = make(chan string, 10)
+			)
+
+			v4.OnConnect(func(socket *sio.SocketV4) error {
+				socket.On("hello", callback.Func(func(name string) (string, error) {
+					return "hi " + name, nil
+				}))
+				socket.On("ask", callback.FuncString(func(question string) {
+					// the ack is waited for inside of the event callback
+					ans, err := socket.EmitWithAck(context.Background(), "question", serialize.String(question))
+					if assert.NoError(t, err) && assert.Len(t, ans, 1) {
+						events <- ans[0].(string)
+					}
+				}))
+				return socket.Emit("file", serialize.String("photo.png"), serialize.Binary(strings.NewReader("\x89PNG")))
+			})
+
+			v4.Of("/admin").Use(func(socket *sio.SocketV4, next func(error)) {
+				if socket.Handshake().Auth()["token"] != "abc" {
+					next(&sio.ConnectError{Message: "not authorized", Data: map[string]interface{}{"retry": false}})
+					return
+				}
+				next(nil)
+			})
+			v4.Of("/admin").OnConnect(func(socket *sio.SocketV4) error { return nil })
+
+			server := httptest.NewServer(v4)
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, err := client.Dial(ctx, server.URL, client.WithUpgrade(upgrade), client.WithAuth(map[string]interface{}{"token": "xyz"}))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer c.Close()
+
+			socket := c.Socket("/")
+			socket.On("file", callback.FuncAny(func(data ...interface{}) error {
+				if assert.Len(t, data, 2) {
+					b, err := io.ReadAll(data[1].(io.Reader))
+					assert.NoError(t, err)
+					events <- data[0].(string) + ":" + string(b)
+				}
+				return nil
+			}))
+			socket.On("question", callback.Func(func(question string) (string, error) {
+				return question + " yes", nil
+			}))
+			if !assert.NoError(t, socket.Connect(ctx)) {
+				return
+			}
+
+			assert.NotEmpty(t, socket.ID())
+			assert.True(t, socket.Connected())
+			assert.Equal(t, "photo.png:\x89PNG", receive(t, events))
+
+			ans, err := socket.EmitWithAck(ctx, "hello", serialize.String("world"))
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"hi world"}, ans)
+
+			err = socket.Emit("hello", serialize.String("again"), callback.FuncString(func(ans string) { events <- ans }))
+			assert.NoError(t, err)
+			assert.Equal(t, "hi again", receive(t, events))
+
+			assert.NoError(t, socket.Emit("ask", serialize.String("ready?")))
+			assert.Equal(t, "ready? yes", receive(t, events))
+
+			_, err = c.Connect(ctx, "/admin")
+			var connectErr *client.ConnectError
+			if assert.True(t, errors.As(err, &connectErr)) {
+				assert.Equal(t, "not authorized", connectErr.Message)
+				assert.Equal(t, map[string]interface{}{"retry": false}, connectErr.Data)
+			}
+		})
+	}
+}
+
+func TestClientUnreadAttachments(t *testing.T) {
+	v4 := sio.NewServerV4(testingOptions...)
+	v4.OnConnect(func(socket *sio.SocketV4) error {
+		socket.On("second", callback.Func(func(first, second io.Reader) (string, error) {
+			// reading the second attachment throws away the first one
+			b, err := io.ReadAll(second)
+			return string(b), err
+		}))
+		return nil
+	})
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := client.Dial(ctx, server.URL, client.WithUpgrade(true))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	socket, err := c.Connect(ctx, "/")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// there isn't a callback to read the attachments, so they are closed after the event
+	assert.NoError(t, socket.Emit("nobody", serialize.Binary(strings.NewReader("unread"))))
+	assert.NoError(t, socket.Emit("nobody", serialize.Binary(strings.NewReader("unread")), serialize.Binary(strings.NewReader("again"))))
+
+	ans, err := socket.EmitWithAck(ctx, "second", serialize.Binary(strings.NewReader("one")), serialize.Binary(strings.NewReader("two")))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"two"}, ans)
+	assert.True(t, socket.Connected())
+}
+
+func TestClientReconnect(t *testing.T) {
+	var (
+		v4        = sio.NewServerV4(testingOptions...)
+		connected = make(chan string, 10)
+	)
+
+	v4.OnConnect(func(socket *sio.SocketV4) error {
+		socket.On("hello", callback.Func(func(name string) (string, error) {
+			return "hi " + name, nil
+		}))
+		connected <- string(socket.ID())
+		return nil
+	})
+
+	// the drop fails the next long-poll
+	var drop int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Query().Get("sid") != "" && atomic.CompareAndSwapInt32(&drop, 1, 0) {
+			http.Error(w, "dropped", http.StatusBadGateway)
+			return
+		}
+		v4.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := client.Dial(ctx, server.URL, client.WithUpgrade(false), client.WithReconnectionDelay(10*time.Millisecond, 50*time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	socket, err := c.Connect(ctx, "/")
+	if !assert.NoError(t, err) {
+		return
+	}
+	receive(t, connected)
+
+	var disconnected = make(chan string, 1)
+	socket.OnDisconnect(func(reason client.DisconnectReason) { disconnected <- reason.String() })
+
+	atomic.StoreInt32(&drop, 1)
+
+	assert.Equal(t, string(client.TransportError), receive(t, disconnected))
+	receive(t, connected)
+
+	ans, err := socket.EmitWithAck(ctx, "hello", serialize.String("again"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"hi again"}, ans)
+}
+
+func TestClientProtocols(t *testing.T) {
+	tests := map[string]struct {
+		protocol client.Protocol
+		server   func(onConnect func(on func(string, callback.TypedFunc))) http.Handler
+	}{
+		"ProtocolV2": {client.ProtocolV2, func(fn func(on func(string, callback.TypedFunc))) http.Handler {
+			v1 := sio.NewServerV1(testingOptions...)
+			v1.OnConnect(func(socket *sio.SocketV1) error {
+				fn(func(event string, cb callback.TypedFunc) { socket.On(event, cb) })
+				return nil
+			})
+			return v1
+		}},
+		"ProtocolV3": {client.ProtocolV3, func(fn func(on func(string, callback.TypedFunc))) http.Handler {
+			v2 := sio.NewServerV2(testingOptions...)
+			v2.OnConnect(func(socket *sio.SocketV2) error {
+				fn(func(event string, cb callback.TypedFunc) { socket.On(event, cb) })
+				return nil
+			})
+			return v2
+		}},
+		"ProtocolV4": {client.ProtocolV4, func(fn func(on func(string, callback.TypedFunc))) http.Handler {
+			v2 := sio.NewServerV2(testingOptions...)
+			v2.OnConnect(func(socket *sio.SocketV2) error {
+				fn(func(event string, cb callback.TypedFunc) { socket.On(event, cb) })
+				return nil
+			})
+			return v2
+		}},
+		"ProtocolV5": {client.ProtocolV5, func(fn func(on func(string, callback.TypedFunc))) http.Handler {
+			v4 := sio.NewServerV4(testingOptions...)
+			v4.OnConnect(func(socket *sio.SocketV4) error {
+				fn(func(event string, cb callback.TypedFunc) { socket.On(event, cb) })
+				return nil
+			})
+			return v4
+		}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(test.server(func(on func(string, callback.TypedFunc)) {
+				on("hello", callback.Func(func(name string) (string, error) { return "hi " + name, nil }))
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			c, err := client.Dial(ctx, server.URL, client.WithProtocol(test.protocol))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer c.Close()
+
+			socket, err := c.Connect(ctx, "/")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NotEmpty(t, socket.ID())
+
+			ans, err := socket.EmitWithAck(ctx, "hello", serialize.String("world"))
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"hi world"}, ans)
+		})
+	}
+}
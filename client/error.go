@@ -0,0 +1,18 @@
+package client
+
+import erro "github.com/njones/socketio/internal/errors"
+
+const (
+	ErrUnsupportedProtocol erro.StringF = "unsupported socket.io protocol version %d"
+	ErrClientClosed        erro.State   = "client: closed"
+	ErrSocketDisconnected  erro.State   = "socket: disconnected"
+)
+
+// ConnectError is the reason that the server rejected the connection to a namespace,
+// it's from the CONNECT_ERROR packet, or the ERROR packet of older protocol versions.
+type ConnectError struct {
+	Message string
+	Data    interface{}
+}
+
+func (e *ConnectError) Error() string { return e.Message }
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	with "github.com/njones/socketio/internal/option"
+)
+
+type Option = with.Option
+type OptionWith = with.OptionWith
+
+// Protocol is the socket.io protocol version that the client speaks, it decides the
+// packet encoding and the engine.io protocol version that's used.
+type Protocol int
+
+const (
+	ProtocolV2 Protocol = 2 // engine.io v2, works with socketio.NewServerV1
+	ProtocolV3 Protocol = 3 // engine.io v3, works with socketio.NewServerV2
+	ProtocolV4 Protocol = 4 // engine.io v3, works with socketio.NewServerV2
+	ProtocolV5 Protocol = 5 // engine.io v4, works with socketio.NewServerV4
+)
+
+// WithProtocol sets the socket.io protocol version, the default is ProtocolV5.
+func WithProtocol(protocol Protocol) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.protocol = protocol
+		}
+	}
+}
+
+// WithPath sets the path of the socket.io server, the default is "/socket.io/".
+func WithPath(path string) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.path = path
+		}
+	}
+}
+
+// WithAuth sets the auth payload that's sent with each namespace connection. This is
+// only sent with ProtocolV5, the older protocols can use WithQuery instead.
+func WithAuth(auth map[string]interface{}) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.auth = auth
+		}
+	}
+}
+
+// WithQuery adds the query values to each of the engine.io requests.
+func WithQuery(query url.Values) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.engine.query = query
+		}
+	}
+}
+
+// WithHeader adds the headers to each of the engine.io requests.
+func WithHeader(header http.Header) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.engine.header = header
+		}
+	}
+}
+
+// WithHTTPClient sets the HTTP client that's used for the polling requests and the
+// websocket handshake, the default is the http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.engine.httpClient = client
+		}
+	}
+}
+
+// WithUpgrade sets if the long-polling session is upgraded to a websocket when the
+// server allows it, the default is true.
+func WithUpgrade(upgrade bool) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.engine.upgrade = upgrade
+		}
+	}
+}
+
+// WithReconnection sets if the client reconnects after the connection is lost, the
+// default is true.
+func WithReconnection(reconnect bool) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.reconnect.enabled = reconnect
+		}
+	}
+}
+
+// WithReconnectionAttempts sets the number of reconnection attempts before giving up,
+// the default of zero keeps trying.
+func WithReconnectionAttempts(attempts int) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.reconnect.attempts = attempts
+		}
+	}
+}
+
+// WithReconnectionDelay sets the delay before the first reconnection attempt, which is
+// doubled for each attempt up to the max delay. The defaults are 1s and 5s, the same as
+// the JS client.
+func WithReconnectionDelay(delay, max time.Duration) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.reconnect.delay, v.reconnect.maxDelay = delay, max
+		}
+	}
+}
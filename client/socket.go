@@ -0,0 +1,402 @@
+package client
+
+import (
+	"context"
+
+	"github.com/njones/socketio/internal/binary"
+	siop "github.com/njones/socketio/protocol"
+	seri "github.com/njones/socketio/serialize"
+	siot "github.com/njones/socketio/transport"
+)
+
+// Callback is called with the data of an event, it's the same as the server callbacks
+// so the callback package can be used. A callback that also has the CallbackAck or
+// CallbackAckErr method sends its return values back as the acknowledgement.
+type Callback interface {
+	Callback(...interface{}) error
+}
+
+type callbackAck interface {
+	CallbackAck(...interface{}) []interface{}
+}
+
+type callbackAckErr interface {
+	CallbackAckErr(...interface{}) ([]interface{}, error)
+}
+
+// emitPacket is an event that's waiting to be sent, the ackID is set once it's sent
+type emitPacket struct {
+	binary bool
+	data   []interface{}
+	ack    ackFunc
+	ackID  uint64
+}
+
+// Socket is the connection to a namespace. The callbacks are called from the client's
+// receive loop, so a callback shouldn't block while waiting on another event or an
+// acknowledgement.
+type Socket struct {
+	client    *Client
+	namespace string
+
+	// guarded by the client lock
+	id        string
+	connected bool
+	active    bool // the socket should be connected, it's connected again after a reconnection
+	waits     []chan error
+	buffer    []*emitPacket
+
+	events         map[string][]Callback
+	onConnect      []func()
+	onDisconnect   []func(DisconnectReason)
+	onConnectError []func(error)
+}
+
+func newSocket(client *Client, namespace string) *Socket {
+	return &Socket{client: client, namespace: namespace, events: make(map[string][]Callback)}
+}
+
+// ID returns the socket ID that's given by the server, it's empty when the socket isn't
+// connected.
+func (s *Socket) ID() string { defer s.lock()(); return s.id }
+
+// Namespace returns the namespace of the socket
+func (s *Socket) Namespace() string { return s.namespace }
+
+// Connected reports if the socket is connected to the namespace
+func (s *Socket) Connected() bool { defer s.lock()(); return s.connected }
+
+// On adds the callback for the event, the callbacks are called in the order they were added.
+func (s *Socket) On(event string, callback Callback) {
+	defer s.lock()()
+	s.events[event] = append(s.events[event], callback)
+}
+
+// Off removes all of the callbacks for the event.
+func (s *Socket) Off(event string) {
+	defer s.lock()()
+	delete(s.events, event)
+}
+
+// OnConnect adds the callback that's called each time the socket is connected, which
+// includes after a reconnection.
+func (s *Socket) OnConnect(callback func()) {
+	defer s.lock()()
+	s.onConnect = append(s.onConnect, callback)
+}
+
+// OnDisconnect adds the callback that's called with the reason each time the socket is
+// disconnected.
+func (s *Socket) OnDisconnect(callback func(DisconnectReason)) {
+	defer s.lock()()
+	s.onDisconnect = append(s.onDisconnect, callback)
+}
+
+// OnConnectError adds the callback that's called when the server rejects the connection
+// to the namespace, the error is a *ConnectError.
+func (s *Socket) OnConnectError(callback func(error)) {
+	defer s.lock()()
+	s.onConnectError = append(s.onConnectError, callback)
+}
+
+// Emit sends the event with the data to the server. When the last data value is a
+// Callback it's called with the acknowledgement from the server. The events are
+// buffered while the socket is reconnecting.
+func (s *Socket) Emit(event string, data ...seri.Serializable) error {
+	binary, args, cb := scrub(event, data)
+
+	packet := &emitPacket{binary: binary, data: args}
+	if cb != nil {
+		packet.ack = func(data []interface{}, err error) {
+			if err == nil {
+				cb.Callback(data...)
+			}
+		}
+	}
+
+	defer s.lock()()
+	return s.emit(packet)
+}
+
+// EmitWithAck sends the event with the data to the server, then blocks until the server
+// acknowledges the event, the ctx is done or the socket disconnects.
+func (s *Socket) EmitWithAck(ctx context.Context, event string, data ...seri.Serializable) ([]interface{}, error) {
+	binary, args, _ := scrub(event, data)
+
+	type result struct {
+		data []interface{}
+		err  error
+	}
+	var done = make(chan result, 1)
+
+	packet := &emitPacket{binary: binary, data: args}
+	packet.ack = func(data []interface{}, err error) {
+		if err == nil {
+			// the attachments are closed once the ack is handled, so they're read into memory
+			data = siop.ReadAttachments(data).([]interface{})
+		}
+		done <- result{data, err}
+	}
+
+	unlock := s.lock()
+	err := s.emit(packet)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case rtn := <-done:
+		return rtn.data, rtn.err
+	case <-ctx.Done():
+		unlock := s.lock()
+		s.removeEmit(packet)
+		unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Connect connects the socket to the namespace, and waits until the server accepts or
+// rejects the connection. A rejection is returned as a *ConnectError.
+func (s *Socket) Connect(ctx context.Context) error {
+	unlock := s.lock()
+	switch {
+	case s.client.closed:
+		unlock()
+		return ErrClientClosed
+	case s.connected:
+		unlock()
+		return nil
+	}
+
+	wait := make(chan error, 1)
+	s.waits = append(s.waits, wait)
+	if !s.active {
+		s.active = true
+		s.client.sendConnect(s)
+	}
+	unlock()
+
+	select {
+	case err := <-wait:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Disconnect disconnects the socket from the namespace, it's not connected again after
+// a reconnection. The socket can be connected again with the Connect method.
+func (s *Socket) Disconnect() error {
+	c := s.client
+
+	c.mu.Lock()
+	connected := s.connected
+	if connected {
+		c.send(nil, siop.WithType(siop.DisconnectPacket.Byte()), siop.WithNamespace(s.namespace))
+	}
+	s.id, s.connected, s.active = "", false, false
+	s.buffer = nil
+	waits := s.waits
+	s.waits = nil
+	acks := c.removeAcks(s.namespace)
+	c.mu.Unlock()
+
+	for _, wait := range waits {
+		wait <- ErrSocketDisconnected
+	}
+	for _, ack := range acks {
+		ack(nil, ErrSocketDisconnected)
+	}
+	if connected {
+		s.callDisconnect(ClientDisconnect)
+	}
+	return nil
+}
+
+func (s *Socket) lock() func() { s.client.mu.Lock(); return s.client.mu.Unlock }
+
+// emit sends the packet, or buffers it until the socket is connected. It's called with
+// the lock held.
+func (s *Socket) emit(packet *emitPacket) error {
+	switch {
+	case s.client.closed:
+		return ErrClientClosed
+	case !s.active:
+		return ErrSocketDisconnected
+	case !s.connected:
+		s.buffer = append(s.buffer, packet)
+		return nil
+	}
+
+	packetType := siop.EventPacket.Byte()
+	if packet.binary {
+		packetType = siop.BinaryEventPacket.Byte()
+	}
+
+	opts := []siop.Option{siop.WithType(packetType), siop.WithNamespace(s.namespace)}
+	if packet.ack != nil {
+		packet.ackID = s.client.addAck(s.namespace, packet.ack)
+		opts = append(opts, siop.WithAckID(packet.ackID))
+	}
+	s.client.send(packet.data, opts...)
+	return nil
+}
+
+// removeEmit removes the packet from the buffer, or the ack of the packet when it has
+// been sent. It's called with the lock held.
+func (s *Socket) removeEmit(packet *emitPacket) {
+	if packet.ackID > 0 {
+		delete(s.client.acks, packet.ackID)
+		return
+	}
+	for i, buffered := range s.buffer {
+		if buffered == packet {
+			s.buffer = append(s.buffer[:i], s.buffer[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch handles the packets that are sent to the namespace
+func (s *Socket) dispatch(packet siot.Socket) {
+	switch packet.Type {
+	case siop.ConnectPacket.Byte():
+		s.connect(packet)
+	case siop.DisconnectPacket.Byte():
+		unlock := s.lock()
+		connected := s.connected
+		s.id, s.connected, s.active = "", false, false
+		acks := s.client.removeAcks(s.namespace)
+		unlock()
+
+		for _, ack := range acks {
+			ack(nil, ErrSocketDisconnected)
+		}
+		if connected {
+			s.callDisconnect(ServerDisconnect)
+		}
+	case siop.EventPacket.Byte(), siop.BinaryEventPacket.Byte():
+		args := dataArgs(packet.Data)
+		if len(args) == 0 {
+			return
+		}
+		event, ok := args[0].(string)
+		if !ok {
+			return
+		}
+		s.callEvent(packet, event, args[1:])
+	case siop.ConnectErrorPacket.Byte():
+		s.connectError(packet)
+	}
+}
+
+func (s *Socket) connect(packet siot.Socket) {
+	c := s.client
+
+	unlock := s.lock()
+	if !s.active {
+		unlock()
+		return // the default namespace of the older protocols after a Disconnect
+	}
+
+	switch {
+	case c.protocol == ProtocolV5:
+		if data, ok := packet.Data.(map[string]interface{}); ok {
+			s.id, _ = data["sid"].(string)
+		}
+	case s.namespace == "/":
+		s.id = c.engineID()
+	default:
+		s.id = s.namespace + "#" + c.engineID()
+	}
+	s.connected = true
+
+	for _, buffered := range s.buffer {
+		s.emit(buffered)
+	}
+	s.buffer = nil
+
+	waits, callbacks := s.waits, append([]func(){}, s.onConnect...)
+	s.waits = nil
+	unlock()
+
+	for _, wait := range waits {
+		wait <- nil
+	}
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// connectError is the rejection of the connection to the namespace. The older protocols
+// also use the packet for errors after the connection, they are passed to the "error"
+// event callbacks.
+func (s *Socket) connectError(packet siot.Socket) {
+	err := connectError(packet.Data)
+
+	unlock := s.lock()
+	if s.connected {
+		unlock()
+		s.callEvent(siot.Socket{}, "error", []interface{}{err.Message})
+		return
+	}
+	s.active = false
+	waits, callbacks := s.waits, append([]func(error){}, s.onConnectError...)
+	s.waits = nil
+	unlock()
+
+	for _, wait := range waits {
+		wait <- err
+	}
+	for _, fn := range callbacks {
+		fn(err)
+	}
+}
+
+// callEvent calls each callback of the event in the order that they were added. The
+// first callback that can acknowledge the event sends the ack back to the server.
+func (s *Socket) callEvent(packet siot.Socket, event string, args []interface{}) {
+	unlock := s.lock()
+	callbacks := append([]Callback{}, s.events[event]...)
+	unlock()
+
+	var acked bool
+	for _, fn := range callbacks {
+		if ack, ok := fn.(callbackAck); ok && packet.AckID > 0 && !acked {
+			acked = true
+
+			var vals []interface{}
+			var err error
+			if ackErr, ok := fn.(callbackAckErr); ok {
+				vals, err = ackErr.CallbackAckErr(args...)
+			} else {
+				vals = ack.CallbackAck(args...)
+			}
+			if err != nil {
+				continue
+			}
+
+			packetType := siop.AckPacket.Byte()
+			if binary.Has(vals) {
+				packetType = siop.BinaryAckPacket.Byte()
+			}
+
+			unlock := s.lock()
+			s.client.send(vals, siop.WithType(packetType), siop.WithNamespace(s.namespace), siop.WithAckID(packet.AckID))
+			unlock()
+			continue
+		}
+		fn.Callback(args...)
+	}
+}
+
+func (s *Socket) callDisconnect(reason DisconnectReason) {
+	unlock := s.lock()
+	callbacks := append([]func(DisconnectReason){}, s.onDisconnect...)
+	unlock()
+
+	for _, fn := range callbacks {
+		fn(reason)
+	}
+}
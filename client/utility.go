@@ -0,0 +1,78 @@
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/njones/socketio/internal/binary"
+	seri "github.com/njones/socketio/serialize"
+)
+
+// scrub returns the event with the data as the packet data, and the ack callback when
+// it's the last data value. The data is the same as the server sends for an emit.
+func scrub(event string, data []seri.Serializable) (hasBinary bool, out []interface{}, cb Callback) {
+	type ifa interface{ Interface() interface{} }
+	out = make([]interface{}, 0, len(data)+1)
+	out = append(out, event)
+	for i, v := range data {
+		if fn, ok := v.(Callback); ok && i == len(data)-1 {
+			return hasBinary, out, fn
+		}
+		if _, ok := v.(io.Reader); ok {
+			hasBinary = true
+		}
+		if vi, ok := v.(ifa); ok {
+			val := vi.Interface()
+			if err, ok := val.(error); ok {
+				val = err.Error()
+			}
+			if !hasBinary {
+				hasBinary = binary.Has(val)
+			}
+			out = append(out, val)
+			continue
+		}
+		out = append(out, v)
+	}
+	return hasBinary, out, nil
+}
+
+// dataArgs returns the packet data as arguments, the older protocols decode the data
+// as strings.
+func dataArgs(data interface{}) []interface{} {
+	switch data := data.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return data
+	case []string:
+		rtn := make([]interface{}, len(data))
+		for i, v := range data {
+			rtn[i] = v
+		}
+		return rtn
+	}
+	return []interface{}{data}
+}
+
+// connectError returns the data of a CONNECT_ERROR or ERROR packet as an error
+func connectError(data interface{}) *ConnectError {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		msg, _ := data["message"].(string)
+		return &ConnectError{Message: msg, Data: data["data"]}
+	case string:
+		return &ConnectError{Message: data}
+	case error:
+		return &ConnectError{Message: data.Error()}
+	case []interface{}:
+		if len(data) == 1 {
+			return connectError(data[0])
+		}
+	case []string:
+		if len(data) == 1 {
+			return connectError(data[0])
+		}
+	}
+	return &ConnectError{Message: fmt.Sprint(data)}
+}
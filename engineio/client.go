@@ -0,0 +1,564 @@
+package engineio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	eiop "github.com/njones/socketio/engineio/protocol"
+	eios "github.com/njones/socketio/engineio/session"
+	eiot "github.com/njones/socketio/engineio/transport"
+	ws "nhooyr.io/websocket"
+)
+
+const (
+	defaultClientVersion = 4
+	defaultClientPath    = "/engine.io/"
+	defaultPingInterval  = 25 * time.Second // used when the handshake doesn't have one
+	wsReadLimit          = 1 << 26          // the websocket message limit, binary attachments can be large
+)
+
+// Client is the client side of an engine.io session. It opens the session with a
+// long-poll handshake, then upgrades to a websocket when the server allows it. The
+// client sends the pings for versions 2 and 3, and answers the pings of the server
+// for version 4.
+//
+// It implements the transport.Transporter interface, so that a socket.io transport
+// can send and receive packets through it the same as a server session.
+type Client struct {
+	id      SessionID
+	name    TransportName
+	version EIOVersionInt
+	codec   eiot.Codec
+	url     *url.URL
+
+	header     http.Header
+	httpClient *http.Client
+	upgrade    bool
+
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+
+	conn *ws.Conn // set after the upgrade
+
+	send    chan eiop.Packet // to the server
+	receive chan eiop.Packet // from the server
+	alive   chan struct{}    // a packet was received from the server
+	readers sync.WaitGroup   // the receive channel is closed after the readers are done
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	once   sync.Once
+	reason eios.CloseReason
+}
+
+// Dial opens an engine.io session at the url, the path defaults to "/engine.io/" when
+// the url doesn't have one. The session is ended with Close, or by the server.
+func Dial(ctx context.Context, rawurl string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, ErrInvalidURL.F(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrUnsupportedScheme.F(u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultClientPath
+	}
+
+	e := &Client{
+		name:       eiot.Polling,
+		version:    defaultClientVersion,
+		httpClient: http.DefaultClient,
+		upgrade:    true,
+		send:       make(chan eiop.Packet, 1000),
+		receive:    make(chan eiop.Packet, 1000),
+		alive:      make(chan struct{}, 1),
+	}
+	e.With(opts...)
+
+	switch e.version {
+	case 2:
+		e.codec = eiot.Codec{
+			PacketEncoder:  eiop.NewPacketEncoderV2,
+			PacketDecoder:  eiop.NewPacketDecoderV2,
+			PayloadEncoder: eiop.NewPayloadEncoderV2,
+			PayloadDecoder: eiop.NewPayloadDecoderV2,
+		}
+	case 3:
+		e.codec = eiot.Codec{
+			PacketEncoder:  eiop.NewPacketEncoderV3,
+			PacketDecoder:  eiop.NewPacketDecoderV3,
+			PayloadEncoder: eiop.NewPayloadEncoderV3,
+			PayloadDecoder: eiop.NewPayloadDecoderV3,
+		}
+	case 4:
+		e.codec = eiot.Codec{
+			PacketEncoder:  eiop.NewPacketEncoderV4,
+			PacketDecoder:  eiop.NewPacketDecoderV4,
+			PayloadEncoder: eiop.NewPayloadEncoderV4,
+			PayloadDecoder: eiop.NewPayloadDecoderV4,
+		}
+	default:
+		return nil, ErrUnsupportedClientVersion.F(e.version)
+	}
+	e.url = withQuery(u, url.Values{"EIO": {strconv.Itoa(int(e.version))}})
+
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	packets, err := e.handshake(ctx)
+	if err != nil {
+		e.cancel()
+		return nil, err
+	}
+
+	var upgrades []string
+	switch h := packets[0].D.(type) {
+	case *eiop.HandshakeV4:
+		e.id, upgrades = SessionID(h.SID), h.Upgrades
+		e.pingInterval, e.pingTimeout = time.Duration(h.PingInterval), time.Duration(h.PingTimeout)
+	case *eiop.HandshakeV3:
+		e.id, upgrades = SessionID(h.SID), h.Upgrades
+		e.pingInterval, e.pingTimeout = time.Duration(h.PingInterval), time.Duration(h.PingTimeout)
+	case *eiop.HandshakeV2:
+		e.id, upgrades = SessionID(h.SID), h.Upgrades
+		e.pingTimeout = time.Duration(h.PingTimeout)
+	}
+	if e.pingInterval <= 0 {
+		e.pingInterval = defaultPingInterval
+	}
+
+	for _, packet := range packets[1:] {
+		e.handle(packet)
+	}
+
+	if e.upgrade && contains(upgrades, string(eiot.Websocket)) {
+		if err := e.upgradeTo(ctx); err == nil {
+			e.name = eiot.Websocket
+		}
+	}
+
+	e.readers.Add(1)
+	if e.conn != nil {
+		go e.readWebsocket()
+		go e.writeWebsocket()
+	} else {
+		go e.poll()
+		go e.post()
+	}
+	go e.heartbeat()
+
+	return e, nil
+}
+
+func (e *Client) With(opts ...Option) {
+	for _, opt := range opts {
+		opt(e)
+	}
+}
+
+func (e *Client) ID() SessionID                      { return e.id }
+func (e *Client) Name() TransportName                { return e.name }
+func (e *Client) Shutdown()                          { e.Send(eiop.Packet{T: eiop.ClosePacket}) }
+func (e *Client) Done() <-chan struct{}              { return e.ctx.Done() }
+func (e *Client) requestURL(query url.Values) string { return withQuery(e.url, query).String() }
+
+// Receive returns the message and binary packets from the server, the channel is closed
+// after the session has ended.
+func (e *Client) Receive() <-chan eiop.Packet { return e.receive }
+
+// Reason waits until the session has ended, then returns why it ended.
+func (e *Client) Reason() eios.CloseReason {
+	<-e.ctx.Done()
+	return e.reason
+}
+
+// Close sends a close packet to the server, and waits until the session has ended.
+func (e *Client) Close() error {
+	e.Shutdown()
+	<-e.Done()
+	return nil
+}
+
+// Run is part of the transport.Transporter interface, the session is already running
+// when the client is returned from Dial.
+func (e *Client) Run(http.ResponseWriter, *http.Request, ...eiot.Option) error { return nil }
+
+// Send queues the packet to be sent to the server. Noop packets are not sent, they are
+// only used to pass errors from the socket.io transport.
+func (e *Client) Send(packet eiop.Packet) {
+	if packet.T == eiop.NoopPacket {
+		return
+	}
+	select {
+	case e.send <- packet:
+	case <-e.ctx.Done():
+	}
+}
+
+// close ends the session with the reason, the receive channel is closed once the
+// readers are done.
+func (e *Client) close(reason eios.CloseReason) {
+	e.once.Do(func() {
+		e.reason = reason
+		e.cancel()
+		if e.conn != nil {
+			e.conn.Close(ws.StatusNormalClosure, string(reason))
+		}
+		go func() {
+			e.readers.Wait()
+			close(e.receive)
+		}()
+	})
+}
+
+// handle takes care of the engine.io packets, and passes on the message packets
+func (e *Client) handle(packet eiop.Packet) {
+	select {
+	case e.alive <- struct{}{}:
+	default:
+	}
+
+	switch packet.T {
+	case eiop.PingPacket:
+		e.Send(eiop.Packet{T: eiop.PongPacket, D: packet.D})
+	case eiop.ClosePacket:
+		e.close(eios.TransportClose)
+	case eiop.MessagePacket, eiop.BinaryPacket:
+		if _, ok := packet.D.(io.Reader); ok {
+			packet.T = eiop.BinaryPacket
+		}
+		select {
+		case e.receive <- packet:
+		case <-e.ctx.Done():
+		}
+	}
+}
+
+// heartbeat closes the session when nothing has been received from the server within the
+// ping interval and timeout. The server sends the pings from engine.io v4, before that
+// the client sends them.
+func (e *Client) heartbeat() {
+	timeout := time.NewTimer(e.pingInterval + e.pingTimeout)
+	defer timeout.Stop()
+
+	var ping <-chan time.Time
+	if e.version < 4 {
+		ticker := time.NewTicker(e.pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-e.alive:
+			if !timeout.Stop() {
+				<-timeout.C
+			}
+			timeout.Reset(e.pingInterval + e.pingTimeout)
+		case <-ping:
+			e.Send(eiop.Packet{T: eiop.PingPacket})
+		case <-timeout.C:
+			e.close(eios.PingTimeout)
+			return
+		}
+	}
+}
+
+// handshake opens the session with a long-poll, the first packet is the open packet.
+func (e *Client) handshake(ctx context.Context) (eiop.Payload, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.requestURL(url.Values{"transport": {string(eiot.Polling)}}), nil)
+	if err != nil {
+		return nil, ErrHandshakeFailed.F(err)
+	}
+	setHeader(req, e.header)
+
+	rsp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, ErrHandshakeFailed.F(err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, ErrHandshakeStatus.F(rsp.StatusCode)
+	}
+
+	var payload eiop.Payload
+	if err := e.codec.PayloadDecoder.From(rsp.Body).ReadPayload(&payload); err != nil {
+		return nil, ErrHandshakeFailed.F(err)
+	}
+	if len(payload) == 0 || payload[0].T != eiop.OpenPacket {
+		return nil, ErrUnexpectedHandshake.F(payload)
+	}
+	return payload, nil
+}
+
+// upgradeTo opens a websocket for the session, and probes it before the upgrade packet
+// is sent. The long-poll isn't started until after, so there is nothing to wind down.
+func (e *Client) upgradeTo(ctx context.Context) (err error) {
+	wsURL := withQuery(e.url, url.Values{"transport": {string(eiot.Websocket)}, "sid": {e.id.String()}})
+	wsURL.Scheme = strings.Replace(wsURL.Scheme, "http", "ws", 1)
+
+	conn, _, err := ws.Dial(ctx, wsURL.String(), &ws.DialOptions{HTTPClient: e.httpClient, HTTPHeader: e.header})
+	if err != nil {
+		return ErrUpgradeFailed.F(err)
+	}
+	defer func() {
+		if err != nil {
+			conn.Close(ws.StatusNormalClosure, "upgrade failed")
+		}
+	}()
+	conn.SetReadLimit(wsReadLimit)
+
+	if err := e.writePacket(ctx, conn, eiop.Packet{T: eiop.PingPacket, D: "probe"}); err != nil {
+		return ErrUpgradeFailed.F(err)
+	}
+
+	for {
+		_, r, err := conn.Reader(ctx)
+		if err != nil {
+			return ErrUpgradeFailed.F(err)
+		}
+		var packet eiop.Packet
+		err = e.codec.PacketDecoder.From(r).ReadPacket(&packet)
+		io.Copy(io.Discard, r)
+		if err != nil {
+			return ErrUpgradeFailed.F(err)
+		}
+		if packet.T != eiop.PongPacket {
+			continue // a ping from the server, the session is still on the long-poll
+		}
+		if packet.D != "probe" {
+			return ErrUnexpectedPong
+		}
+		break
+	}
+
+	if err := e.writePacket(ctx, conn, eiop.Packet{T: eiop.UpgradePacket}); err != nil {
+		return ErrUpgradeFailed.F(err)
+	}
+	e.conn = conn
+	return nil
+}
+
+func (e *Client) writePacket(ctx context.Context, conn *ws.Conn, packet eiop.Packet) error {
+	if packet.T == eiop.BinaryPacket {
+		w, err := conn.Writer(ctx, ws.MessageBinary)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, binaryData(packet.D)); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	}
+
+	w, err := conn.Writer(ctx, ws.MessageText)
+	if err != nil {
+		return err
+	}
+	if err := e.codec.PacketEncoder.To(w).WritePacket(packet); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (e *Client) readWebsocket() {
+	defer e.readers.Done()
+
+	for {
+		typ, r, err := e.conn.Reader(e.ctx)
+		if err != nil {
+			e.close(closeReason(err))
+			return
+		}
+
+		if typ == ws.MessageBinary {
+			var buf = new(bytes.Buffer)
+			if _, err := buf.ReadFrom(r); err != nil {
+				e.close(closeReason(err))
+				return
+			}
+			e.handle(eiop.Packet{T: eiop.BinaryPacket, D: buf})
+			continue
+		}
+
+		var packet eiop.Packet
+		err = e.codec.PacketDecoder.From(r).ReadPacket(&packet)
+		io.Copy(io.Discard, r)
+		if err != nil {
+			e.close(eios.ParseError)
+			return
+		}
+		e.handle(packet)
+	}
+}
+
+func (e *Client) writeWebsocket() {
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case packet := <-e.send:
+			if err := e.writePacket(e.ctx, e.conn, packet); err != nil {
+				e.close(closeReason(err))
+				return
+			}
+			if packet.T == eiop.ClosePacket {
+				e.close(eios.ForcedClose)
+				return
+			}
+		}
+	}
+}
+
+// poll is the long-poll for the packets from the server
+func (e *Client) poll() {
+	defer e.readers.Done()
+
+	for {
+		req, err := http.NewRequestWithContext(e.ctx, http.MethodGet, e.requestURL(e.sessionQuery()), nil)
+		if err != nil {
+			e.close(eios.TransportError)
+			return
+		}
+		setHeader(req, e.header)
+
+		rsp, err := e.httpClient.Do(req)
+		if err != nil {
+			e.close(eios.TransportError)
+			return
+		}
+
+		var payload eiop.Payload
+		err = e.codec.PayloadDecoder.From(rsp.Body).ReadPayload(&payload)
+		rsp.Body.Close()
+		switch {
+		case e.ctx.Err() != nil:
+			return
+		case rsp.StatusCode != http.StatusOK:
+			e.close(eios.TransportError)
+			return
+		case err != nil:
+			e.close(eios.ParseError)
+			return
+		}
+
+		for _, packet := range payload {
+			e.handle(packet)
+		}
+	}
+}
+
+// post sends the queued packets to the server, all of the packets that are waiting
+// are sent in one payload
+func (e *Client) post() {
+	for {
+		var payload eiop.Payload
+		select {
+		case <-e.ctx.Done():
+			return
+		case packet := <-e.send:
+			payload = append(payload, packet)
+		}
+		for len(e.send) > 0 {
+			payload = append(payload, <-e.send)
+		}
+
+		var body = new(bytes.Buffer)
+		if err := e.codec.PayloadEncoder.To(body).WritePayload(payload); err != nil {
+			e.close(eios.TransportError)
+			return
+		}
+
+		req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.requestURL(e.sessionQuery()), body)
+		if err != nil {
+			e.close(eios.TransportError)
+			return
+		}
+		setHeader(req, e.header)
+		req.Header.Set("Content-Type", "text/plain;charset=UTF-8")
+
+		rsp, err := e.httpClient.Do(req)
+		if err != nil {
+			e.close(eios.TransportError)
+			return
+		}
+		io.Copy(io.Discard, rsp.Body)
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK {
+			e.close(eios.TransportError)
+			return
+		}
+		for _, packet := range payload {
+			if packet.T == eiop.ClosePacket {
+				e.close(eios.ForcedClose)
+				return
+			}
+		}
+	}
+}
+
+func (e *Client) sessionQuery() url.Values {
+	return url.Values{"transport": {string(eiot.Polling)}, "sid": {e.id.String()}}
+}
+
+// withQuery returns a copy of the url with the query values added
+func withQuery(u *url.URL, query url.Values) *url.URL {
+	rtn := *u
+	q := rtn.Query()
+	for k, v := range query {
+		q[k] = v
+	}
+	rtn.RawQuery = q.Encode()
+	return &rtn
+}
+
+func setHeader(req *http.Request, header http.Header) {
+	for k, v := range header {
+		req.Header[k] = v
+	}
+}
+
+// binaryData returns the data of a binary packet as an io.Reader
+func binaryData(data interface{}) io.Reader {
+	switch v := data.(type) {
+	case io.Reader:
+		return v
+	case []byte:
+		return bytes.NewReader(v)
+	case string:
+		return strings.NewReader(v)
+	}
+	return bytes.NewReader(nil)
+}
+
+// closeReason returns the reason for a websocket error
+func closeReason(err error) eios.CloseReason {
+	if ws.CloseStatus(err) != -1 || errors.Is(err, io.EOF) {
+		return eios.TransportClose
+	}
+	return eios.TransportError
+}
+
+func contains(list []string, str string) bool {
+	for _, v := range list {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package engineio_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	eio "github.com/njones/socketio/engineio"
+	eiop "github.com/njones/socketio/engineio/protocol"
+	eios "github.com/njones/socketio/engineio/session"
+	eiot "github.com/njones/socketio/engineio/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// withEcho sends each packet that's received by a transport back to the client
+func withEcho() []eio.Option {
+	echo := func(fn func(eiot.SessionID, eiot.Codec) eiot.Transporter) func(eiot.SessionID, eiot.Codec) eiot.Transporter {
+		return func(id eiot.SessionID, codec eiot.Codec) eiot.Transporter {
+			tr := fn(id, codec)
+			go func() {
+				for packet := range tr.Receive() {
+					if r, ok := packet.D.(io.Reader); ok {
+						b, _ := io.ReadAll(r)
+						packet.D = bytes.NewReader(b)
+					}
+					if packet.T == eiop.MessagePacket || packet.T == eiop.BinaryPacket {
+						tr.Send(packet)
+					}
+				}
+			}()
+			return tr
+		}
+	}
+	return []eio.Option{
+		eio.WithTransport(eiot.Polling, echo(eiot.NewPollingTransport(1000))),
+		eio.WithTransport(eiot.Websocket, echo(eiot.NewWebsocketTransport(1000))),
+	}
+}
+
+func TestClient(t *testing.T) {
+	servers := map[int]func(...eio.Option) eio.Server{
+		2: eio.NewServerV2,
+		3: eio.NewServerV3,
+		4: eio.NewServerV4,
+	}
+
+	for version, newServer := range servers {
+		for name, upgrade := range map[string]bool{"Polling": false, "Websocket": true} {
+			version, newServer, upgrade := version, newServer, upgrade
+			t.Run(fmt.Sprintf("v%d.%s", version, name), func(t *testing.T) {
+				server := httptest.NewServer(newServer(append(withEcho(), eio.WithPingTimeout(1*time.Second))...))
+				defer server.Close()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				client, err := eio.Dial(ctx, server.URL, eio.WithProtocolVersion(version), eio.WithUpgrade(upgrade))
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				assert.NotEmpty(t, client.ID())
+				if upgrade {
+					assert.Equal(t, eiot.Websocket, client.Name())
+				} else {
+					assert.Equal(t, eiot.Polling, client.Name())
+				}
+
+				client.Send(eiop.Packet{T: eiop.MessagePacket, D: "hello"})
+				select {
+				case packet := <-client.Receive():
+					assert.Equal(t, eiop.MessagePacket, packet.T)
+					assert.Equal(t, "hello", packet.D)
+				case <-ctx.Done():
+					t.Fatal("timed out")
+				}
+
+				if version > 3 || upgrade {
+					// the binary packets of the older payloads are only sent over a websocket
+					client.Send(eiop.Packet{T: eiop.BinaryPacket, D: strings.NewReader("\x01\x02\x03")})
+					select {
+					case packet := <-client.Receive():
+						if assert.Equal(t, eiop.BinaryPacket, packet.T) {
+							b, err := io.ReadAll(packet.D.(io.Reader))
+							assert.NoError(t, err)
+							assert.Equal(t, []byte("\x01\x02\x03"), b)
+						}
+					case <-ctx.Done():
+						t.Fatal("timed out")
+					}
+				}
+
+				assert.NoError(t, client.Close())
+				assert.Equal(t, eios.ForcedClose, client.Reason())
+
+				_, ok := <-client.Receive()
+				assert.False(t, ok)
+			})
+		}
+	}
+}
+
+func TestClientUnsupportedVersion(t *testing.T) {
+	_, err := eio.Dial(context.Background(), "http://localhost", eio.WithProtocolVersion(5))
+	assert.Error(t, err)
+}
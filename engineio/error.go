@@ -13,11 +13,23 @@ const (
 	ErrInvalidRequestHTTPMethod = httpErrStr(erro.HTTPStatusError400 + "invalid request, an unimplemented HTTP method")
 	ErrInvalidURIPath           = httpErrStr(erro.HTTPStatusError400 + "invalid URI path, the prefix is not found")
 	ErrTransportUpgradeFailed   = httpErrStr(erro.HTTPStatusError400 + "failed to upgrade transport")
+	ErrServerShuttingDown       = httpErrStr(erro.HTTPStatusError503 + "server is shutting down")
 
 	EOH erro.State = "End Of Handshake"
 	IOR erro.State = "Is OPTION Request"
 )
 
+const (
+	ErrInvalidURL               erro.StringF = "invalid url:: %w"
+	ErrUnsupportedScheme        erro.StringF = "unsupported url scheme %q, expected http or https"
+	ErrUnsupportedClientVersion erro.StringF = "unsupported engine.io protocol version %d"
+	ErrHandshakeFailed          erro.StringF = "failed the engine.io handshake:: %w"
+	ErrHandshakeStatus          erro.StringF = "failed the engine.io handshake with the status %d"
+	ErrUnexpectedHandshake      erro.StringF = "expected an open packet, found %v"
+	ErrUpgradeFailed            erro.StringF = "failed the websocket upgrade:: %w"
+	ErrUnexpectedPong           erro.State   = "upgrade: unexpected pong"
+)
+
 type httpErrStr string
 
 func (e httpErrStr) Error() string { return string(e[erro.HTTPStatusErrorLen:]) }
@@ -0,0 +1,42 @@
+package engineio
+
+import "net/http"
+
+// WithProtocolVersion sets the engine.io protocol version that a Client speaks, from 2
+// to 4. The default is 4.
+func WithProtocolVersion(version int) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.version = EIOVersionInt(version)
+		}
+	}
+}
+
+// WithHeader adds the headers to each of the requests of a Client.
+func WithHeader(header http.Header) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.header = header
+		}
+	}
+}
+
+// WithHTTPClient sets the HTTP client that a Client uses for the polling requests and
+// the websocket handshake, the default is the http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.httpClient = client
+		}
+	}
+}
+
+// WithUpgrade sets if a Client upgrades the long-polling session to a websocket when
+// the server allows it, the default is true.
+func WithUpgrade(upgrade bool) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*Client); ok {
+			v.upgrade = upgrade
+		}
+	}
+}
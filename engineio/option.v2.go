@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	eios "github.com/njones/socketio/engineio/session"
 	eiot "github.com/njones/socketio/engineio/transport"
 )
 
@@ -104,3 +105,13 @@ func WithSessionShave(d time.Duration) Option {
 		}
 	}
 }
+
+// WithSessionClose sets the function that is called with the reason after a session
+// has ended, and its transport has been removed.
+func WithSessionClose(fn func(SessionID, eios.CloseReason)) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*serverV2); ok {
+			v.sessions.(*sessions).onClose = fn
+		}
+	}
+}
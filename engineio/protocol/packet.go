@@ -39,11 +39,19 @@ type Packet struct {
 	D interface{} `json:"data"`
 
 	isOpenPacket bool
+	noCompress   bool
 }
 
 func (pac Packet) PacketVal() Packet   { return pac }
 func (pac *Packet) PacketRef() *Packet { return pac }
 
+// WithCompress returns the packet with a hint for the transport if the packet should
+// be compressed when it's written out. Packets are compressed by default.
+func (pac Packet) WithCompress(compress bool) Packet { pac.noCompress = !compress; return pac }
+
+// ShouldCompress returns the hint for the transport if the packet should be compressed.
+func (pac Packet) ShouldCompress() bool { return !pac.noCompress }
+
 type useLen interface{ Len() int }
 
 func (pac Packet) Len() int {
@@ -20,6 +20,13 @@ type (
 
 	PayloadWriter interface{ WritePayload(PayloadVal) error }
 	PayloadReader interface{ ReadPayload(PayloadRef) error }
+
+	// PayloadStreamReader is implemented by payload readers that can pass each packet to
+	// fn as soon as it's decoded. The data of a binary packet is an io.Reader that reads
+	// from the payload, and it's only valid until fn returns.
+	PayloadStreamReader interface {
+		ReadPayloadStream(fn func(Packet) error) error
+	}
 )
 
 type reader struct {
@@ -4,6 +4,7 @@
 package protocol
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -85,6 +86,17 @@ func (enc *PayloadEncoderV3) encode(packet PacketV3) error {
 
 	var binaryB string
 	var lenBuf int
+	if r, ok := packet.D.(io.Reader); ok {
+		if _, ok := r.(useLen); !ok {
+			// the length is written before the data, so data with an unknown length is buffered
+			var buf = new(bytes.Buffer)
+			if _, err := buf.ReadFrom(r); err != nil {
+				return ErrEncodePayloadFailed.F(err).KV(ver, "v3")
+			}
+			packet.D = buf
+		}
+	}
+
 	if enc.hasBinarySupport && enc.hasXHR2Support {
 		return enc.write.encodeXHR2(packet)
 	}
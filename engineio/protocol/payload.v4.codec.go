@@ -24,9 +24,16 @@ type _payloadDecoderV4 func(r io.Reader) *PayloadDecoderV4
 type _payloadEncoderV4 func(w io.Writer) *PayloadEncoderV4
 type _payloadReaderV4 func(pay *PayloadV4) (err error)
 type _payloadWriterV4 func(pay PayloadV4) (err error)
+type _payloadStreamReaderV4 struct {
+	_payloadReaderV4
+	stream func(func(PacketV4) error) error
+}
 
-func (pay _payloadDecoderV4) From(r io.Reader) PayloadReader { return _payloadReaderV4(pay(r).Decode) }
-func (pay _payloadEncoderV4) To(w io.Writer) PayloadWriter   { return _payloadWriterV4(pay(w).Encode) }
+func (pay _payloadDecoderV4) From(r io.Reader) PayloadReader {
+	dec := pay(r)
+	return _payloadStreamReaderV4{_payloadReaderV4(dec.Decode), dec.DecodeStream}
+}
+func (pay _payloadEncoderV4) To(w io.Writer) PayloadWriter { return _payloadWriterV4(pay(w).Encode) }
 func (pay _payloadReaderV4) ReadPayload(payload PayloadRef) (err error) {
 	var pay4 PayloadV4
 	if err = pay(&pay4); err != nil {
@@ -46,6 +53,9 @@ func (pay _payloadReaderV4) ReadPayload(payload PayloadRef) (err error) {
 
 	return nil
 }
+func (pay _payloadStreamReaderV4) ReadPayloadStream(fn func(Packet) error) error {
+	return pay.stream(func(packet PacketV4) error { return fn(packet.Packet) })
+}
 func (pay _payloadWriterV4) WritePayload(payload PayloadVal) error {
 	pay4 := make(PayloadV4, len(payload.PayloadVal()))
 	for i, v := range payload.PayloadVal() {
@@ -4,6 +4,7 @@
 package protocol
 
 import (
+	"encoding/base64"
 	"io"
 
 	rw "github.com/njones/socketio/internal/readwriter"
@@ -28,9 +29,9 @@ func (dec *PayloadDecoderV4) Decode(payload *PayloadV4) (err error) {
 
 	var r = newRecordScan(dec.read)
 
-	for dec.read.IsNotErr() {
+	for more := true; more && dec.read.IsNotErr(); more = r.next() {
 		var packet PacketV4
-		if dec.read.IsNotErr() && dec.read.ConditionalErr(NewPacketDecoderV4(r).Decode(&packet)).IsNotErr() {
+		if dec.read.ConditionalErr(NewPacketDecoderV4(r).Decode(&packet)).IsNotErr() {
 			*payload = append(*payload, packet)
 		}
 	}
@@ -38,6 +39,32 @@ func (dec *PayloadDecoderV4) Decode(payload *PayloadV4) (err error) {
 	return dec.read.ConvertErr(io.EOF, nil).Err()
 }
 
+// DecodeStream calls fn with each packet as soon as it's decoded, instead of decoding the
+// whole payload first. The data of a binary packet is an io.Reader that decodes straight
+// from the payload, so it's only valid until fn returns.
+func (dec *PayloadDecoderV4) DecodeStream(fn func(PacketV4) error) error {
+	var r = newRecordScan(dec.read)
+
+	for more := true; more; more = r.next() {
+		var packet PacketV4
+		if b, err := r.r.Peek(1); err == io.EOF {
+			break
+		} else if err == nil && b[0] == 'b' {
+			r.r.Discard(1)
+			packet.T, packet.IsBinary = BinaryPacket, true
+			packet.D = base64.NewDecoder(base64.StdEncoding, r)
+		} else if err := NewPacketDecoderV4(r).Decode(&packet); err != nil {
+			return ErrDecodePayloadFailed.F(err).KV(ver, "v4")
+		}
+
+		if err := fn(packet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type PayloadEncoderV4 struct{ *PayloadEncoderV3 }
 
 var NewPayloadEncoderV4 _payloadEncoderV4 = func(w io.Writer) *PayloadEncoderV4 {
@@ -3,6 +3,7 @@ package protocol
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 
@@ -36,6 +37,31 @@ func TestPayloadV4(t *testing.T) {
 				assert.Equal(t, output, have)
 			}
 		},
+		"DecodeStream": func(output PayloadV4, input string, isXHR2 bool, xErr error) testFn {
+			return func(t *testing.T) {
+				for _, opt := range opts {
+					opt(t)
+				}
+
+				t.Parallel()
+
+				var have PayloadV4
+				var err = NewPayloadDecoderV4(strings.NewReader(input)).DecodeStream(func(packet PacketV4) error {
+					if r, ok := packet.D.(io.Reader); ok {
+						var data = new(bytes.Buffer)
+						if _, err := data.ReadFrom(r); err != nil {
+							return err
+						}
+						packet.D = data
+					}
+					have = append(have, packet)
+					return nil
+				})
+
+				assert.ErrorIs(t, err, xErr)
+				assert.Equal(t, output, have)
+			}
+		},
 		"Encode": func(input PayloadV4, output string, isXHR2 bool, xErr error) testFn {
 			return func(t *testing.T) {
 				for _, opt := range opts {
@@ -103,6 +129,17 @@ func TestPayloadV4(t *testing.T) {
 			}
 			return asPacket, asString, isXHR2, nil
 		},
+		"With multiple Binary": func(*testing.T) (PayloadV4, string, bool, error) {
+			isXHR2 := false
+			asString := "4€\x1ebAQIDBA==\x1ebBQY=\x1e4hello"
+			asPacket := PayloadV4{
+				{PacketV3{PacketV2{Packet{T: MessagePacket, D: "€"}}, false}},
+				{PacketV3{PacketV2{Packet{T: BinaryPacket, D: bytes.NewBuffer([]byte{0x01, 0x02, 0x03, 0x04})}}, true}},
+				{PacketV3{PacketV2{Packet{T: BinaryPacket, D: bytes.NewBuffer([]byte{0x05, 0x06})}}, true}},
+				{PacketV3{PacketV2{Packet{T: MessagePacket, D: "hello"}}, false}},
+			}
+			return asPacket, asString, isXHR2, nil
+		},
 	}
 
 	for name, testParams := range spec {
@@ -1,6 +1,7 @@
 package engineio
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 
@@ -13,6 +14,21 @@ type ctxKey string
 const ctxSessionID ctxKey = "sessionID"
 const ctxTransportName ctxKey = "transportName"
 const ctxEIOVersion ctxKey = "eioVersion"
+const ctxTransportRun ctxKey = "transportRun"
+
+// WithTransportRun returns a copy of r, that when passed to ServeTransport has the error of
+// the transport Run sent to errc. The transport writes to the ResponseWriter until Run returns,
+// so a handler that calls ServeTransport waits on errc before it returns.
+func WithTransportRun(r *http.Request, errc chan<- error) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxTransportRun, errc))
+}
+
+// transportRun sends the error of the transport Run to the channel of the request, if any.
+func transportRun(ctx context.Context, err error) {
+	if errc, ok := ctx.Value(ctxTransportRun).(chan<- error); ok {
+		errc <- err
+	}
+}
 
 type (
 	SessionID     = eios.ID
@@ -32,6 +48,7 @@ type server interface {
 type Server = interface {
 	OptionWith
 	ServeHTTP(http.ResponseWriter, *http.Request)
+	Shutdown(context.Context) error
 }
 
 type EIOServer interface {
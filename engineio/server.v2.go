@@ -16,11 +16,13 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	eiop "github.com/njones/socketio/engineio/protocol"
 	eios "github.com/njones/socketio/engineio/session"
 	eiot "github.com/njones/socketio/engineio/transport"
+	erro "github.com/njones/socketio/internal/errors"
 )
 
 const Version2 EIOVersionStr = "2"
@@ -63,7 +65,8 @@ type serverV2 struct {
 	sessions   transportSessions
 	transports map[TransportName]func(SessionID, eiot.Codec) eiot.Transporter
 
-	transportRunError chan error
+	shuttingDown int32 // set by Shutdown, new handshakes are refused
+	active       int64 // the number of ServeHTTP handlers that are running
 }
 
 func NewServerV2(opts ...Option) Server {
@@ -79,7 +82,6 @@ func (v2 *serverV2) new(opts ...Option) *serverV2 {
 	v2.upgradeTimeout = 10000 * time.Millisecond
 	v2.maxHttpBufferSize = 10e7
 	v2.transportChanBuf = 1000
-	v2.transportRunError = make(chan error, 1)
 
 	v2.generateID = eios.GenerateID
 	v2.codec = eiot.Codec{
@@ -111,22 +113,53 @@ func (v2 *serverV2) With(opts ...Option) {
 }
 
 func (v2 *serverV2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	_, err := v2.ServeTransport(w, r)
+	atomic.AddInt64(&v2.active, 1)
+	defer atomic.AddInt64(&v2.active, -1)
+
+	errc := make(chan error, 1)
+	_, err := v2.ServeTransport(w, WithTransportRun(r, errc))
 	if err != nil {
 		goto HandleError
 	}
-	err = <-v2.transportRunError
+	err = <-errc
 
 HandleError:
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrInvalidRequestHTTPMethod):
 			return
+		case errors.Is(err, erro.HTTPStatusError503):
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
 		}
 		return
 	}
 }
 
+// Shutdown gracefully shuts down the server. New handshakes are refused with a 503 Service
+// Unavailable, then every session is sent a close packet after the packets that are waiting
+// to be sent, and the sessions end with the "forced close" reason. It waits for the sessions
+// to end, and the running handlers to return, until the ctx is done.
+func (v2 *serverV2) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&v2.shuttingDown, 1)
+
+	if err := v2.sessions.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&v2.active) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 func (v2 *serverV2) ServeTransport(w http.ResponseWriter, r *http.Request) (eiot.Transporter, error) {
 	if v2.path == nil || !strings.HasPrefix(r.URL.Path, *v2.path) {
 		return nil, ErrInvalidURIPath
@@ -146,6 +179,10 @@ func (v2 *serverV2) ServeTransport(w http.ResponseWriter, r *http.Request) (eiot
 		return nil, ErrInvalidRequestHTTPMethod
 	}
 
+	if sessionID == "" && atomic.LoadInt32(&v2.shuttingDown) == 1 {
+		return nil, ErrServerShuttingDown
+	}
+
 	eioVersion := eioVersionFrom(r)
 	server, ok := v2.servers[eioVersion]
 	if !ok || eioVersion == "" {
@@ -234,7 +271,7 @@ func (v2 *serverV2) serveTransport(w http.ResponseWriter, r *http.Request) (tran
 
 	opts = append(opts, eiot.WithNoPing())
 	go func() {
-		v2.transportRunError <- upgrade.transport.Run(w, r.WithContext(ctx), append(v2.eto, opts...)...)
+		transportRun(ctx, upgrade.transport.Run(w, r.WithContext(ctx), append(v2.eto, opts...)...))
 	}()
 
 	return upgrade.transport, nil
@@ -2,11 +2,13 @@ package engineio_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	eio "github.com/njones/socketio/engineio"
 	eios "github.com/njones/socketio/engineio/session"
@@ -127,3 +129,33 @@ func CORSV2(t *testing.T) (a eio.Server, m []variables) {
 	}
 	return v2, out
 }
+
+func TestShutdownV2(t *testing.T) {
+	var (
+		v2     = eio.NewServerV2(eio.WithPath("/engine.io/"))
+		server = httptest.NewServer(v2)
+		client = server.Client()
+	)
+	defer server.Close()
+
+	handshake := func() *http.Response {
+		resp, err := client.Get(fmt.Sprintf("%s/engine.io/?EIO=2&transport=polling", server.URL))
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := handshake()
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the session is never polled, so the close packet can't be flushed
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, v2.Shutdown(ctx), context.DeadlineExceeded)
+
+	resp = handshake()
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	assert.NoError(t, v2.Shutdown(context.Background()), "the sessions have been expired")
+}
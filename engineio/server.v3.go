@@ -130,7 +130,7 @@ func (v3 *serverV3) serveTransport(w http.ResponseWriter, r *http.Request) (tran
 	ctx = v3.sessions.WithTimeout(ctx, v3.pingTimeout)
 
 	go func() {
-		v3.transportRunError <- upgrade.transport.Run(w, r.WithContext(ctx), append(v3.eto, opts...)...)
+		transportRun(ctx, upgrade.transport.Run(w, r.WithContext(ctx), append(v3.eto, opts...)...))
 	}()
 
 	return upgrade.transport, nil
@@ -99,8 +99,8 @@ func (v4 *serverV4) serveTransport(w http.ResponseWriter, r *http.Request) (tran
 	}
 
 	upgrade := v4.doUpgrade(v4.sessions.Get(sessionID))(w, r)
-	if err != nil {
-		return nil, err
+	if upgrade.err != nil {
+		return nil, upgrade.err
 	}
 
 	var opts []eiot.Option
@@ -113,7 +113,7 @@ func (v4 *serverV4) serveTransport(w http.ResponseWriter, r *http.Request) (tran
 	ctx = v4.sessions.WithTimeout(ctx, v4.pingTimeout)
 
 	go func() {
-		v4.transportRunError <- upgrade.transport.Run(w, r.WithContext(ctx), append(v4.eto, opts...)...)
+		transportRun(ctx, upgrade.transport.Run(w, r.WithContext(ctx), append(v4.eto, opts...)...))
 	}()
 
 	return upgrade.transport, err
@@ -0,0 +1,14 @@
+package session
+
+// CloseReason is the reason that an EngineIO session has ended
+type CloseReason string
+
+const (
+	TransportClose CloseReason = "transport close" // the client closed the connection or sent a close packet
+	TransportError CloseReason = "transport error" // the connection failed while reading or writing
+	PingTimeout    CloseReason = "ping timeout"    // the client didn't respond within the ping timeout
+	ParseError     CloseReason = "parse error"     // the client sent data that couldn't be decoded
+	ForcedClose    CloseReason = "forced close"    // the server closed the session with Shutdown
+)
+
+func (r CloseReason) String() string { return string(r) }
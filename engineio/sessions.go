@@ -22,6 +22,8 @@ type transportSessions interface {
 	Set(eiot.Transporter) error
 	Get(SessionID) (eiot.Transporter, error)
 
+	Shutdown(ctx context.Context) error
+
 	WithCancel(ctx context.Context) context.Context
 	WithTimeout(ctx context.Context, d time.Duration) context.Context
 	WithInterval(ctx context.Context, d time.Duration) context.Context
@@ -41,6 +43,7 @@ func NewSessions() *sessions {
 		t:      new(sync.Map),
 		i:      new(sync.Map),
 		cancel: new(sync.Map),
+		reason: new(sync.Map),
 		shave:  10 * time.Millisecond,
 		removeTransport: func(sessionID SessionID) {
 			tr.ʘ.Lock()
@@ -51,6 +54,51 @@ func NewSessions() *sessions {
 	return &sessions{transport: &tr, lifecycle: &li}
 }
 
+// Set adds the transport to the sessions, and sets the transport up so that
+// the session is ended, with the reason, when the transport is shutdown or closed.
+func (s *sessions) Set(tr eiot.Transporter) error {
+	if v, ok := tr.(interface{ With(...eiot.Option) }); ok {
+		sessionID := tr.ID()
+		v.With(eiot.OnShutdown(func(reason eios.CloseReason) { s.expire(sessionID, reason) }))
+	}
+	return s.transport.Set(tr)
+}
+
+// shutdownPollInterval is how often Shutdown checks that the sessions have ended
+var shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown sends a close packet to every session, after the packets that are waiting to
+// be sent, and waits for the sessions to end. The sessions that are still open when the
+// ctx is done are expired right away.
+func (s *sessions) Shutdown(ctx context.Context) error {
+	for _, tr := range s.transports() {
+		tr.Shutdown()
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		transports := s.transports()
+		if len(transports) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, tr := range transports {
+				if _, ok := s.t.Load(tr.ID()); ok {
+					s.expire(tr.ID(), eios.ForcedClose)
+					continue
+				}
+				s.end(tr.ID(), eios.ForcedClose) // there is no timer to expire
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 type transport struct {
 	ʘ *sync.RWMutex
 	s map[SessionID]eiot.Transporter
@@ -64,6 +112,17 @@ func (t *transport) Set(tr eiot.Transporter) error {
 	return nil
 }
 
+func (t *transport) transports() []eiot.Transporter {
+	t.ʘ.RLock()
+	defer t.ʘ.RUnlock()
+
+	rtn := make([]eiot.Transporter, 0, len(t.s))
+	for _, tr := range t.s {
+		rtn = append(rtn, tr)
+	}
+	return rtn
+}
+
 func (t *transport) Get(sessionID SessionID) (eiot.Transporter, error) {
 	t.ʘ.RLock()
 	defer t.ʘ.RUnlock()
@@ -81,8 +140,10 @@ type lifecycle struct {
 	t      *sync.Map
 	i      *sync.Map
 	cancel *sync.Map
+	reason *sync.Map
 
 	removeTransport func(SessionID)
+	onClose         func(SessionID, eios.CloseReason) // see WithSessionClose
 }
 
 func (c *lifecycle) WithCancel(ctx context.Context) context.Context {
@@ -137,7 +198,7 @@ func (c *lifecycle) WithInterval(ctx context.Context, d time.Duration) context.C
 	}
 
 	storeDuration(&c.id, d)
-	c.i.LoadOrStore(sessionID, time.NewTicker(c.id))
+	c.i.LoadOrStore(sessionID, time.NewTicker(loadDuration(&c.id)))
 
 	var interval eios.IntervalChannel = func() <-chan time.Time {
 		if val, ok := c.i.Load(sessionID); ok {
@@ -198,14 +259,38 @@ func (c *lifecycle) setTimeout(sessionID SessionID, start time.Time) {
 		cancel, _ := c.cancel.Load(sessionID)
 		cancel.(func())()
 
-		c.removeSession(sessionID)
-		if c.removeTransport != nil {
-			c.removeTransport(sessionID)
+		// the timer is reset by the client, so it only runs out by itself when the client
+		// hasn't answered within the ping timeout, every other end stores its reason with expire
+		reason := eios.PingTimeout
+		if val, ok := c.reason.LoadAndDelete(sessionID); ok {
+			reason = val.(eios.CloseReason)
 		}
-		c.cancel.Delete(sessionID)
+		c.end(sessionID, reason)
 	}()
 }
 
+// end removes the session and its transport, then calls the onClose function with the reason
+func (c *lifecycle) end(sessionID SessionID, reason eios.CloseReason) {
+	c.removeSession(sessionID)
+	if c.removeTransport != nil {
+		c.removeTransport(sessionID)
+	}
+	c.cancel.Delete(sessionID)
+
+	if c.onClose != nil {
+		c.onClose(sessionID, reason)
+	}
+}
+
+// expire ends the session right away, instead of waiting for the timeout. The first
+// reason is kept when the session is expired more than once.
+func (c *lifecycle) expire(sessionID SessionID, reason eios.CloseReason) {
+	if val, ok := c.t.Load(sessionID); ok {
+		c.reason.LoadOrStore(sessionID, reason)
+		val.(*time.Timer).Reset(0)
+	}
+}
+
 func (c *lifecycle) removeSession(sessionID SessionID) {
 	c.t.Delete(sessionID)
 	c.i.Delete(sessionID)
@@ -8,4 +8,5 @@ const (
 	ErrUnimplementedMethod erro.StringF = "unimplemented %s method"
 	ErrCloseSocket         erro.State   = "socket: closed"
 	ErrTimeoutSocket       erro.State   = "socket: timeout"
+	ErrBinaryTooLarge      erro.State   = "binary: too large"
 )
@@ -1,8 +1,10 @@
 package transport
 
 import (
+	"sync/atomic"
 	"time"
 
+	eios "github.com/njones/socketio/engineio/session"
 	with "github.com/njones/socketio/internal/option"
 )
 
@@ -30,6 +32,21 @@ func OnUpgrade(fn func() error) Option {
 	return func(o OptionWith) {
 		if v, ok := o.(*WebsocketTransport); ok {
 			v.fnOnUpgrade = fn
+			if fn != nil {
+				atomic.StoreInt32(&v.upgrading, 1)
+			}
+		}
+	}
+}
+
+// OnShutdown sets the function that ends the session, it's called with ForcedClose after the
+// close packet from Shutdown has been written out to the client, or with the reason that the
+// client closed or broke the connection.
+func OnShutdown(fn func(eios.CloseReason)) Option {
+	return func(o OptionWith) {
+		switch v := o.(type) {
+		case interface{ InnerTransport() *Transport }:
+			v.InnerTransport().shutdown = fn
 		}
 	}
 }
@@ -38,7 +55,7 @@ func WithNoPing() Option {
 	return func(o OptionWith) {
 		switch v := o.(type) {
 		case interface{ InnerTransport() *Transport }:
-			v.InnerTransport().sendPing = false
+			atomic.StoreInt32(&v.InnerTransport().noPing, 1)
 		}
 	}
 }
@@ -59,3 +76,27 @@ func WithGovernor(minTime, sleep time.Duration) Option {
 		}
 	}
 }
+
+// WithVolatileThreshold sets the number of queued packets that are allowed before
+// the transport is no longer writable, and volatile packets are dropped.
+func WithVolatileThreshold(n int) Option {
+	return func(o OptionWith) {
+		switch v := o.(type) {
+		case interface{ InnerTransport() *Transport }:
+			v.InnerTransport().threshold = n
+		}
+	}
+}
+
+// WithMaxBinarySize sets the max bytes of a single binary packet that is received from the
+// client. Reading past the max returns an ErrBinaryTooLarge error, and the connection is
+// closed. The websocket transport also raises its message limit, which is 32768 bytes by
+// default, to the max.
+func WithMaxBinarySize(n int64) Option {
+	return func(o OptionWith) {
+		switch v := o.(type) {
+		case interface{ InnerTransport() *Transport }:
+			v.InnerTransport().maxBinary = n
+		}
+	}
+}
@@ -37,6 +37,13 @@ type Transporter interface {
 	Shutdown()
 }
 
+// Writable is implemented by transports that can report if a packet that is sent now
+// would be written out to the client, instead of waiting in the queue. This is used
+// to drop volatile packets.
+type Writable interface {
+	Writable() bool
+}
+
 type StartWriteBuffer func() bool
 
 func (StartWriteBuffer) Len() int { return 0 }
@@ -46,11 +53,14 @@ type Transport struct {
 	name  Name
 	codec Codec
 
-	sendPing bool
+	noPing int32 // set by WithNoPing, which runs on every request of a polling transport
 
 	send, receive chan eiop.Packet
 
-	shutdown func()
+	threshold int   // the queued packets that are allowed before it's not writable
+	maxBinary int64 // the max bytes of a binary packet, zero is no limit
+
+	shutdown func(eios.CloseReason) // ends the session, see OnShutdown
 }
 
 func (t *Transport) ID() SessionID               { return t.id }
@@ -58,8 +68,16 @@ func (t *Transport) Name() Name                  { return t.name }
 func (t *Transport) Send(packet eiop.Packet)     { t.receive <- packet }
 func (t *Transport) Receive() <-chan eiop.Packet { return t.send }
 func (t *Transport) Transport() *Transport       { return t }
-func (t *Transport) Shutdown() {
+func (t *Transport) Writable() bool              { return len(t.receive) < t.threshold }
+
+// Shutdown sends a close packet to the client. The session is ended after the
+// close packet has been written out by the transport.
+func (t *Transport) Shutdown() { t.Send(eiop.Packet{T: eiop.ClosePacket}) }
+
+// closed ends the session with the reason, this is called after the close packet has been
+// written out, or when the client closes or breaks the connection
+func (t *Transport) closed(reason eios.CloseReason) {
 	if t.shutdown != nil {
-		t.shutdown()
+		t.shutdown(reason)
 	}
 }
@@ -2,11 +2,13 @@ package transport
 
 import (
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	eiop "github.com/njones/socketio/engineio/protocol"
@@ -23,7 +25,8 @@ type handlerWithError func(http.ResponseWriter, *http.Request) error
 type PollingTransport struct {
 	*Transport
 
-	sleep time.Duration
+	sleep   time.Duration
+	polling int32 // set when there is a pending long-poll
 
 	compress func(handlerWithError) handlerWithError
 }
@@ -32,12 +35,12 @@ func NewPollingTransport(chanBuf int) func(SessionID, Codec) Transporter {
 	return func(id SessionID, codec Codec) Transporter {
 		t := &PollingTransport{
 			Transport: &Transport{
-				id:       id,
-				name:     Polling,
-				codec:    codec,
-				send:     make(chan eiop.Packet, chanBuf),
-				receive:  make(chan eiop.Packet, chanBuf),
-				sendPing: true,
+				id:        id,
+				name:      Polling,
+				codec:     codec,
+				send:      make(chan eiop.Packet, chanBuf),
+				receive:   make(chan eiop.Packet, chanBuf),
+				threshold: chanBuf / 2,
 			},
 			compress: func(fn handlerWithError) handlerWithError {
 				return func(w http.ResponseWriter, r *http.Request) error {
@@ -59,6 +62,12 @@ func (t *PollingTransport) With(opts ...Option) {
 
 func (t *PollingTransport) InnerTransport() *Transport { return t.Transport }
 
+// Writable returns true when there is a pending long-poll that will write out the
+// packet and the queue has not gone past the threshold.
+func (t *PollingTransport) Writable() bool {
+	return atomic.LoadInt32(&t.polling) == 1 && t.Transport.Writable()
+}
+
 func (t *PollingTransport) Run(w http.ResponseWriter, r *http.Request, opts ...Option) (err error) {
 	t.With(opts...)
 
@@ -112,6 +121,8 @@ Write:
 
 // longPoll allows a connection for a specified amout of time... then releases a payload
 func (t *PollingTransport) poll(w http.ResponseWriter, r *http.Request) (err error) {
+	atomic.StoreInt32(&t.polling, 1)
+	defer atomic.StoreInt32(&t.polling, 0)
 
 	var ctx = r.Context()
 	var interval, timeout, cancel = make(<-chan time.Time), make(<-chan struct{}), make(<-chan func())
@@ -146,7 +157,7 @@ Write:
 				packet := <-t.receive
 				packets = append(packets, packet)
 			}
-			if len(packets) == 0 && t.sendPing {
+			if len(packets) == 0 && atomic.LoadInt32(&t.noPing) == 0 {
 				packets = append(packets, eiop.Packet{T: eiop.PingPacket, D: nil})
 			}
 			break Write
@@ -169,10 +180,17 @@ Write:
 		}
 	default:
 		if len(packets) > 0 {
+			if z, ok := w.(interface{ SkipCompression() }); ok && !shouldCompress(packets) {
+				z.SkipCompression()
+			}
 			if err := t.codec.PayloadEncoder.To(w).WritePayload(packets); err != nil {
+				t.closed(eios.TransportError)
 				t.send <- eiop.Packet{T: eiop.NoopPacket, D: socketClose{err}}
 				return ErrEncodeFailed.F("polling", err)
 			}
+			if hasClosePacket(packets) {
+				defer t.closed(eios.ForcedClose)
+			}
 		}
 	}
 
@@ -182,28 +200,52 @@ Write:
 
 // gather pulls in all of the posts
 func (t *PollingTransport) emit(w http.ResponseWriter, r *http.Request) error {
+	var stop = errors.New("stop") // a close or pong packet ends the read early
+	var pong bool
 
-	var payload eiop.Payload
-	if err := t.codec.PayloadDecoder.From(r.Body).ReadPayload(&payload); err != nil {
-		t.send <- eiop.Packet{T: eiop.NoopPacket, D: socketClose{err}}
-		return ErrDecodeFailed.F("polling", err)
-	}
-
-Read:
-	for _, packet := range payload {
+	err := t.readPayload(r, func(packet eiop.Packet) error {
 		switch packet.T {
 		case eiop.ClosePacket:
+			t.closed(eios.TransportClose)
+			if fn, ok := r.Context().Value(eios.SessionCloseChannelKey).(func() <-chan func()); ok && atomic.LoadInt32(&t.polling) == 0 {
+				// there isn't a long-poll to wind down, so the close doesn't wait on one
+				if cancel := fn(); cancel != nil {
+					go func() {
+						if stop := <-cancel; stop != nil {
+							stop()
+						}
+					}()
+				}
+			}
 			if done, ok := r.Context().Value(eios.SessionCloseFunctionKey).(func() func()); ok {
 				if cleanup := done(); cleanup != nil {
 					cleanup()
 				}
 			}
-			break Read
+			return stop
 		case eiop.PongPacket:
-			t.send <- eiop.Packet{T: eiop.NoopPacket, D: socketClose{ErrCloseSocket}}
-			return nil
+			pong = true
+			return stop
 		}
 		t.send <- packet
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, stop):
+	case errors.Is(err, ErrBinaryTooLarge):
+		t.closed(eios.TransportError)
+		t.send <- eiop.Packet{T: eiop.NoopPacket, D: socketClose{err}}
+		return err
+	case err != nil:
+		t.closed(eios.ParseError)
+		t.send <- eiop.Packet{T: eiop.NoopPacket, D: socketClose{err}}
+		return ErrDecodeFailed.F("polling", err)
+	}
+
+	if pong {
+		t.send <- eiop.Packet{T: eiop.NoopPacket, D: socketClose{ErrCloseSocket}}
+		return nil
 	}
 
 	t.send <- eiop.Packet{T: eiop.NoopPacket, D: socketClose{}} // shutdown the HTTP connection
@@ -211,18 +253,111 @@ Read:
 	return nil
 }
 
+// readPayload calls fn with each packet of the posted payload. When the payload can be
+// streamed, the data of a binary packet is read straight from the request body, and the
+// next packet isn't decoded until the binary data has been read to the end.
+func (t *PollingTransport) readPayload(r *http.Request, fn func(eiop.Packet) error) error {
+	dec := t.codec.PayloadDecoder.From(r.Body)
+
+	stream, ok := dec.(eiop.PayloadStreamReader)
+	if !ok {
+		var payload eiop.Payload
+		if err := dec.ReadPayload(&payload); err != nil {
+			return err
+		}
+		for _, packet := range payload {
+			if data, ok := packet.D.(interface{ Len() int }); ok && packet.T == eiop.BinaryPacket && t.maxBinary > 0 && int64(data.Len()) > t.maxBinary {
+				return ErrBinaryTooLarge
+			}
+			if err := fn(packet); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return stream.ReadPayloadStream(func(packet eiop.Packet) error {
+		if packet.T != eiop.BinaryPacket {
+			return fn(packet)
+		}
+
+		var done, readErr = make(chan struct{}), error(nil)
+		packet.D = newBinaryReader(packet.D.(io.Reader), t.maxBinary, func(err error) {
+			readErr = err
+			close(done)
+		})
+		if err := fn(packet); err != nil {
+			return err
+		}
+
+		select {
+		case <-done:
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+		return readErr
+	})
+}
+
 type HTTPCompressionKind string
 
 const (
 	CompressGZIP HTTPCompressionKind = "gzip"
 )
 
+// hasClosePacket returns true if the payload has a close packet from Shutdown
+func hasClosePacket(packets eiop.Payload) bool {
+	for _, packet := range packets {
+		if packet.T == eiop.ClosePacket {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldCompress returns true if any of the packets in the payload should be compressed
+func shouldCompress(packets eiop.Payload) bool {
+	for _, packet := range packets {
+		if packet.ShouldCompress() {
+			return true
+		}
+	}
+	return false
+}
+
+// compressResponseWriter gzips the response, unless the compression is skipped before the
+// first write. This happens when none of the packets in the payload should be compressed.
 type compressResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
+
+	gz   *gzip.Writer
+	skip bool
 }
 
-func (z compressResponseWriter) Write(p []byte) (n int, err error) { return z.Writer.Write(p) }
+func (z *compressResponseWriter) SkipCompression() { z.skip = true }
+
+func (z *compressResponseWriter) Write(p []byte) (n int, err error) {
+	if z.Writer == nil {
+		z.Writer = z.ResponseWriter
+		if !z.skip {
+			z.Header().Set("Content-Encoding", "gzip")
+			z.gz = gzip.NewWriter(z.ResponseWriter)
+			z.Writer = z.gz
+		}
+	}
+	return z.Writer.Write(p)
+}
+
+func (z *compressResponseWriter) Close() error {
+	if z.gz != nil {
+		return z.gz.Close()
+	}
+	return nil
+}
 
 func WithHTTPCompression(kind HTTPCompressionKind) Option {
 	return func(o OptionWith) {
@@ -236,12 +371,9 @@ func WithHTTPCompression(kind HTTPCompressionKind) Option {
 						if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 							return fn(w, r)
 						}
-						w.Header().Set("Content-Encoding", "gzip")
-
-						gz := gzip.NewWriter(w)
-						defer gz.Close()
+						gzr := &compressResponseWriter{ResponseWriter: w}
+						defer gzr.Close()
 
-						gzr := compressResponseWriter{Writer: gz, ResponseWriter: w}
 						return fn(gzr, r)
 					}
 				}
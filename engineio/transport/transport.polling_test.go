@@ -2,11 +2,15 @@ package transport
 
 import (
 	"fmt"
+	"io"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	eiop "github.com/njones/socketio/engineio/protocol"
+	eios "github.com/njones/socketio/engineio/session"
 	itst "github.com/njones/socketio/internal/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -214,3 +218,159 @@ func TestPollingJSONPTransport(t *testing.T) {
 		}
 	}
 }
+
+func TestPollingTransportWritable(t *testing.T) {
+	codec := Codec{
+		PacketEncoder:  eiop.NewPacketEncoderV4,
+		PacketDecoder:  eiop.NewPacketDecoderV4,
+		PayloadEncoder: eiop.NewPayloadEncoderV4,
+		PayloadDecoder: eiop.NewPayloadDecoderV4,
+	}
+
+	tr := NewPollingTransport(10)(SessionID("12345"), codec).(*PollingTransport)
+	assert.False(t, tr.Writable(), "there is no pending long-poll")
+
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	w := httptest.NewRecorder()
+
+	done := make(chan error)
+	go func() { done <- tr.Run(w, r) }()
+
+	assert.Eventually(t, tr.Writable, time.Second, time.Millisecond, "there is a pending long-poll")
+
+	tr.Send(eiop.Packet{T: eiop.MessagePacket, D: "Hello"})
+	assert.NoError(t, <-done)
+	assert.Equal(t, "4Hello", w.Body.String())
+	assert.False(t, tr.Writable(), "the long-poll has completed")
+
+	tr.With(WithVolatileThreshold(2))
+	atomic.StoreInt32(&tr.polling, 1)
+	tr.Send(eiop.Packet{T: eiop.MessagePacket, D: "Hello"})
+	assert.True(t, tr.Writable(), "the queue is under the threshold")
+	tr.Send(eiop.Packet{T: eiop.MessagePacket, D: "World"})
+	assert.False(t, tr.Writable(), "the queue is at the threshold")
+}
+
+func TestPollingTransportShutdown(t *testing.T) {
+	codec := Codec{
+		PacketEncoder:  eiop.NewPacketEncoderV4,
+		PacketDecoder:  eiop.NewPacketDecoderV4,
+		PayloadEncoder: eiop.NewPayloadEncoderV4,
+		PayloadDecoder: eiop.NewPayloadDecoderV4,
+	}
+
+	var closed int32
+	var reason eios.CloseReason
+	tr := NewPollingTransport(10)(SessionID("12345"), codec).(*PollingTransport)
+	tr.With(OnShutdown(func(r eios.CloseReason) { reason = r; atomic.AddInt32(&closed, 1) }))
+
+	tr.Send(eiop.Packet{T: eiop.MessagePacket, D: "Bye"})
+	tr.Shutdown()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&closed), "the close packet has not been written")
+
+	r := httptest.NewRequest("GET", "http://example.com", nil)
+	w := httptest.NewRecorder()
+
+	assert.NoError(t, tr.Run(w, r))
+	assert.Equal(t, "4Bye\x1e1", w.Body.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed), "the session is ended after the close packet")
+	assert.Equal(t, eios.ForcedClose, reason)
+}
+
+func TestPollingTransportCompression(t *testing.T) {
+	codec := Codec{
+		PacketEncoder:  eiop.NewPacketEncoderV4,
+		PacketDecoder:  eiop.NewPacketDecoderV4,
+		PayloadEncoder: eiop.NewPayloadEncoderV4,
+		PayloadDecoder: eiop.NewPayloadDecoderV4,
+	}
+
+	tests := map[string]struct {
+		packets  []eiop.Packet
+		encoding string
+	}{
+		"compressed": {
+			packets:  []eiop.Packet{{T: eiop.MessagePacket, D: "Hello"}},
+			encoding: "gzip",
+		},
+		"not compressed": {
+			packets: []eiop.Packet{eiop.Packet{T: eiop.MessagePacket, D: "Hello"}.WithCompress(false)},
+		},
+		"any compressed": {
+			packets: []eiop.Packet{
+				eiop.Packet{T: eiop.MessagePacket, D: "Hello"}.WithCompress(false),
+				{T: eiop.MessagePacket, D: "World"},
+			},
+			encoding: "gzip",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tr := NewPollingTransport(1000)(SessionID("12345"), codec)
+
+			for _, packet := range test.packets {
+				tr.Send(packet)
+			}
+
+			r := httptest.NewRequest("GET", "http://example.com", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+
+			err := tr.Run(w, r, WithHTTPCompression(CompressGZIP))
+			assert.NoError(t, err)
+			assert.Equal(t, test.encoding, w.Header().Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestPollingTransportMaxBinarySize(t *testing.T) {
+	codec := Codec{
+		PacketEncoder:  eiop.NewPacketEncoderV4,
+		PacketDecoder:  eiop.NewPacketDecoderV4,
+		PayloadEncoder: eiop.NewPayloadEncoderV4,
+		PayloadDecoder: eiop.NewPayloadDecoderV4,
+	}
+
+	tests := map[string]struct {
+		max  int64
+		data []byte
+		err  error
+	}{
+		"under the max": {max: 4, data: []byte{0x01, 0x02, 0x03, 0x04}},
+		"over the max":  {max: 3, data: []byte{0x01, 0x02, 0x03}, err: ErrBinaryTooLarge},
+		"no max":        {max: 0, data: []byte{0x01, 0x02, 0x03, 0x04}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var reason eios.CloseReason
+			tr := NewPollingTransport(1000)(SessionID("12345"), codec)
+			tr.(*PollingTransport).With(OnShutdown(func(r eios.CloseReason) { reason = r }))
+
+			r := httptest.NewRequest("POST", "http://example.com", strings.NewReader("4Hello\x1ebAQIDBA==\x1e4World"))
+			w := httptest.NewRecorder()
+
+			done := make(chan error)
+			go func() { done <- tr.Run(w, r, WithMaxBinarySize(test.max)) }()
+
+			assert.Equal(t, eiop.Packet{T: eiop.MessagePacket, D: "Hello"}, <-tr.Receive())
+
+			// the binary data is streamed from the request body, so the run doesn't
+			// finish until it has been read
+			packet := <-tr.Receive()
+			assert.Equal(t, eiop.BinaryPacket, packet.T)
+
+			have, err := io.ReadAll(packet.D.(io.Reader))
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.data, have)
+			assert.ErrorIs(t, <-done, test.err)
+
+			if test.err != nil {
+				assert.Equal(t, eios.TransportError, reason)
+				return
+			}
+			assert.Equal(t, eiop.Packet{T: eiop.MessagePacket, D: "World"}, <-tr.Receive())
+		})
+	}
+}
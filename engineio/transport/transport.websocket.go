@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	eiop "github.com/njones/socketio/engineio/protocol"
@@ -21,6 +22,7 @@ type ctky string
 const Websocket Name = "websocket"
 const serverSetupComplete ctky = "server_setup_complete"
 const defaultPingMsg = "probe"
+const defaultReadLimit = 32768 // the websocket message limit
 
 type WebsocketTransport struct {
 	*Transport
@@ -29,8 +31,10 @@ type WebsocketTransport struct {
 	origin      []string
 	PingMsg     string
 	buffered    bool // default: false
+	deflate     bool // default: false
 	isInitProbe bool
 	fnOnUpgrade func() error
+	upgrading   int32 // set until the upgrade packet is received
 	governor    struct {
 		sleep   time.Duration
 		minTime time.Duration
@@ -42,11 +46,12 @@ func NewWebsocketTransport(chanBuf int) func(SessionID, Codec) Transporter {
 		{
 			t := &WebsocketTransport{
 				Transport: &Transport{
-					id:      id,
-					name:    Websocket,
-					codec:   codec,
-					send:    make(chan eiop.Packet, chanBuf),
-					receive: make(chan eiop.Packet, chanBuf),
+					id:        id,
+					name:      Websocket,
+					codec:     codec,
+					send:      make(chan eiop.Packet, chanBuf),
+					receive:   make(chan eiop.Packet, chanBuf),
+					threshold: chanBuf / 2,
 				},
 				origin:  []string{"*"},
 				PingMsg: defaultPingMsg,
@@ -65,16 +70,32 @@ func (t *WebsocketTransport) With(opts ...Option) {
 
 func (t *WebsocketTransport) InnerTransport() *Transport { return t.Transport }
 
+// Writable returns true when the transport is not in the middle of an upgrade and
+// the queue has not gone past the threshold.
+func (t *WebsocketTransport) Writable() bool {
+	return atomic.LoadInt32(&t.upgrading) == 0 && t.Transport.Writable()
+}
+
 func (t *WebsocketTransport) Run(w http.ResponseWriter, r *http.Request, opts ...Option) (err error) {
 	t.With(opts...)
 
+	var compression = ws.CompressionDisabled
+	if t.deflate {
+		compression = ws.CompressionNoContextTakeover
+	}
+
 	t.conn, err = ws.Accept(w, r, &ws.AcceptOptions{
-		OriginPatterns: t.origin,
+		OriginPatterns:  t.origin,
+		CompressionMode: compression,
 	})
 	if err != nil {
 		return err
 	}
 
+	if t.maxBinary > defaultReadLimit {
+		t.conn.SetReadLimit(t.maxBinary)
+	}
+
 	ctx := r.Context()
 	// A context value can be passed in to allow the a server to be setup before the
 	// probe is attempted, this is good for testing. If the context key is not here
@@ -200,7 +221,13 @@ Write:
 					return err
 				}
 
-				io.Copy(cw, packet.D.(io.Reader))
+				if t.deflate && !packet.ShouldCompress() {
+					cw.Write(nil) // the first frame decides if the message is compressed
+				}
+				if _, err := io.Copy(cw, packet.D.(io.Reader)); err != nil {
+					cw.Close()
+					return err
+				}
 				cw.Close()
 			} else {
 
@@ -217,8 +244,14 @@ Write:
 					start = time.Now()
 				}
 
-				err = t.codec.PacketEncoder.To(cw).WritePacket(packet)
+				err = t.writePacket(cw, packet)
 				cw.Close()
+
+				if packet.T == eiop.ClosePacket {
+					t.closed(eios.ForcedClose)
+					reason = "close"
+					break Write
+				}
 			}
 		}
 	}
@@ -237,17 +270,28 @@ Write:
 	return nil
 }
 
-type syncReader struct {
-	r io.Reader
-	s *sync.WaitGroup
-}
+// writePacket writes out the packet as a websocket message. With per-message deflate, the
+// first frame decides if the whole message is compressed, and it's only compressed when
+// that frame is over the compression threshold. So a packet that should be compressed is
+// written in one go, otherwise an empty first frame keeps the message uncompressed.
+func (t *WebsocketTransport) writePacket(w io.Writer, packet eiop.Packet) error {
+	if !t.deflate {
+		return t.codec.PacketEncoder.To(w).WritePacket(packet)
+	}
+
+	if !packet.ShouldCompress() {
+		if _, err := w.Write(nil); err != nil {
+			return err
+		}
+		return t.codec.PacketEncoder.To(w).WritePacket(packet)
+	}
 
-func (r syncReader) Read(p []byte) (n int, err error) {
-	n, err = r.r.Read(p)
-	if errors.Is(err, io.EOF) {
-		r.s.Done()
+	var buf = new(bytes.Buffer)
+	if err := t.codec.PacketEncoder.To(buf).WritePacket(packet); err != nil {
+		return err
 	}
-	return n, err
+	_, err := w.Write(buf.Bytes())
+	return err
 }
 
 func (t *WebsocketTransport) outgoing(r *http.Request) (err error) {
@@ -258,17 +302,26 @@ func (t *WebsocketTransport) outgoing(r *http.Request) (err error) {
 	}
 
 	var unbuffered = new(sync.WaitGroup)
+	var unbufferedErr error // the error that ended the read of the last binary message
 	defer t.conn.Close(ws.StatusNormalClosure, "read")
 
 	for {
 		if !t.buffered {
 			unbuffered.Wait()
+			if errors.Is(unbufferedErr, ErrBinaryTooLarge) {
+				return t.tooLarge(unbufferedErr)
+			}
 		}
 
 		// - /* blocking */ -//
 		// read a packet off the wire...
 		msgType, cr, err := t.conn.Reader(ctx) // this will close when shutdown() is called.
 		if err != nil {
+			if ws.CloseStatus(err) != -1 {
+				t.closed(eios.TransportClose)
+			} else {
+				t.closed(eios.TransportError)
+			}
 			return err
 		}
 
@@ -277,7 +330,10 @@ func (t *WebsocketTransport) outgoing(r *http.Request) (err error) {
 			// this is binary data
 			if t.buffered {
 				var buf = new(bytes.Buffer)
-				_, err := buf.ReadFrom(cr)
+				_, err := buf.ReadFrom(newBinaryReader(cr, t.maxBinary, nil))
+				if errors.Is(err, ErrBinaryTooLarge) {
+					return t.tooLarge(err)
+				}
 				if err != nil {
 					return err
 				}
@@ -286,10 +342,15 @@ func (t *WebsocketTransport) outgoing(r *http.Request) (err error) {
 					D: buf,
 				}
 			} else {
+				// the message is streamed to the reader, so the next message can't be
+				// read off of the wire until this one has been read to the end
 				unbuffered.Add(1)
 				t.send <- eiop.Packet{
 					T: eiop.BinaryPacket,
-					D: syncReader{r: cr, s: unbuffered},
+					D: newBinaryReader(cr, t.maxBinary, func(err error) {
+						unbufferedErr = err
+						unbuffered.Done()
+					}),
 				}
 			}
 			continue
@@ -297,11 +358,13 @@ func (t *WebsocketTransport) outgoing(r *http.Request) (err error) {
 
 		var packet eiop.Packet
 		if err = dec.From(cr).ReadPacket(&packet); err != nil {
+			t.closed(eios.ParseError)
 			return err
 		}
 
 		switch packet.T {
 		case eiop.ClosePacket:
+			t.closed(eios.TransportClose)
 			if done, ok := r.Context().Value(eios.SessionCloseFunctionKey).(func() func()); ok {
 				if cleanup := done(); cleanup != nil {
 					cleanup()
@@ -325,12 +388,12 @@ func (t *WebsocketTransport) outgoing(r *http.Request) (err error) {
 		case eiop.MessagePacket:
 			t.send <- packet
 		case eiop.UpgradePacket:
-			if done, ok := r.Context().Value(eios.SessionCloseFunctionKey).(func() func()); ok {
-				_ = done() // skip cleanup...
-				if t.fnOnUpgrade != nil {
-					if err := t.fnOnUpgrade(); err != nil {
-						return err
-					}
+			atomic.StoreInt32(&t.upgrading, 0)
+			// the session carries on with this transport, so the session close function
+			// isn't called, it would end the incoming loop of this transport
+			if _, ok := r.Context().Value(eios.SessionCloseFunctionKey).(func() func()); ok && t.fnOnUpgrade != nil {
+				if err := t.fnOnUpgrade(); err != nil {
+					return err
 				}
 			}
 
@@ -338,10 +401,17 @@ func (t *WebsocketTransport) outgoing(r *http.Request) (err error) {
 	}
 }
 
+// tooLarge closes the connection because a binary message is over the max binary size
+func (t *WebsocketTransport) tooLarge(err error) error {
+	t.closed(eios.TransportError)
+	t.conn.Close(ws.StatusMessageTooBig, "binary too large")
+	return err
+}
+
 func WithPerMessageDeflate(kind HTTPCompressionKind) Option {
 	return func(o OptionWith) {
 		if v, ok := o.(*WebsocketTransport); ok {
-			_ = v
+			v.deflate = true
 		}
 	}
 }
@@ -1,8 +1,10 @@
 package transport
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,6 +14,7 @@ import (
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	eiop "github.com/njones/socketio/engineio/protocol"
+	eios "github.com/njones/socketio/engineio/session"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -168,3 +171,101 @@ func (h testRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	err := h.fn(w, r.WithContext(ctx), h.opts...)
 	assert.NoError(h.t, err)
 }
+
+func TestWebsocketTransportWritable(t *testing.T) {
+	tr := NewWebsocketTransport(10)(SessionID("12345"), Codec{}).(*WebsocketTransport)
+	assert.True(t, tr.Writable())
+
+	tr.With(OnUpgrade(func() error { return nil }))
+	assert.False(t, tr.Writable(), "the transport is being upgraded")
+}
+
+type recordWriter [][]byte
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	*w = append(*w, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func TestWebsocketTransportWritePacket(t *testing.T) {
+	codec := Codec{
+		PacketEncoder:  eiop.NewPacketEncoderV4,
+		PacketDecoder:  eiop.NewPacketDecoderV4,
+		PayloadEncoder: eiop.NewPayloadEncoderV4,
+		PayloadDecoder: eiop.NewPayloadDecoderV4,
+	}
+
+	tr := NewWebsocketTransport(10)(SessionID("12345"), codec).(*WebsocketTransport)
+	tr.With(WithPerMessageDeflate(CompressGZIP))
+
+	var compressed recordWriter
+	err := tr.writePacket(&compressed, eiop.Packet{T: eiop.MessagePacket, D: "Hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, recordWriter{[]byte("4Hello")}, compressed, "written in one go")
+
+	var uncompressed recordWriter
+	err = tr.writePacket(&uncompressed, eiop.Packet{T: eiop.MessagePacket, D: "Hello"}.WithCompress(false))
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, uncompressed) {
+		assert.Empty(t, uncompressed[0], "starts with an empty frame")
+		assert.Equal(t, "4Hello", string(bytes.Join(uncompressed, nil)))
+	}
+}
+
+func TestWebsocketTransportMaxBinarySize(t *testing.T) {
+	codec := Codec{
+		PacketEncoder:  eiop.NewPacketEncoderV4,
+		PacketDecoder:  eiop.NewPacketDecoderV4,
+		PayloadEncoder: eiop.NewPayloadEncoderV4,
+		PayloadDecoder: eiop.NewPayloadDecoderV4,
+	}
+
+	// the max is over the default websocket message limit of 32768 bytes
+	const max = 40000
+
+	tests := map[string]struct {
+		size int
+		err  error
+	}{
+		"under the max": {size: max},
+		"over the max":  {size: max + 1, err: ErrBinaryTooLarge},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reason := make(chan eios.CloseReason, 1)
+			tr := NewWebsocketTransport(1000)(SessionID("12345"), codec)
+			tr.(*WebsocketTransport).With(OnShutdown(func(r eios.CloseReason) { reason <- r }))
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tr.Run(w, r, WithMaxBinarySize(max))
+			}))
+
+			wsURL := strings.ReplaceAll(server.URL, "http", "ws")
+			wsConn, _, _, err := ws.Dial(context.TODO(), wsURL+"/engine.io")
+			assert.NoError(t, err)
+
+			data := bytes.Repeat([]byte{0x01}, test.size)
+			assert.NoError(t, wsutil.WriteClientBinary(wsConn, data))
+
+			packet := <-tr.Receive()
+			assert.Equal(t, eiop.BinaryPacket, packet.T)
+
+			have, err := io.ReadAll(packet.D.(io.Reader))
+			assert.ErrorIs(t, err, test.err)
+
+			if test.err != nil {
+				assert.Len(t, have, max)
+
+				_, err = wsutil.ReadServerBinary(wsConn)
+				var closed wsutil.ClosedError
+				if assert.ErrorAs(t, err, &closed) {
+					assert.Equal(t, ws.StatusMessageTooBig, closed.Code)
+				}
+				assert.Equal(t, eios.TransportError, <-reason)
+				return
+			}
+			assert.Equal(t, data, have)
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package transport
 
+import "io"
+
 // TODO(njones): fix this so there is an error side channel that can be used.
 // This error will show up in the socketio server through the following trail.
 //
@@ -26,3 +28,41 @@ func (sc socketClose) SocketCloseChannel() error { return sc.error }
 type WriteClose struct{ error }
 
 func (wc WriteClose) SocketCloseChannel() error { return wc.error }
+
+// binaryReader reads the data of a binary packet up to max bytes, the data past max returns
+// an ErrBinaryTooLarge error. The done function is called once with the first error, which
+// is io.EOF when all of the data has been read.
+type binaryReader struct {
+	r    io.Reader
+	max  int64 // zero is no limit
+	n    int64
+	err  error
+	done func(error)
+}
+
+func newBinaryReader(r io.Reader, max int64, done func(error)) *binaryReader {
+	return &binaryReader{r: r, max: max, done: done}
+}
+
+func (br *binaryReader) Read(p []byte) (n int, err error) {
+	if br.err != nil {
+		return 0, br.err
+	}
+
+	if br.max > 0 && int64(len(p)) > br.max-br.n+1 {
+		p = p[:br.max-br.n+1] // one more byte to find out if it's too large
+	}
+
+	n, err = br.r.Read(p)
+	if br.n += int64(n); br.max > 0 && br.n > br.max {
+		n, err = n-int(br.n-br.max), ErrBinaryTooLarge
+	}
+
+	if err != nil {
+		br.err = err
+		if br.done != nil {
+			br.done(err)
+		}
+	}
+	return n, err
+}
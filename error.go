@@ -16,6 +16,19 @@ const (
 	ErrUnexpectedBinaryData   erro.StringF = "expected an []interface{} (binary array) or []string, found %T"
 	ErrUnexpectedPacketType   erro.StringF = "unexpected %T"
 	ErrNamespaceNotFound      erro.StringF = "namespace %q not found"
+	ErrAckTimeout             erro.StringF = "operation has timed out waiting for ack id %s"
+	ErrBroadcastAckTimeout    erro.StringF = "operation has timed out waiting for %d of %d acks"
+	ErrServerSideEmit         erro.String  = "the transport adaptor can not emit to other servers"
 	ErrOnConnectSocket        erro.State   = "socket: invalid onconnect"
 	ErrOnDisconnectSocket     erro.State   = "socket: invalid ondisconnect"
+	ErrDisconnectedSocket     erro.State   = "socket: disconnected"
 )
+
+// ConnectError can be returned from a namespace middleware to reject the connection
+// with a message and structured data, which are sent back in the CONNECT_ERROR packet.
+type ConnectError struct {
+	Message string
+	Data    interface{}
+}
+
+func (e *ConnectError) Error() string { return e.Message }
@@ -0,0 +1,26 @@
+// Package binary finds the data that is sent as binary attachments.
+package binary
+
+import "io"
+
+// Has reports if there is an io.Reader anywhere in the data, which is sent as a binary
+// attachment.
+func Has(data interface{}) bool {
+	switch data := data.(type) {
+	case io.Reader:
+		return true
+	case []interface{}:
+		for _, v := range data {
+			if Has(v) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, v := range data {
+			if Has(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -31,6 +31,7 @@ func (e StatusError) Error() string { return string(e) }
 
 const HTTPStatusErrorLen = len(HTTPStatusError400)
 const HTTPStatusError400 StatusError = "|400| "
+const HTTPStatusError503 StatusError = "|503| "
 
 func KV(kv ...interface{}) Struct { return Struct{kv: kv} }
 
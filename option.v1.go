@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	eio "github.com/njones/socketio/engineio"
+	siot "github.com/njones/socketio/transport"
 )
 
 // WithPath changes the path when using the SocketIO engine in
@@ -21,3 +22,30 @@ func WithPath(path string) Option {
 		}
 	}
 }
+
+// WithAdaptor replaces the default in-memory transport with the transport adaptor tr, like
+// the Redis transport, so that the sockets can be reached from more than one server. The
+// adaptor must create the packets of the server version, which is protocol.NewPacketV2 for
+// the ServerV1 and ServerV2, and protocol.NewPacketV5 for the ServerV3 and ServerV4. The
+// events from ServerSideEmit are received when the adaptor is a transport.ServerSideEmitter,
+// and the sockets of this server can be disconnected by another server when the adaptor is
+// a transport.RemoteDisconnecter.
+func WithAdaptor(tr siot.Transporter) Option {
+	return func(o OptionWith) {
+		if tr == nil {
+			return
+		}
+		switch v := o.(type) {
+		case *ServerV1:
+			v.transport = tr
+			v.setTransporter(tr)
+		case *ServerV4:
+			if emitter, ok := tr.(siot.ServerSideEmitter); ok {
+				emitter.OnServerSideEmit(doServerSideEmitV4(v))
+			}
+			if disconnecter, ok := tr.(siot.RemoteDisconnecter); ok {
+				disconnecter.OnRemoteDisconnect(doRemoteDisconnectV4(v))
+			}
+		}
+	}
+}
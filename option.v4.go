@@ -0,0 +1,49 @@
+package socketio
+
+import (
+	"time"
+
+	siop "github.com/njones/socketio/protocol"
+	siot "github.com/njones/socketio/transport"
+)
+
+// WithConnectionStateRecovery lets a client that reconnects within the maxDisconnection
+// duration get back the same socket id and rooms, and be sent the event packets that
+// it missed while it was disconnected. This needs a transport adaptor that implements
+// the transport.Recoverer interface, like the default in-memory transport.
+func WithConnectionStateRecovery(maxDisconnection time.Duration) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*ServerV4); ok {
+			v.recovery = maxDisconnection
+		}
+	}
+}
+
+// WithMsgpackParser encodes the packets as msgpack binary frames, the same as the
+// socket.io-msgpack-parser, so the clients must use that parser as well. This needs a
+// transport adaptor that implements the transport.PacketSetter interface, like the
+// default in-memory transport.
+func WithMsgpackParser() Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*ServerV4); ok {
+			v1 := v.prev.prev.prev
+			if setter, ok := v1.transport.(siot.PacketSetter); ok {
+				setter.SetNewPacket(siop.NewPacketV5Msgpack)
+			}
+		}
+	}
+}
+
+// WithParser encodes and decodes the packets with the parser p, in place of the socket.io
+// protocol encoding, so the clients must use the same parser. This needs a transport adaptor
+// that implements the transport.ParserSetter interface, like the default in-memory transport.
+func WithParser(p siop.Parser) Option {
+	return func(o OptionWith) {
+		if v, ok := o.(*ServerV4); ok {
+			v1 := v.prev.prev.prev
+			if setter, ok := v1.transport.(siot.ParserSetter); ok {
+				setter.SetParser(p)
+			}
+		}
+	}
+}
@@ -18,6 +18,7 @@ const (
 	ErrParseIntFailed              erro.StringF = "failed to parse int (%s):: %w"
 	ErrUnexpectedPacketType        erro.StringF = "unexpected data type %T"
 	ErrUnexpectedAttachmentEnd     erro.String  = "unexpected attachment end"
+	ErrUnexpectedPlaceholder       erro.StringF = "unexpected binary placeholder num %d"
 	ErrUnexpectedJSONEnd           erro.String  = "unexpected JSON end"
 	ErrBinaryDataUnsupported       erro.String  = "binary data unsupported in this version"
 	ErrReadUseBuffer               errsPacket   = "%s: read buffer"
@@ -17,3 +17,12 @@ func WithNamespace(namespace string) Option {
 func WithAckID(ackID uint64) Option {
 	return func(packet Packet) { packet.WithAckID(ackID) }
 }
+
+// WithCompress sets the transport compression hint in a Packet object
+func WithCompress(compress bool) Option {
+	return func(packet Packet) {
+		if v, ok := packet.(interface{ WithCompress(bool) Packet }); ok {
+			v.WithCompress(compress)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package protocol
 
+import "io"
+
 // Packet is the interface for objects that can be passed around
 // as socket.io packets. It provides a fluent interface for adding
 // data common data to the underling type. The WithOption method
 // can be used to add data to underling types that have additional
-// data than that standard, type, namespace, ackID and data.
+// data than that standard, type, namespace, ackID and data. The
+// Get methods return the standard data.
 type Packet interface {
 	WithOption(...Option) Packet
 
@@ -12,6 +15,11 @@ type Packet interface {
 	WithNamespace(string) Packet
 	WithAckID(uint64) Packet
 	WithData(interface{}) Packet
+
+	GetType() byte
+	GetNamespace() string
+	GetAckID() uint64
+	GetData() interface{}
 }
 
 // NewPacket provides an external type for a Packet factory function.
@@ -26,6 +34,8 @@ type packet struct {
 	Data      packetData  `json:"data"`
 
 	ket func() Packet `json:"-"` // is a function that will return self packet (object) as a Packet (interface)
+
+	noCompress bool `json:"-"` // a hint for the transport to not compress the packet
 }
 
 func (pac packet) Len() (n int) {
@@ -75,6 +85,10 @@ func (pac *packet) WithAckID(x uint64) Packet { pac.AckID = packetAckID(x); retu
 // types, but just the basic underlining type, we will convert it to the correct type.
 func (pac *packet) WithData(x interface{}) Packet { pac.Data = withPacketData(x); return pac.ket() }
 
+// WithCompress sets a hint for the transport if the packet should be compressed when it's written out.
+// This is not part of the wire format, so it doesn't change how the packet is encoded.
+func (pac *packet) WithCompress(x bool) Packet { pac.noCompress = !x; return pac.ket() }
+
 // -------------------------------------------------
 
 // GetType returns the underlining byte type for a socket.io packet Type
@@ -86,6 +100,9 @@ func (pac *packet) GetNamespace() string { return string(pac.Namespace) }
 // GetAckID returns the underlining string type for a socket.io packet AckID
 func (pac *packet) GetAckID() uint64 { return uint64(pac.AckID) }
 
+// GetCompress returns the hint for the transport if the socket.io packet should be compressed
+func (pac *packet) GetCompress() bool { return !pac.noCompress }
+
 // GetData returns the underlining data string/array type for a socket.io packet Data
 func (pac *packet) GetData() interface{} {
 	switch val := pac.Data.(type) {
@@ -98,3 +115,16 @@ func (pac *packet) GetData() interface{} {
 	}
 	return pac.Data // returns the encapsulated, possibly wrapped data
 }
+
+// GetAttachments returns the binary data from anywhere in the socket.io packet Data, in the
+// same order as the placeholder num(s) that are written out for them
+func (pac *packet) GetAttachments() (rdr []io.Reader) {
+	collect := func(r io.Reader) interface{} { rdr = append(rdr, r); return r }
+	switch val := pac.Data.(type) {
+	case *packetDataArray:
+		deconstruct(val.x, collect)
+	case *packetDataObject:
+		deconstruct(val.x, collect)
+	}
+	return rdr
+}
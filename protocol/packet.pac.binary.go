@@ -0,0 +1,201 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+)
+
+// deconstruct walks the data through nested objects and arrays, and returns a copy where
+// each io.Reader is replaced by the value returned from fn. The readers are passed to fn in
+// the order that they are written out, object keys are sorted the same as json.Marshal.
+func deconstruct(data interface{}, fn func(io.Reader) interface{}) interface{} {
+	switch val := data.(type) {
+	case io.Reader:
+		return fn(val)
+	case []interface{}:
+		rtn := make([]interface{}, len(val))
+		for i, v := range val {
+			rtn[i] = deconstruct(v, fn)
+		}
+		return rtn
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		rtn := make(map[string]interface{}, len(val))
+		for _, key := range keys {
+			rtn[key] = deconstruct(val[key], fn)
+		}
+		return rtn
+	}
+	return data
+}
+
+// reconstruct walks the data through nested objects and arrays, and replaces each
+// placeholder object in place with the io.Reader returned from fn for the placeholder num.
+func reconstruct(data interface{}, fn func(int) (io.Reader, error)) (_ interface{}, err error) {
+	switch val := data.(type) {
+	case []interface{}:
+		for i, v := range val {
+			if val[i], err = reconstruct(v, fn); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		if num, ok := placeholder(val); ok {
+			return fn(num)
+		}
+		for key, v := range val {
+			if val[key], err = reconstruct(v, fn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+// placeholder returns the num of a {"_placeholder":true,"num":N} object
+func placeholder(m map[string]interface{}) (int, bool) {
+	if isPlaceholder, ok := m["_placeholder"].(bool); !ok || !isPlaceholder {
+		return 0, false
+	}
+	num, ok := m["num"].(float64)
+	return int(num), ok
+}
+
+// withPlaceholders returns a copy of the data where each io.Reader is replaced by the
+// marshalBinary output, the readers are numbered starting from num.
+func withPlaceholders(data interface{}, num *int, marshalBinary func(int, io.Reader) ([]byte, error)) (interface{}, error) {
+	var err error
+	rtn := deconstruct(data, func(r io.Reader) interface{} {
+		if err != nil {
+			return nil
+		}
+		if marshalBinary == nil {
+			err = ErrBinaryDataUnsupported
+			return nil
+		}
+
+		var b []byte
+		if b, err = marshalBinary(*num, r); err != nil {
+			return nil
+		}
+		*num++
+		return json.RawMessage(b)
+	})
+	return rtn, err
+}
+
+// withAttachments replaces the placeholders in the unmarshaled data v with io.Reader values
+// that are fed from the incoming binary stream, by the placeholder num.
+func withAttachments(v interface{}, incoming *binaryStreamIn) (err error) {
+	var all = make([]*attachment, len(*incoming))
+	attach := func(num int) (io.Reader, error) {
+		if num < 0 || num >= len(*incoming) || (*incoming)[num] != nil {
+			return nil, ErrUnexpectedPlaceholder.F(num)
+		}
+
+		pr, pw := io.Pipe()
+		all[num] = &attachment{PipeReader: pr, num: num, all: all}
+		(*incoming)[num] = func(r io.Reader) error {
+			go func() {
+				_, err := io.Copy(pw, r)
+				pw.CloseWithError(err)
+				if err != nil {
+					io.Copy(io.Discard, r) // the attachment was closed, what's left is thrown away
+				}
+			}()
+			return nil
+		}
+		return all[num], nil
+	}
+
+	switch data := v.(type) {
+	case *[]interface{}:
+		_, err = reconstruct(*data, attach)
+	case *map[string]interface{}:
+		_, err = reconstruct(*data, attach)
+	}
+
+	// attachments that don't have a placeholder are still read from the stream
+	for i, fn := range *incoming {
+		if fn == nil {
+			(*incoming)[i] = func(r io.Reader) error { _, err := io.Copy(io.Discard, r); return err }
+		}
+	}
+	return err
+}
+
+// attachment is the io.ReadCloser that replaces a placeholder. The attachments of a packet
+// are streamed one after the other, so an attachment can't be read until the ones before
+// it have been read to the end. Reading an attachment closes the ones before it instead,
+// and what's left of them is thrown away.
+type attachment struct {
+	*io.PipeReader
+
+	num  int
+	all  []*attachment
+	once sync.Once
+}
+
+func (a *attachment) Read(p []byte) (int, error) {
+	a.once.Do(func() {
+		for _, prev := range a.all[:a.num] {
+			if prev != nil {
+				prev.Close()
+			}
+		}
+	})
+	return a.PipeReader.Read(p)
+}
+
+// CloseAttachments closes the attachments anywhere in the received data, what hasn't been
+// read of them is thrown away. The attachments are streamed, so the transport can't move
+// on to the next packet until they are read or closed. This is called once the packet
+// has been handled.
+func CloseAttachments(data interface{}) {
+	deconstruct(data, func(r io.Reader) interface{} {
+		if a, ok := r.(*attachment); ok {
+			a.Close()
+		}
+		return nil
+	})
+}
+
+// ReadAttachments returns a copy of the received data where each attachment has been read
+// into memory, so the data can be kept after the attachments are closed.
+func ReadAttachments(data interface{}) interface{} {
+	var read = make(map[*attachment]io.Reader)
+	deconstruct(data, func(r io.Reader) interface{} {
+		if a, ok := r.(*attachment); ok && len(read) == 0 {
+			for _, each := range a.all { // in the order they are streamed
+				if each == nil {
+					continue
+				}
+				b, err := io.ReadAll(each)
+				if read[each] = bytes.NewReader(b); err != nil {
+					read[each] = errReader{err}
+				}
+			}
+		}
+		return nil
+	})
+
+	return deconstruct(data, func(r io.Reader) interface{} {
+		if a, ok := r.(*attachment); ok {
+			return read[a]
+		}
+		return r
+	})
+}
+
+// errReader returns the error for every read
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -20,13 +20,6 @@ type (
 
 		x map[string]interface{}
 	}
-
-	packetDataObjectMarshal struct {
-		marshalBinary func(int, io.Reader) ([]byte, error)
-
-		x   map[string]interface{}
-		num int
-	}
 )
 
 //
@@ -126,6 +119,9 @@ func (x *packetDataArray) read(p []byte) (n int, err error) {
 			}
 			num++
 		default:
+			if val, err = withPlaceholders(val, &num, x.marshalBinary); err != nil {
+				return n, ErrMarshalBinaryDataFailed.F(err).KV("array", "binary")
+			}
 			if data, err = json.Marshal(val); err != nil {
 				return n, ErrMarshalDataFailed.F(err).KV("array", "binary")
 			}
@@ -203,7 +199,12 @@ func (x *packetDataObject) Read(p []byte) (n int, err error) {
 		return 0, ErrReadUseBuffer.BufferF("binary data object", []byte("{}"), ErrEmptyDataArray)
 	}
 
-	data, err := json.Marshal(packetDataObjectMarshal{x: x.x, marshalBinary: x.marshalBinary})
+	val, err := withPlaceholders(x.x, new(int), x.marshalBinary)
+	if err != nil {
+		return n, ErrMarshalBinaryDataFailed.F(err).KV("object", "binary")
+	}
+
+	data, err := json.Marshal(val)
 	if err != nil {
 		return n, ErrMarshalDataFailed.F(err).KV("object", "binary")
 	}
@@ -231,42 +232,3 @@ func (x *packetDataObject) Write(p []byte) (n int, err error) {
 
 	return n, err
 }
-
-func (o packetDataObjectMarshal) MarshalJSON() ([]byte, error) {
-	var i int
-	var out = []byte("{")
-
-	for key, val := range o.x {
-		if i > 0 {
-			out = append(out, ',')
-		}
-		out = append(out, `"`+key+`":`...)
-		switch v := val.(type) {
-		case io.Reader:
-			if o.marshalBinary != nil {
-				b, err := o.marshalBinary(o.num, v)
-				if err != nil {
-					return nil, err
-				}
-				out = append(out, b...)
-			}
-			o.num++
-		case map[string]interface{}:
-			b, err := json.Marshal(packetDataObjectMarshal{num: o.num, x: v, marshalBinary: o.marshalBinary})
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, b...)
-		default:
-			b, err := json.Marshal(v)
-			if err != nil {
-				return nil, err
-			}
-			out = append(out, b...)
-		}
-		i++
-	}
-
-	out = append(out, '}')
-	return out, nil
-}
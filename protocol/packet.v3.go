@@ -153,96 +153,15 @@ func writeDataToPacketV3(w io.Writer, in *binaryStreamIn) writeStateFn {
 	}
 }
 
-type copyReader struct {
-	r   io.Reader
-	err chan error
-}
-
-func (cr copyReader) Read(p []byte) (n int, err error) {
-	n, err = cr.r.Read(p)
-	select {
-	case e := <-cr.err:
-		return n, e
-	default:
-		return n, err
-	}
-}
-
 func packetDataArrayUnmarshalV3(incoming *binaryStreamIn) func([]byte, interface{}) error {
-	return func(data_ []byte, vw interface{}) error {
-		err := json.Unmarshal(data_, vw)
-		if err != nil {
+	return func(data []byte, v interface{}) error {
+		if err := json.Unmarshal(data, v); err != nil {
 			return ErrUnmarshalInitialFieldFailed.F(err)
 		}
-
-		// replace your binary data...
-		if datax, ok := vw.(*[]interface{}); ok {
-			for i, v := range *datax {
-				if m, ok := v.(map[string]interface{}); ok {
-					if isPlaceholder, ok := m["_placeholder"].(bool); ok && isPlaceholder {
-						pr, pw := io.Pipe()
-						idx := int(m["num"].(float64))
-
-						cr := copyReader{r: pr, err: make(chan error, 1)}
-
-						(*incoming)[idx] = func(r io.Reader) error {
-
-							go func() {
-								_, err := io.Copy(pw, r)
-								if err != nil {
-									cr.err <- err
-									return
-								}
-								cr.err <- pw.Close()
-							}()
-							return nil
-						}
-
-						vvw, _ := vw.(*[]interface{})
-						(*vvw)[i] = io.Reader(cr)
-					}
-				}
-			}
-		}
-		return nil
+		return withAttachments(v, incoming)
 	}
 }
 
 func packetDataObjectUnmarshalV3(incoming *binaryStreamIn) func([]byte, interface{}) error {
-	return func(data_ []byte, vw interface{}) error {
-		err := json.Unmarshal(data_, vw)
-		if err != nil {
-			return ErrUnmarshalInitialFieldFailed.F(err)
-		}
-
-		// replace your binary data...
-		data, _ := vw.(*map[string]interface{})
-		var loop func(map[string]interface{})
-		loop = func(x map[string]interface{}) {
-			for i, v := range x {
-				if m, ok := v.(map[string]interface{}); ok {
-					if isPlaceholder, ok := m["_placeholder"].(bool); ok && isPlaceholder {
-						pr, pw := io.Pipe()
-						idx := int(m["num"].(float64))
-						(*incoming)[idx] = func(r io.Reader) error {
-
-							e := make(chan error, 1)
-							go func() {
-								io.Copy(pw, r)
-								e <- pw.Close()
-							}()
-
-							return <-e
-						}
-						(*data)[i] = io.Reader(pr)
-					} else {
-						loop(m)
-					}
-				}
-			}
-		}
-		loop(*data)
-
-		return nil
-	}
+	return packetDataArrayUnmarshalV3(incoming)
 }
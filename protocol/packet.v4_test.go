@@ -12,6 +12,15 @@ import (
 func (d testData) rawPacketV4() PacketV4 { return d.rawPacket.(PacketV4) }
 func (d testData) altPacketV4() PacketV4 { return (d.altPacket).(PacketV4) }
 
+// readAll returns a deconstruct func that replaces the binary data with the bytes that are read
+func readAll(t *testing.T) func(io.Reader) interface{} {
+	return func(r io.Reader) interface{} {
+		b, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		return b
+	}
+}
+
 func TestPacketV4(t *testing.T) {
 	var opts = []func(*testing.T){}
 
@@ -102,9 +111,12 @@ func TestPacketV4(t *testing.T) {
 
 							assert.Equal(t, wantb, haveb)
 						default:
-							assert.Equal(t, wantx, _have.x[i])
+							assert.Equal(t, deconstruct(wantx, readAll(t)), deconstruct(_have.x[i], readAll(t)))
 						}
 					}
+				case *packetDataObject:
+					want := output.Data.(*packetDataObject).x
+					assert.Equal(t, deconstruct(want, readAll(t)), deconstruct(_have.x, readAll(t)))
 				}
 			}
 		},
@@ -245,6 +257,28 @@ func TestPacketV4(t *testing.T) {
 				func(d *testData) { d.err = nil },
 			}
 		},
+		"BINARY EVENT with nested placeholders": func(*testing.T) []testDataOptFunc {
+			asBytes := [][]byte{
+				[]byte(`52-["upload",{"file":{"_placeholder":true,"num":0},"meta":{"parts":[{"_placeholder":true,"num":1}],"type":"png"}}]`),
+				{0x01, 0x02, 0x03},
+				{0x04, 0x05},
+			}
+			asPacket := *NewPacketV4().
+				WithType(BinaryEventPacket.Byte()).
+				WithNamespace("/").
+				WithData([]interface{}{"upload", map[string]interface{}{
+					"file": bytes.NewReader([]byte{0x01, 0x02, 0x03}),
+					"meta": map[string]interface{}{
+						"parts": []interface{}{bytes.NewReader([]byte{0x04, 0x05})},
+						"type":  "png",
+					},
+				}}).(*PacketV4)
+			return []testDataOptFunc{
+				func(d *testData) { d.rawPacket = asPacket },
+				func(d *testData) { d.rawByteSlice = asBytes },
+				func(d *testData) { d.err = nil },
+			}
+		},
 		"BINARY ACK": func(*testing.T) []testDataOptFunc {
 			asBytes := [][]byte{
 				[]byte(`61-/admin,456[{"_placeholder":true,"num":0}]`),
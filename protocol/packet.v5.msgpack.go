@@ -0,0 +1,233 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// The socket.io-msgpack-parser encodes the whole packet as a msgpack map in a single
+// binary frame, so binary data is sent in place instead of as attachments. There are
+// no BINARY_EVENT or BINARY_ACK packet types, the EVENT and ACK types are used.
+//
+// https://github.com/socketio/socket.io-msgpack-parser
+
+var _ Packet = &PacketV5Msgpack{}
+
+type PacketV5Msgpack struct {
+	packet
+
+	frame struct {
+		b   []byte // the encoded packet, binary data can only be read once so it's kept
+		off int
+		err error
+	}
+}
+
+// msgpackPacket is the msgpack wire format of a packet
+type msgpackPacket struct {
+	Type      packetType  `msgpack:"type"`
+	Data      interface{} `msgpack:"data,omitempty"`
+	Namespace string      `msgpack:"nsp"`
+	AckID     uint64      `msgpack:"id,omitempty"`
+}
+
+func NewPacketV5Msgpack() Packet {
+	pac := &PacketV5Msgpack{}
+	pac.init()
+	return pac
+}
+
+func (pac *PacketV5Msgpack) init() {
+	pac.packet.ket = func() Packet { return pac }
+}
+
+// IsBinaryFrame reports that the packet is written out as a binary frame, instead of
+// a text frame.
+func (pac *PacketV5Msgpack) IsBinaryFrame() bool { return true }
+
+// GetAttachments returns nothing, because binary data is encoded in place.
+func (pac *PacketV5Msgpack) GetAttachments() []io.Reader { return nil }
+
+// Len returns the length of the encoded packet.
+func (pac *PacketV5Msgpack) Len() int {
+	b, _ := pac.encode()
+	return len(b)
+}
+
+//
+// provides the io.ReaderFrom/io.WriterTo interface for writing data
+// to the underlining engineio packet
+//
+
+func (pac *PacketV5Msgpack) ReadFrom(r io.Reader) (n int64, err error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return int64(len(b)), ErrReadFailed.F(err)
+	}
+	return int64(len(b)), pac.decode(b)
+}
+
+func (pac *PacketV5Msgpack) WriteTo(w io.Writer) (n int64, err error) {
+	b, err := pac.encode()
+	if err != nil {
+		return 0, err
+	}
+	m, err := w.Write(b[pac.frame.off:])
+	pac.frame.off += m
+	return int64(m), err
+}
+
+func (pac *PacketV5Msgpack) Read(p []byte) (n int, err error) {
+	b, err := pac.encode()
+	if err != nil {
+		return 0, err
+	}
+	if pac.frame.off >= len(b) {
+		return 0, io.EOF
+	}
+	n = copy(p, b[pac.frame.off:])
+	pac.frame.off += n
+	return n, nil
+}
+
+// encode returns the packet as msgpack, it's only encoded the first time
+func (pac *PacketV5Msgpack) encode() ([]byte, error) {
+	if pac.frame.b != nil || pac.frame.err != nil {
+		return pac.frame.b, pac.frame.err
+	}
+
+	var data interface{}
+	if pac.Data != nil {
+		if data, pac.frame.err = ToMsgpack(pac.GetData()); pac.frame.err != nil {
+			return nil, pac.frame.err
+		}
+	}
+
+	var _type = pac.Type
+	switch _type {
+	case BinaryEventPacket:
+		_type = EventPacket
+	case BinaryAckPacket:
+		_type = AckPacket
+	}
+
+	var buf = new(bytes.Buffer)
+	// compact encoding uses the smallest int format, the same as the JS parser
+	var enc = msgpack.NewEncoder(buf).SortMapKeys(true).UseCompactEncoding(true)
+	if err := enc.Encode(msgpackPacket{Type: _type, Data: data, Namespace: pac.namespace(), AckID: uint64(pac.AckID)}); err != nil {
+		pac.frame.err = ErrEncodeFieldFailed.F(err)
+		return nil, pac.frame.err
+	}
+	pac.frame.b = buf.Bytes()
+	return pac.frame.b, nil
+}
+
+func (pac *PacketV5Msgpack) decode(b []byte) error {
+	var v msgpackPacket
+	if err := msgpack.NewDecoder(bytes.NewReader(b)).UseDecodeInterfaceLoose(true).Decode(&v); err != nil {
+		return ErrDecodeFieldFailed.F(err)
+	}
+
+	if v.Type > ErrorPacket {
+		return ErrDecodePacketType.F(v.Type)
+	}
+
+	pac.Type = v.Type
+	pac.Namespace = packetNS(v.Namespace)
+	pac.AckID = packetAckID(v.AckID)
+	pac.Data = withPacketData(FromMsgpack(v.Data))
+	return nil
+}
+
+// namespace returns the namespace of the packet, which is always sent
+func (pac *PacketV5Msgpack) namespace() string {
+	if pac.Namespace == "" {
+		return "/"
+	}
+	return string(pac.Namespace)
+}
+
+// ToMsgpack returns the data with any binary data as []byte, and anything else that
+// isn't a basic type is converted through its JSON form. The transport adaptors use it
+// to pass the packet data between servers.
+func ToMsgpack(data interface{}) (interface{}, error) {
+	switch val := data.(type) {
+	case nil, string, bool, []byte,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return val, nil
+	case io.Reader:
+		b, err := io.ReadAll(val)
+		if err != nil {
+			return nil, ErrReadFailed.F(err)
+		}
+		return b, nil
+	case []interface{}:
+		rtn := make([]interface{}, len(val))
+		for i, v := range val {
+			var err error
+			if rtn[i], err = ToMsgpack(v); err != nil {
+				return nil, err
+			}
+		}
+		return rtn, nil
+	case map[string]interface{}:
+		rtn := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			var err error
+			if rtn[k], err = ToMsgpack(v); err != nil {
+				return nil, err
+			}
+		}
+		return rtn, nil
+	case error:
+		return val.Error(), nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, ErrMarshalDataFailed.F(err).KV("msgpack", "data")
+	}
+	var rtn interface{}
+	if err := json.Unmarshal(b, &rtn); err != nil {
+		return nil, ErrMarshalDataFailed.F(err).KV("msgpack", "data")
+	}
+	return rtn, nil
+}
+
+// FromMsgpack returns the decoded data the same as it would be from JSON, except
+// that binary data is an io.Reader the same as an attachment. It's the reverse of ToMsgpack.
+func FromMsgpack(data interface{}) interface{} {
+	switch val := data.(type) {
+	case []byte:
+		return bytes.NewReader(val)
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case float32:
+		return float64(val)
+	case []interface{}:
+		for i, v := range val {
+			val[i] = FromMsgpack(v)
+		}
+		return val
+	case map[string]interface{}:
+		for k, v := range val {
+			val[k] = FromMsgpack(v)
+		}
+		return val
+	case map[interface{}]interface{}:
+		rtn := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			rtn[fmt.Sprint(k)] = FromMsgpack(v)
+		}
+		return rtn
+	}
+	return data
+}
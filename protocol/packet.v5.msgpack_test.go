@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// msgpackHex returns the bytes of the hex string, spaces are ignored
+func msgpackHex(t *testing.T, str string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(str, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPacketV5Msgpack(t *testing.T) {
+	// the bytes are the same as the socket.io-msgpack-parser, the keys are in the same order
+	tests := map[string]struct {
+		packet Packet
+		frame  string
+	}{
+		"EVENT": {
+			packet: NewPacketV5Msgpack().WithType(EventPacket.Byte()).WithNamespace("/").WithData([]interface{}{"hello"}),
+			frame:  "83 a474797065 02 a464617461 91 a568656c6c6f a36e7370 a12f",
+		},
+		"BINARY EVENT with an ack": {
+			packet: NewPacketV5Msgpack().WithType(BinaryEventPacket.Byte()).WithAckID(1).WithData([]interface{}{"file", bytes.NewReader([]byte{0x01, 0x02, 0x03})}),
+			frame:  "84 a474797065 02 a464617461 92 a466696c65 c403010203 a36e7370 a12f a26964 01",
+		},
+		"CONNECT with a namespace": {
+			packet: NewPacketV5Msgpack().WithType(ConnectPacket.Byte()).WithNamespace("/chat"),
+			frame:  "82 a474797065 00 a36e7370 a52f63686174",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name+".Read", func(t *testing.T) {
+			have, err := io.ReadAll(test.packet.(io.Reader))
+			assert.NoError(t, err)
+			assert.Equal(t, msgpackHex(t, test.frame), have)
+		})
+	}
+
+	t.Run("ReadFrom", func(t *testing.T) {
+		var pac = NewPacketV5Msgpack().(*PacketV5Msgpack)
+		_, err := pac.ReadFrom(bytes.NewReader(msgpackHex(t, "84 a474797065 02 a464617461 93 a675706c6f6164 c403010203 81 a473697a65 03 a36e7370 a52f63686174 a26964 cd0100")))
+		assert.NoError(t, err)
+
+		assert.Equal(t, EventPacket.Byte(), pac.GetType())
+		assert.Equal(t, "/chat", pac.GetNamespace())
+		assert.Equal(t, uint64(256), pac.GetAckID())
+
+		data, ok := pac.GetData().([]interface{})
+		if assert.True(t, ok) && assert.Len(t, data, 3) {
+			assert.Equal(t, "upload", data[0])
+			assert.Equal(t, map[string]interface{}{"size": float64(3)}, data[2], "numbers are the same as JSON")
+
+			file, err := io.ReadAll(data[1].(io.Reader))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x01, 0x02, 0x03}, file)
+		}
+	})
+
+	t.Run("ReadFrom with a bad type", func(t *testing.T) {
+		var pac = NewPacketV5Msgpack().(*PacketV5Msgpack)
+		_, err := pac.ReadFrom(bytes.NewReader(msgpackHex(t, "82 a474797065 05 a36e7370 a12f")))
+		assert.ErrorIs(t, err, ErrDecodePacketType)
+	})
+}
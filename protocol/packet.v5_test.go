@@ -100,9 +100,12 @@ func TestPacketV5(t *testing.T) {
 
 							assert.Equal(t, wantb, haveb)
 						default:
-							assert.EqualValues(t, wantx, _have.x[i])
+							assert.EqualValues(t, deconstruct(wantx, readAll(t)), deconstruct(_have.x[i], readAll(t)))
 						}
 					}
+				case *packetDataObject:
+					want := output.Data.(*packetDataObject).x
+					assert.EqualValues(t, deconstruct(want, readAll(t)), deconstruct(_have.x, readAll(t)))
 				}
 			}
 		},
@@ -263,6 +266,28 @@ func TestPacketV5(t *testing.T) {
 				func(d *testData) { d.err = nil },
 			}
 		},
+		"BINARY EVENT with nested placeholders": func(*testing.T) []testDataOptFunc {
+			asBytes := [][]byte{
+				[]byte(`52-["upload",{"file":{"_placeholder":true,"num":0},"meta":{"parts":[{"_placeholder":true,"num":1}],"type":"png"}}]`),
+				{0x01, 0x02, 0x03},
+				{0x04, 0x05},
+			}
+			asPacket := *NewPacketV5().
+				WithType(BinaryEventPacket.Byte()).
+				WithNamespace("/").
+				WithData([]interface{}{"upload", map[string]interface{}{
+					"file": bytes.NewReader([]byte{0x01, 0x02, 0x03}),
+					"meta": map[string]interface{}{
+						"parts": []interface{}{bytes.NewReader([]byte{0x04, 0x05})},
+						"type":  "png",
+					},
+				}}).(*PacketV5)
+			return []testDataOptFunc{
+				func(d *testData) { d.rawPacket = asPacket },
+				func(d *testData) { d.rawByteSlice = asBytes },
+				func(d *testData) { d.err = nil },
+			}
+		},
 		"BINARY ACK": func(*testing.T) []testDataOptFunc {
 			asBytes := [][]byte{
 				[]byte(`61-/admin,456[{"_placeholder":true,"num":0}]`),
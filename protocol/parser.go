@@ -0,0 +1,22 @@
+package protocol
+
+// Frame is a single engine.io message of an encoded packet, it's either a text or a
+// binary message.
+type Frame struct {
+	Binary bool
+	Data   []byte
+}
+
+// Parser encodes and decodes the socket.io packets, so that a custom encoding can be
+// used in place of the socket.io protocol encoding. It's the same as a custom parser
+// for the socket.io server, so the clients must use the same parser.
+//
+// The packet passed to Encode can have io.Reader values anywhere in the data for binary
+// data, it's up to the parser how they are sent. Decode is passed all of the frames that
+// have been received since the last packet was decoded, it returns a nil packet and no
+// error when more frames are needed to make up the packet. The packets that are returned
+// from Decode can be created with any of the NewPacket functions.
+type Parser interface {
+	Encode(Packet) ([]Frame, error)
+	Decode([]Frame) (Packet, error)
+}
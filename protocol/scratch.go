@@ -103,26 +103,18 @@ func applyAttachments(data packetData, in *binaryStreamIn, out *binaryStreamOut)
 	return func(p []byte) stateFn {
 		return func(scr *scratch) stateFn {
 
+			var rdr []io.Reader
+			collect := func(r io.Reader) interface{} { rdr = append(rdr, r); return r }
+
 			switch field := data.(type) {
 			case *packetDataArray:
-				var num int
-				for _, item := range field.x {
-					if r, ok := item.(io.Reader); ok {
-						out.rdr = append(out.rdr, r)
-						num++
-					}
-				}
-				*in = make(binaryStreamIn, num)
+				deconstruct(field.x, collect)
+				*in = make(binaryStreamIn, len(rdr))
 			case *packetDataObject:
-				var num int
-				for _, item := range field.x {
-					if r, ok := item.(io.Reader); ok {
-						out.rdr = append(out.rdr, r)
-						num++
-					}
-				}
-				*in = make(binaryStreamIn, num)
+				deconstruct(field.x, collect)
+				*in = make(binaryStreamIn, len(rdr))
 			}
+			out.rdr = append(out.rdr, rdr...)
 
 			return readFromPacket(in)(p)
 		}
@@ -10,6 +10,8 @@ import (
 type Request struct {
 	r *http.Request
 
+	session context.Context // done once the session has closed, when the packets are queued
+
 	Method     string
 	URL        *url.URL
 	Header     http.Header
@@ -28,6 +30,22 @@ func (req *Request) WithContext(ctx context.Context) *Request {
 	return req
 }
 
+// sessionContext returns the context that is done once the socket can no longer be
+// waited on, which is the HTTP request when the packets are handled on the request.
+func (req *Request) sessionContext() context.Context {
+	if req.session != nil {
+		return req.session
+	}
+	return req.r.Context()
+}
+
+// withSession returns a copy of the request for the packets that are queued for the session
+func (req *Request) withSession(ctx context.Context) *Request {
+	rtn := *req
+	rtn.session = ctx
+	return &rtn
+}
+
 func sioRequest(r *http.Request) *Request {
 	req := &Request{
 		r:          r,
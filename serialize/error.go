@@ -5,6 +5,7 @@ import (
 )
 
 const (
-	ErrUnsupportedUseRead erro.String = "Serialize() method unsupported, use the Read() method instead"
-	ErrUnsupported        erro.State  = "method: unsupported"
+	ErrUnsupportedUseRead erro.String  = "Serialize() method unsupported, use the Read() method instead"
+	ErrUnsupported        erro.State   = "method: unsupported"
+	ErrUnsupportedKind    erro.StringF = "unsupported kind: %T is not a slice or array"
 )
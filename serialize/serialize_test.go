@@ -231,3 +231,59 @@ func ExampleSerializable_custom() {
 	// crust:thin top:cheese,pepperoni <nil>
 	// &{cheese [mozzarella gorgonzola goat parmesan]}
 }
+
+type order struct {
+	ID      int               `json:"id"`
+	Items   []string          `json:"items,omitempty"`
+	Note    string            `json:"-"`
+	Receipt []byte            `json:"receipt"`
+	Meta    map[string]string `json:"meta"`
+}
+
+func ExampleSerializable_struct() {
+
+	o := Struct(order{ID: 10, Items: []string{"cheese"}, Receipt: []byte("PDF"), Meta: map[string]string{"by": "phone"}})
+	fmt.Println(o.Serialize())
+
+	// binary fields are io.Reader values in the Interface() data
+	data := o.Interface().(map[string]interface{})
+	fmt.Println(data["id"], data["items"], data["meta"])
+	io.Copy(os.Stdout, data["receipt"].(io.Reader))
+	fmt.Println()
+
+	// unserialize into a typed pointer
+	var in order
+	Struct(&in).Unserialize(`{"id":11,"items":["pepperoni"],"meta":{"by":"web"}}`)
+	fmt.Printf("%d %v %v\n", in.ID, in.Items, in.Meta)
+
+	// Output:
+	// {"id":10,"items":["cheese"],"receipt":"UERG","meta":{"by":"phone"}} <nil>
+	// 10 [cheese] map[by:phone]
+	// PDF
+	// 11 [pepperoni] map[by:web]
+}
+
+func ExampleSerializable_slice() {
+
+	s := Slice([]order{{ID: 1}, {ID: 2, Receipt: []byte("PNG")}})
+	fmt.Println(s.Serialize())
+
+	data := s.Interface().([]interface{})
+	fmt.Println(len(data), data[0].(map[string]interface{})["receipt"])
+	io.Copy(os.Stdout, data[1].(map[string]interface{})["receipt"].(io.Reader))
+	fmt.Println()
+
+	var in []order
+	Slice(&in).Unserialize(`[{"id":3},{"id":4}]`)
+	fmt.Println(len(in), in[0].ID, in[1].ID)
+
+	_, err := Slice(order{}).Serialize()
+	fmt.Println(err)
+
+	// Output:
+	// [{"id":1,"receipt":null,"meta":null},{"id":2,"receipt":"UE5H","meta":null}] <nil>
+	// 2 <nil>
+	// PNG
+	// 2 3 4
+	// unsupported kind: serialize.order is not a slice or array
+}
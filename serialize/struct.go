@@ -0,0 +1,240 @@
+package serialize
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	readerType        = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type (
+	_struct struct{ v interface{} }
+	_slice  struct{ v interface{} }
+)
+
+// Struct wraps any Go value so that it can be emitted without building a map by hand. The
+// value is serialized through its json tags (json.Marshaler is honored), and unserialized
+// into the value when it's a pointer. The Interface() method returns the value as generic
+// maps and slices where any nested io.Reader or []byte fields are io.Reader values, which
+// are sent as binary attachments.
+//
+//	socket.Emit("order", serialize.Struct(Order{ID: 1, Receipt: pdf}))
+//
+//	var order Order
+//	serialize.Struct(&order).Unserialize(`{"id":1}`)
+func Struct(v interface{}) *_struct                   { return &_struct{v} }
+func (x *_struct) String() (str string)               { str, _ = x.Serialize(); return }
+func (x *_struct) Serialize() (str string, err error) { return marshal(x.v) }
+func (x *_struct) Unserialize(str string) (err error) { return unmarshal(str, &x.v) }
+func (x *_struct) Interface() (v interface{})         { return tree(reflect.ValueOf(x.v)) }
+func (x *_struct) MarshalJSON() (b []byte, err error) { return json.Marshal(x.v) }
+
+// Slice is the same as Struct for slices and arrays. It returns an error from the Serialize
+// method when the value isn't a slice or array, or a pointer to one.
+func Slice(v interface{}) *_slice                    { return &_slice{v} }
+func (x *_slice) String() (str string)               { str, _ = x.Serialize(); return }
+func (x *_slice) Interface() (v interface{})         { return tree(reflect.ValueOf(x.v)) }
+func (x *_slice) MarshalJSON() (b []byte, err error) { return json.Marshal(x.v) }
+func (x *_slice) Serialize() (str string, err error) {
+	switch reflect.Indirect(reflect.ValueOf(x.v)).Kind() {
+	case reflect.Slice, reflect.Array:
+		return marshal(x.v)
+	}
+	return "", ErrUnsupportedKind.F(x.v)
+}
+func (x *_slice) Unserialize(str string) (err error) {
+	if x.v == nil {
+		var a []interface{}
+		err = json.Unmarshal([]byte(str), &a)
+		x.v = a
+		return err
+	}
+	return unmarshal(str, &x.v)
+}
+
+func marshal(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// unmarshal decodes the str into the value that v points to when it's a non-nil pointer,
+// otherwise v is replaced with the generic decoded value.
+func unmarshal(str string, v *interface{}) error {
+	if val := reflect.ValueOf(*v); val.Kind() == reflect.Ptr && !val.IsNil() {
+		return json.Unmarshal([]byte(str), *v)
+	}
+	return json.Unmarshal([]byte(str), v)
+}
+
+// tree returns the value as map[string]interface{} and []interface{} values following the
+// encoding/json rules, with io.Reader and []byte values as io.Reader values. Values that
+// implement json.Marshaler or encoding.TextMarshaler are returned as is.
+func tree(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	typ := v.Type()
+	if typ.Implements(readerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil
+		}
+		return v.Interface()
+	}
+	if typ.Implements(jsonMarshalerType) || typ.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	if v.CanAddr() {
+		if ptr := reflect.PtrTo(typ); ptr.Implements(jsonMarshalerType) || ptr.Implements(textMarshalerType) {
+			return v.Addr().Interface()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return tree(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return bytes.NewReader(v.Bytes())
+		}
+		fallthrough
+	case reflect.Array:
+		rtn := make([]interface{}, v.Len())
+		for i := range rtn {
+			rtn[i] = tree(v.Index(i))
+		}
+		return rtn
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		rtn := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			rtn[mapKey(iter.Key())] = tree(iter.Value())
+		}
+		return rtn
+	case reflect.Struct:
+		rtn := make(map[string]interface{}, v.NumField())
+		treeStruct(v, rtn)
+		return rtn
+	}
+	return v.Interface()
+}
+
+// treeStruct adds the exported fields of the struct to m using the json tag names. Fields of
+// embedded structs are added after, so that they never replace a field of the outer struct.
+func treeStruct(v reflect.Value, m map[string]interface{}) {
+	var embedded []reflect.Value
+
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field, val := typ.Field(i), v.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx:]
+		}
+
+		if field.Anonymous && name == "" {
+			if ft := field.Type; ft.Kind() == reflect.Struct || (ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct) {
+				if val = reflect.Indirect(val); val.IsValid() {
+					embedded = append(embedded, val)
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if strings.Contains(opts, ",omitempty") && isEmptyValue(val) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		x := tree(val)
+		if strings.Contains(opts, ",string") {
+			switch reflect.Indirect(val).Kind() {
+			case reflect.Bool, reflect.Float32, reflect.Float64, reflect.String,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				b, _ := json.Marshal(x)
+				x = string(b)
+			}
+		}
+		m[name] = x
+	}
+
+	for _, val := range embedded {
+		em := make(map[string]interface{}, val.NumField())
+		treeStruct(val, em)
+		for k, x := range em {
+			if _, ok := m[k]; !ok {
+				m[k] = x
+			}
+		}
+	}
+}
+
+func mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		b, _ := tm.MarshalText()
+		return string(b)
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
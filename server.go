@@ -20,9 +20,54 @@ const (
 )
 
 const (
-	OnDisconnectEvent = "disconnect"
+	OnDisconnectEvent    = "disconnect"
+	OnDisconnectingEvent = "disconnecting"
 )
 
+// DisconnectReason is the reason that is passed to the OnDisconnecting and
+// OnDisconnect callbacks when a socket leaves a namespace.
+type DisconnectReason string
+
+const (
+	TransportClose            DisconnectReason = "transport close"             // the client closed the connection
+	TransportError            DisconnectReason = "transport error"             // the connection failed
+	PingTimeout               DisconnectReason = "ping timeout"                // the client didn't respond to a ping in time
+	ParseError                DisconnectReason = "parse error"                 // the client sent data that couldn't be decoded
+	ServerShuttingDown        DisconnectReason = "server shutting down"        // the server closed the session
+	ClientNamespaceDisconnect DisconnectReason = "client namespace disconnect" // the client sent a DISCONNECT packet
+	ServerNamespaceDisconnect DisconnectReason = "server namespace disconnect" // the server disconnected the socket
+)
+
+func (r DisconnectReason) String() string { return string(r) }
+
+// disconnectReason returns the reason for an ended EngineIO session, the reasons that aren't
+// known are taken as the connection being closed.
+func disconnectReason(reason eios.CloseReason) DisconnectReason {
+	switch reason {
+	case eios.TransportClose:
+		return TransportClose
+	case eios.TransportError:
+		return TransportError
+	case eios.ParseError:
+		return ParseError
+	case eios.PingTimeout:
+		return PingTimeout
+	case eios.ForcedClose:
+		return ServerShuttingDown
+	}
+	return TransportClose // the session ended without a known reason
+}
+
+// recoverable returns true when the connection state can be recovered after
+// the socket is disconnected with the reason.
+func (r DisconnectReason) recoverable() bool {
+	switch r {
+	case TransportClose, TransportError, PingTimeout:
+		return true
+	}
+	return false
+}
+
 type (
 	// SocketID is am alias of a session id, so that we don't need to
 	// reference sessions through the package
@@ -46,6 +91,24 @@ type eventCallback interface {
 	Callback(...interface{}) error
 }
 
+// eventCallbackAck is the callback that is used when an event is called with an
+// acknowledgement ID, the returned values are sent back to the client
+type eventCallbackAck interface {
+	CallbackAck(...interface{}) []interface{}
+}
+
+// eventCallbackAckErr is an eventCallbackAck that can fail, the acknowledgement
+// is not sent back to the client when there is an error
+type eventCallbackAckErr interface {
+	CallbackAckErr(...interface{}) ([]interface{}, error)
+}
+
+// eventAnyCallback is the callback that is used for every event that is received or emitted
+type eventAnyCallback = func(event Event, args ...interface{})
+
+// eventMiddleware is the middleware that is run before the callback of an incoming event
+type eventMiddleware = func(event Event, args []interface{}, next func(error))
+
 // inToEmit is an interface used to limit the next chained method to In, To or Emit
 type inToEmit interface {
 	In(room Room) inToEmit
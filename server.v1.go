@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	nmem "github.com/njones/socketio/adaptor/transport/memory"
 	eio "github.com/njones/socketio/engineio"
@@ -24,11 +26,12 @@ import (
 type ServerV1 struct {
 	inSocketV1
 
-	run                func(socketID SocketID, req *Request) error
+	run                func(socketID SocketID, sessionID SessionID, req *Request) error
 	doConnectPacket    func(socketID SocketID, socket siot.Socket, req *Request) error
 	doDisconnectPacket func(socketID SocketID, socket siot.Socket, req *Request) error
-	doEventPacket      func(socketID SocketID, socket siot.Socket) error
+	doEventPacket      func(socketID SocketID, socket siot.Socket, req *Request) error
 	doAckPacket        func(socketID SocketID, socket siot.Socket) error
+	doSessionClose     func(sessionID SessionID, reason DisconnectReason)
 
 	path *string
 
@@ -36,6 +39,10 @@ type ServerV1 struct {
 	eio eio.EIOServer
 
 	transport siot.Transporter
+	queues    *sessionQueues // the packets of each session that are handled in order
+
+	shuttingDown int32 // set by Shutdown, new handshakes are refused
+	active       int64 // the number of ServeHTTP handlers that are running
 }
 
 // NewServerV1 returns a new v1.0 SocketIO server
@@ -46,6 +53,7 @@ func NewServerV1(opts ...Option) *ServerV1 {
 	v1.eio = eio.NewServerV2(
 		eio.WithPath(*v1.path),
 		eio.WithInitialPackets(autoConnect(v1)),
+		eio.WithSessionClose(sessionClose(v1)),
 	).(eio.EIOServer)
 	v1.eio.With(opts...)
 
@@ -63,10 +71,15 @@ func (v1 *ServerV1) new(opts ...Option) Server {
 	v1.doDisconnectPacket = doDisconnectPacket(v1)
 	v1.doEventPacket = doEventPacket(v1)
 	v1.doAckPacket = doAckPacket(v1)
+	v1.doSessionClose = doSessionClose(v1)
+	v1.queues = new(sessionQueues)
 
 	v1.ns = "/"
 	v1.path = ampersand("/socket.io/")
-	v1.events = make(map[Namespace]map[Event]map[SocketID]eventCallback)
+	v1.events = make(map[Namespace]map[Event]map[SocketID][]*listener)
+	v1.incoming = make(map[Namespace]map[SocketID][]eventMiddleware)
+	v1.anyIncoming = make(map[Namespace]map[SocketID][]*anyListener)
+	v1.anyOutgoing = make(map[Namespace]map[SocketID][]*anyListener)
 	v1.onConnect = make(map[Namespace]onConnectCallbackVersion1)
 
 	v1.protectedEventName = v1ProtectedEventName
@@ -105,6 +118,15 @@ func (v1 *ServerV1) To(room Room) inToEmit {
 	return rtn.To(room)
 }
 
+// VolatileDropped returns the number of volatile packets that were dropped, because
+// the transport was not writable when they were emitted.
+func (v1 *ServerV1) VolatileDropped() uint64 {
+	if sender, ok := v1.transport.(siot.VolatileSender); ok {
+		return sender.Dropped()
+	}
+	return 0
+}
+
 // ServeHTTP is the interface for applying a http request/response cycle. This handles
 // errors that can be provided by the underlining serveHTTP method that uses errors.
 func (v1 *ServerV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -112,6 +134,14 @@ func (v1 *ServerV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	atomic.AddInt64(&v1.active, 1)
+	defer atomic.AddInt64(&v1.active, -1)
+
+	if atomic.LoadInt32(&v1.shuttingDown) == 1 && r.URL.Query().Get("sid") == "" {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
 	ctx := r.Context()
 	if v1.ctx != nil {
 		ctx = v1.ctx
@@ -122,6 +152,9 @@ func (v1 *ServerV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.As(err, &eState):
 			return
+		case errors.Is(err, erro.HTTPStatusError503):
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
 		case errors.Is(err, erro.HTTPStatusError400):
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
@@ -131,19 +164,63 @@ func (v1 *ServerV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Shutdown gracefully shuts down the server. New handshakes are refused with a 503 Service
+// Unavailable, every socket is sent a DISCONNECT packet for each of its namespaces, and then
+// the EngineIO sessions are closed after the packets that are waiting to be sent have been
+// flushed. The OnDisconnect callbacks get ServerShuttingDown. It waits for the sessions to
+// end and the running handlers to return, until the ctx is done. It can be registered with
+// an http.Server, so that it runs when the http.Server is shut down:
+//
+//	srv.RegisterOnShutdown(func() { server.Shutdown(ctx) })
+func (v1 *ServerV1) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&v1.shuttingDown, 1)
+
+	transport := v1.tr()
+	namespacer, ok := transport.(siot.Namespacer)
+	emitter, ok2 := transport.(siot.Emitter)
+	if ok && ok2 {
+		for _, namespace := range namespacer.Namespaces() {
+			for _, socketID := range emitter.Sockets(namespace).IDs() {
+				// a socket that is waiting on the connection state recovery can't be sent the packet
+				transport.Send(socketID, nil, siop.WithType(siop.DisconnectPacket.Byte()), siop.WithNamespace(namespace))
+				v1.disconnectSocket(namespace, socketID, ServerShuttingDown, true)
+			}
+		}
+	}
+
+	if err := v1.eio.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&v1.active) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 // serveHTTP is the same as ServeHTTP but uses errors to break out of request cycles that
 // have an error. The response is handled in the upper ServeHTTP method.
 func (v1 *ServerV1) serveHTTP(w http.ResponseWriter, r *http.Request) (err error) {
-	eioTransport, err := v1.eio.ServeTransport(w, r)
+	runErr := make(chan error, 1)
+	eioTransport, err := v1.eio.ServeTransport(w, eio.WithTransportRun(r, runErr))
 	if err != nil {
 		return err
 	}
+	// the EngineIO transport writes to w until it's done, so this doesn't return before it is
+	defer func() { <-runErr }()
 
 	sid, err := v1.transport.Add(eioTransport)
 	if err != nil {
 		return err
 	}
-	v1.setSocketID(sid)
 
-	return v1.run(sid, sioRequest(r))
+	// the socket id is passed to run by value, the packets are handled on their own goroutine
+	return v1.run(sid, eioTransport.ID(), sioRequest(r))
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	eios "github.com/njones/socketio/engineio/session"
 	eiot "github.com/njones/socketio/engineio/transport"
 	siop "github.com/njones/socketio/protocol"
 	siot "github.com/njones/socketio/transport"
@@ -33,10 +34,11 @@ func autoConnect(v1 *ServerV1) func(transport eiot.Transporter, r *http.Request)
 // runV1 are the callbacks that are used for version 1 of the server based on the
 // receive of the transport and the packet type. This can be different for the
 // different server versions.
-func runV1(v1 *ServerV1) func(SocketID, *Request) error {
-	return func(socketID SocketID, req *Request) error {
+func runV1(v1 *ServerV1) func(SocketID, SessionID, *Request) error {
+	return func(socketID SocketID, _ SessionID, req *Request) error {
+		handle := closeAttachments(func(socketID SocketID, socket siot.Socket) error { return doV1(v1, socketID, socket, req) })
 		for socket := range v1.tr().Receive(socketID) {
-			if err := doV1(v1, socketID, socket, req); err != nil {
+			if err := handle(socketID, socket); err != nil {
 				return err
 			}
 		}
@@ -44,6 +46,32 @@ func runV1(v1 *ServerV1) func(SocketID, *Request) error {
 	}
 }
 
+// sessionClose is called by EngineIO after a session has ended, the reason is passed on
+// to the doSessionClose function of the server.
+func sessionClose(v1 *ServerV1) func(SessionID, eios.CloseReason) {
+	return func(sessionID SessionID, reason eios.CloseReason) {
+		v1.doSessionClose(sessionID, disconnectReason(reason))
+	}
+}
+
+// doSessionClose disconnects the socket of the ended session from all of the namespaces
+// that it's still in, the socket leaves all of its rooms.
+func doSessionClose(v1 *ServerV1) func(SessionID, DisconnectReason) {
+	return func(sessionID SessionID, reason DisconnectReason) {
+		closer, ok := v1.tr().(siot.SessionCloser)
+		if !ok {
+			v1.queues.close(sessionID)
+			return
+		}
+
+		socketID, namespaces := closer.CloseSession(sessionID)
+		v1.drainSession(sessionID, socketID, namespaces)
+		for _, namespace := range namespaces {
+			v1.disconnectSocket(namespace, socketID, reason, true)
+		}
+	}
+}
+
 func doV1(v1 *ServerV1, socketID SocketID, socket siot.Socket, req *Request) error {
 	switch socket.Type {
 	case siop.ConnectPacket.Byte():
@@ -58,7 +86,7 @@ func doV1(v1 *ServerV1, socketID SocketID, socket siot.Socket, req *Request) err
 			v1.tr().Send(socketID, serviceError(err), siop.WithType(siop.ErrorPacket.Byte()))
 		}
 	case siop.EventPacket.Byte():
-		if err := v1.doEventPacket(socketID, socket); err != nil {
+		if err := v1.doEventPacket(socketID, socket, req); err != nil {
 			v1.tr().Send(socketID, serviceError(err), siop.WithType(siop.ErrorPacket.Byte()))
 		}
 	case siop.AckPacket.Byte():
@@ -99,25 +127,21 @@ func doConnectPacket(v1 *ServerV1) func(SocketID, siot.Socket, *Request) error {
 
 func doDisconnectPacket(v1 *ServerV1) func(SocketID, siot.Socket, *Request) error {
 	return func(socketID SocketID, socket siot.Socket, req *Request) (err error) {
-		if fn, ok := v1.events[socket.Namespace][OnDisconnectEvent][socketID]; ok {
-			v1.tr().Leave(socket.Namespace, socketID, socketIDPrefix+socketID.String())
-			return fn.Callback("client namespace disconnect")
-		}
-		// for any socket id at the io. (server) level...
-		if fn, ok := v1.events[socket.Namespace][OnDisconnectEvent][serverEvent]; ok {
+		v1.callDisconnect(socket.Namespace, socketID, OnDisconnectingEvent, ClientNamespaceDisconnect)
+		v1.cancelAcks(socket.Namespace, socketID, ErrDisconnectedSocket)
+		v1.removeIncoming(socket.Namespace, socketID)
+		defer v1.removeListeners(socket.Namespace, socketID)
+
+		if ok, err := v1.callDisconnect(socket.Namespace, socketID, OnDisconnectEvent, ClientNamespaceDisconnect); ok {
 			v1.tr().Leave(socket.Namespace, socketID, socketIDPrefix+socketID.String())
-			return fn.Callback("client namespace disconnect")
+			return err
 		}
 		return ErrOnDisconnectSocket
 	}
 }
 
-func doEventPacket(v1 *ServerV1) func(SocketID, siot.Socket) error {
-	return func(socketID SocketID, socket siot.Socket) (err error) {
-		type callbackAck interface {
-			CallbackAck(...interface{}) []interface{}
-		}
-
+func doEventPacket(v1 *ServerV1) func(SocketID, siot.Socket, *Request) error {
+	return func(socketID SocketID, socket siot.Socket, req *Request) (err error) {
 		switch data := socket.Data.(type) {
 		case []interface{}:
 			event, ok := data[0].(string)
@@ -128,23 +152,12 @@ func doEventPacket(v1 *ServerV1) func(SocketID, siot.Socket) error {
 				data = data[1:]
 			}
 
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				if socket.AckID > 0 {
-					if fn, ok := fn.(callbackAck); ok {
-						vals := fn.CallbackAck(data...)
-						return v1.tr().Send(socketID, vals, siop.WithNamespace(socket.Namespace), siop.WithAckID(socket.AckID), siop.WithType(byte(siop.AckPacket)))
-					}
-				}
-				return fn.Callback(data...)
+			if err := v1.incomingMiddleware(req.sessionContext(), socket.Namespace, socketID, event, data); err != nil {
+				return v1.sendIncomingError(socketID, socket.Namespace, err)
 			}
-			if fn, ok := v1.events[socket.Namespace][event][serverEvent]; ok {
-				if socket.AckID > 0 {
-					if fn, ok := fn.(callbackAck); ok {
-						vals := fn.CallbackAck(data...)
-						return v1.tr().Send(socketID, vals, siop.WithNamespace(socket.Namespace), siop.WithAckID(socket.AckID), siop.WithType(byte(siop.AckPacket)))
-					}
-				}
-				return fn.Callback(data...)
+
+			if ok, err := v1.callEvent(socketID, socket, event, data, siop.AckPacket.Byte()); ok {
+				return err
 			}
 		case []string:
 			event := data[0]
@@ -152,29 +165,72 @@ func doEventPacket(v1 *ServerV1) func(SocketID, siot.Socket) error {
 				data = data[1:]
 			}
 
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				return fn.Callback(stoi(data)...)
+			args := stoi(data)
+			if err := v1.incomingMiddleware(req.sessionContext(), socket.Namespace, socketID, event, args); err != nil {
+				return v1.sendIncomingError(socketID, socket.Namespace, err)
 			}
-			if fn, ok := v1.events[socket.Namespace][event][serverEvent]; ok {
-				return fn.Callback(stoi(data)...)
+
+			if ok, err := v1.callEvent(socketID, socket, event, args, siop.AckPacket.Byte()); ok {
+				return err
 			}
 		}
 		return ErrUnexpectedData.F(socket.Data).KV("do", "eventPacket")
 	}
 }
 
+// callEvent calls the any callbacks, then each callback of the event in the order that
+// they were registered. The callbacks registered to the socket take the place of the
+// callbacks registered to the server. The first callback that can acknowledge the event
+// sends the ack back to the client. It returns false when there were no callbacks.
+func (v1 *ServerV1) callEvent(socketID SocketID, socket siot.Socket, event Event, args []interface{}, ackType byte) (bool, error) {
+	called := v1.callAny(v1.anyIncoming, socket.Namespace, socketID, event, args)
+
+	callbacks := v1.callbacks(socket.Namespace, event, socketID)
+	if len(callbacks) == 0 {
+		callbacks = v1.callbacks(socket.Namespace, event, serverEvent)
+	}
+
+	var err error
+	var acked bool
+	for _, fn := range callbacks {
+		var e error
+		if ack, ok := fn.(eventCallbackAck); ok && socket.AckID > 0 && !acked {
+			acked = true
+			var vals []interface{}
+			if ackErr, ok := fn.(eventCallbackAckErr); ok {
+				vals, e = ackErr.CallbackAckErr(args...)
+			} else {
+				vals = ack.CallbackAck(args...)
+			}
+			if e == nil {
+				e = v1.tr().Send(socketID, vals, siop.WithNamespace(socket.Namespace), siop.WithAckID(socket.AckID), siop.WithType(ackType))
+			}
+		} else {
+			e = fn.Callback(args...)
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return called || len(callbacks) > 0, err
+}
+
 func doAckPacket(v1 *ServerV1) func(SocketID, siot.Socket) error {
 	return func(socketID SocketID, socket siot.Socket) (err error) {
 		event := fmt.Sprintf("%s%d", ackIDEventPrefix, socket.AckID)
 		switch data := socket.Data.(type) {
 		case []interface{}:
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				return fn.Callback(data...)
+			for _, fn := range v1.callbacks(socket.Namespace, event, socketID) {
+				if e := fn.Callback(data...); e != nil && err == nil {
+					err = e
+				}
 			}
 		case []string:
 			event := data[0]
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				err = fn.Callback(stoi(data)...)
+			for _, fn := range v1.callbacks(socket.Namespace, event, socketID) {
+				if e := fn.Callback(stoi(data)...); e != nil && err == nil {
+					err = e
+				}
 			}
 		default:
 			return ErrUnexpectedData.F(data).KV("do", "ackPacket")
@@ -182,3 +238,10 @@ func doAckPacket(v1 *ServerV1) func(SocketID, siot.Socket) error {
 		return err
 	}
 }
+
+// sendIncomingError emits the error from an incoming event middleware back to the
+// client as an error event, in place of calling the event callback.
+func (v1 *ServerV1) sendIncomingError(socketID SocketID, namespace Namespace, err error) error {
+	data := []interface{}{"error", serviceError(err)}
+	return v1.tr().Send(socketID, data, siop.WithNamespace(namespace), siop.WithType(siop.EventPacket.Byte()))
+}
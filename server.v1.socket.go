@@ -1,10 +1,12 @@
 package socketio
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	call "github.com/njones/socketio/callback"
 	siop "github.com/njones/socketio/protocol"
@@ -42,6 +44,10 @@ type inSocketV1 struct {
 
 	binary   bool
 	compress bool // https://socket.io/blog/socket-io-1-4-0/
+	timeout  time.Duration
+
+	collectAcks bool // each recipient of a broadcast gets their own ack id
+	volatile    bool // drop the packet if the transport is not writable
 
 	tr func() siot.Transporter
 	ns Namespace
@@ -53,7 +59,11 @@ type inSocketV1 struct {
 	protectedEventName map[string]struct{}
 
 	onConnect map[Namespace]onConnectCallbackVersion1
-	events    map[Namespace]map[Event]map[SocketID]eventCallback
+	events    map[Namespace]map[Event]map[SocketID][]*listener
+	incoming  map[Namespace]map[SocketID][]eventMiddleware
+
+	anyIncoming map[Namespace]map[SocketID][]*anyListener
+	anyOutgoing map[Namespace]map[SocketID][]*anyListener
 
 	o atomic.Value
 	ʟ *sync.RWMutex
@@ -71,24 +81,32 @@ func (v1 *inSocketV1) r() func() {
 }
 
 func (v1 *inSocketV1) clone() inSocketV1 {
-	// v1.events and v1.onConnect are initialized in the NewServerV1 method
+	// v1.events, v1.incoming, v1.anyIncoming, v1.anyOutgoing and v1.onConnect are initialized in the NewServerV1 method
 	defer v1.l()()
 
 	rtn := *v1
 	return rtn
 }
 
+// transporter wraps the transport, so that the stored value is always the same type when
+// the transport is replaced with a different one.
+type transporter struct{ siot.Transporter }
+
 func (v1 *inSocketV1) setTransporter(tr siot.Transporter) {
-	v1.o.Store(tr)
+	v1.o.Store(transporter{tr})
 
 	v1.tr = func() siot.Transporter {
-		return v1.o.Load().(siot.Transporter)
+		return v1.o.Load().(transporter).Transporter
 	}
 }
-func (v1 *inSocketV1) setIsServer(isServer bool) { defer v1.l()(); v1.isServer = isServer }
-func (v1 *inSocketV1) setIsSender(isSender bool) { defer v1.l()(); v1.isSender = isSender }
-func (v1 *inSocketV1) setSocketID(id SocketID)   { defer v1.l()(); v1._socketID = id }
-func (v1 *inSocketV1) setPrefix()                { defer v1.l()(); v1._socketPrefix = socketIDQuickPrefix() }
+func (v1 *inSocketV1) setIsServer(isServer bool)   { defer v1.l()(); v1.isServer = isServer }
+func (v1 *inSocketV1) setIsSender(isSender bool)   { defer v1.l()(); v1.isSender = isSender }
+func (v1 *inSocketV1) setSocketID(id SocketID)     { defer v1.l()(); v1._socketID = id }
+func (v1 *inSocketV1) setPrefix()                  { defer v1.l()(); v1._socketPrefix = socketIDQuickPrefix() }
+func (v1 *inSocketV1) setTimeout(d time.Duration)  { defer v1.l()(); v1.timeout = d }
+func (v1 *inSocketV1) setCollectAcks(collect bool) { defer v1.l()(); v1.collectAcks = collect }
+func (v1 *inSocketV1) setVolatile(volatile bool)   { defer v1.l()(); v1.volatile = volatile }
+func (v1 *inSocketV1) setCompress(compress bool)   { defer v1.l()(); v1.compress = compress }
 func (v1 *inSocketV1) setNsp(namespace Namespace) {
 	defer v1.l()()
 
@@ -127,35 +145,467 @@ func (v1 inSocketV1) OnConnect(callback onConnectCallbackVersion1) {
 	v1.onConnect[v1.nsp()] = callback
 }
 
+// OnDisconnect - registers a callback that is called when the socket has disconnected, the
+// reason is the string of one of the DisconnectReason values
 func (v1 inSocketV1) OnDisconnect(callback func(string)) {
-	v1.on("disconnect", call.FuncString(callback))
+	v1.on(OnDisconnectEvent, call.FuncString(callback))
+}
+
+// OnDisconnectReason - is the same as OnDisconnect, with the reason as a DisconnectReason
+func (v1 inSocketV1) OnDisconnectReason(callback func(DisconnectReason)) {
+	v1.on(OnDisconnectEvent, call.FuncString(func(reason string) { callback(DisconnectReason(reason)) }))
 }
 
-func (v1 inSocketV1) On(event Event, callback eventCallback) {
+// OnDisconnecting - registers a callback that is called when the socket is disconnecting,
+// it's called before the socket has left any of its rooms
+func (v1 inSocketV1) OnDisconnecting(callback func(DisconnectReason)) {
+	v1.on(OnDisconnectingEvent, call.FuncString(func(reason string) { callback(DisconnectReason(reason)) }))
+}
+
+// On - registers the callback for the event, it's called after the callbacks that were
+// registered before it
+func (v1 inSocketV1) On(event Event, callback eventCallback) { v1.OnWithOff(event, callback) }
+
+// OnWithOff - registers the callback for the event the same as On, and returns a func that
+// removes this registration
+func (v1 inSocketV1) OnWithOff(event Event, callback eventCallback) (off func()) {
 	if _, ok := v1.protectedEventName[event]; ok {
-		v1.on(event, call.ErrorWrap(func() error { return ErrUnsupportedEventName.F(event) }))
-		return
+		return v1.on(event, call.ErrorWrap(func() error { return ErrUnsupportedEventName.F(event) }))
 	}
-	v1.on(event, callback)
+	return v1.on(event, callback)
 }
 
-func (v1 inSocketV1) on(event Event, callback eventCallback) {
+// Once - registers a callback for the event that is removed after it is called the first time,
+// and returns a func that removes it before then
+func (v1 inSocketV1) Once(event Event, callback eventCallback) (off func()) {
+	if _, ok := v1.protectedEventName[event]; ok {
+		return v1.on(event, call.ErrorWrap(func() error { return ErrUnsupportedEventName.F(event) }))
+	}
+
+	socketID := v1.listenerID()
+	once := &onceCallback{once: new(sync.Once), callback: callback}
+	registered := &listener{callback: once}
+	if _, ok := callback.(eventCallbackAck); ok {
+		registered.callback = onceAckCallback{once}
+	}
+	once.remove = v1.unsubscribe(socketID, event, registered)
+	return v1.onListener(socketID, event, registered)
+}
+
+// Off - removes every callback of the event. A single callback is removed with the func
+// that OnWithOff or Once returns, as the callbacks are funcs that can't be compared.
+func (v1 inSocketV1) Off(event Event) { v1.off(event) }
+
+// Listeners - returns the callbacks that are registered for the event, in the order they were registered
+func (v1 inSocketV1) Listeners(event Event) []eventCallback {
+	callbacks := v1.callbacks(v1.nsp(), event, v1.listenerID())
+	for i, fn := range callbacks {
+		callbacks[i] = unwrapCallback(fn)
+	}
+	return callbacks
+}
+
+// listenerID returns the socketID that listeners are registered to, which is
+// the serverEvent when this is not instantiated by a socket
+func (v1 inSocketV1) listenerID() SocketID {
+	if len(v1._socketID) == 0 {
+		return serverEvent
+	}
+	return v1._socketID
+}
+
+// listener is a registered callback, the pointer is what tells the registrations apart
+// when the same callback is registered more than once
+type listener struct{ callback eventCallback }
+
+func (v1 inSocketV1) on(event Event, callback eventCallback) func() {
+	return v1.onSocket(v1.listenerID(), event, callback)
+}
+
+// onSocket registers the callback for the event explicitly to the socketID, after
+// any callbacks that have already been registered
+func (v1 inSocketV1) onSocket(socketID SocketID, event Event, callback eventCallback) func() {
+	return v1.onListener(socketID, event, &listener{callback: callback})
+}
+
+func (v1 inSocketV1) onListener(socketID SocketID, event Event, l *listener) func() {
 	v1.x.Lock()
 	defer v1.x.Unlock()
 
 	if _, ok := v1.events[v1.nsp()]; !ok {
-		v1.events[v1.nsp()] = make(map[string]map[SocketID]eventCallback)
+		v1.events[v1.nsp()] = make(map[string]map[SocketID][]*listener)
 	}
 	if _, ok := v1.events[v1.nsp()][event]; !ok {
-		v1.events[v1.nsp()][event] = make(map[SocketID]eventCallback)
+		v1.events[v1.nsp()][event] = make(map[SocketID][]*listener)
 	}
 
-	socketID := v1._socketID
-	if len(v1._socketID) == 0 {
-		socketID = serverEvent
+	v1.events[v1.nsp()][event][socketID] = append(v1.events[v1.nsp()][event][socketID], l)
+	return v1.unsubscribe(socketID, event, l)
+}
+
+// unsubscribe returns the func that removes the registered listener
+func (v1 inSocketV1) unsubscribe(socketID SocketID, event Event, l *listener) func() {
+	return func() { v1.offCallback(socketID, event, func(match *listener) bool { return match == l }) }
+}
+
+func (v1 inSocketV1) off(event Event) {
+	v1.offSocket(v1.listenerID(), event)
+}
+
+// offSocket removes all of the callbacks for the event that were registered to the socketID
+func (v1 inSocketV1) offSocket(socketID SocketID, event Event) {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	if _, ok := v1.events[v1.nsp()][event]; ok {
+		delete(v1.events[v1.nsp()][event], socketID)
+		if len(v1.events[v1.nsp()][event]) == 0 {
+			delete(v1.events[v1.nsp()], event)
+		}
+	}
+}
+
+// offCallback removes the listeners for the event that were registered to the socketID
+// and are matched by the match func
+func (v1 inSocketV1) offCallback(socketID SocketID, event Event, match func(*listener) bool) {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	callbacks, ok := v1.events[v1.nsp()][event][socketID]
+	if !ok {
+		return
+	}
+
+	keep := make([]*listener, 0, len(callbacks))
+	for _, l := range callbacks {
+		if !match(l) {
+			keep = append(keep, l)
+		}
+	}
+
+	if len(keep) > 0 {
+		v1.events[v1.nsp()][event][socketID] = keep
+		return
+	}
+	delete(v1.events[v1.nsp()][event], socketID)
+	if len(v1.events[v1.nsp()][event]) == 0 {
+		delete(v1.events[v1.nsp()], event)
+	}
+}
+
+// callbacks returns a copy of the callbacks for the event that were registered to the socketID
+func (v1 inSocketV1) callbacks(namespace Namespace, event Event, socketID SocketID) []eventCallback {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	callbacks := v1.events[namespace][event][socketID]
+	rtn := make([]eventCallback, 0, len(callbacks))
+	for _, l := range callbacks {
+		rtn = append(rtn, l.callback)
+	}
+	return rtn
+}
+
+// removeListeners removes all of the callbacks and any callbacks that were registered to the socketID
+func (v1 inSocketV1) removeListeners(namespace Namespace, socketID SocketID) {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	for event, callbacks := range v1.events[namespace] {
+		delete(callbacks, socketID)
+		if len(callbacks) == 0 {
+			delete(v1.events[namespace], event)
+		}
+	}
+	delete(v1.anyIncoming[namespace], socketID)
+	delete(v1.anyOutgoing[namespace], socketID)
+}
+
+// anyListener is a registered any callback, the pointer is what tells the registrations apart
+type anyListener struct{ callback eventAnyCallback }
+
+func (v1 inSocketV1) onAny(callback eventAnyCallback) func() {
+	return v1.addAny(v1.anyIncoming, callback)
+}
+func (v1 inSocketV1) offAny() { v1.removeAny(v1.anyIncoming, nil) }
+func (v1 inSocketV1) listenersAny() []eventAnyCallback {
+	return v1.listAny(v1.anyIncoming, v1.nsp(), v1.listenerID())
+}
+
+func (v1 inSocketV1) onAnyOutgoing(callback eventAnyCallback) func() {
+	return v1.addAny(v1.anyOutgoing, callback)
+}
+func (v1 inSocketV1) offAnyOutgoing() { v1.removeAny(v1.anyOutgoing, nil) }
+func (v1 inSocketV1) listenersAnyOutgoing() []eventAnyCallback {
+	return v1.listAny(v1.anyOutgoing, v1.nsp(), v1.listenerID())
+}
+
+// addAny registers the any callback, and returns a func that removes this registration
+func (v1 inSocketV1) addAny(anyEvents map[Namespace]map[SocketID][]*anyListener, callback eventAnyCallback) func() {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	if _, ok := anyEvents[v1.nsp()]; !ok {
+		anyEvents[v1.nsp()] = make(map[SocketID][]*anyListener)
+	}
+	l := &anyListener{callback: callback}
+	anyEvents[v1.nsp()][v1.listenerID()] = append(anyEvents[v1.nsp()][v1.listenerID()], l)
+	return func() { v1.removeAny(anyEvents, l) }
+}
+
+// removeAny removes the any listener, or all of them when it's nil
+func (v1 inSocketV1) removeAny(anyEvents map[Namespace]map[SocketID][]*anyListener, remove *anyListener) {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	callbacks := anyEvents[v1.nsp()][v1.listenerID()]
+	keep := make([]*anyListener, 0, len(callbacks))
+	for _, l := range callbacks {
+		if remove != nil && l != remove {
+			keep = append(keep, l)
+		}
+	}
+
+	if len(keep) > 0 {
+		anyEvents[v1.nsp()][v1.listenerID()] = keep
+		return
+	}
+	delete(anyEvents[v1.nsp()], v1.listenerID())
+}
+
+func (v1 inSocketV1) listAny(anyEvents map[Namespace]map[SocketID][]*anyListener, namespace Namespace, socketID SocketID) []eventAnyCallback {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	callbacks := anyEvents[namespace][socketID]
+	rtn := make([]eventAnyCallback, 0, len(callbacks))
+	for _, l := range callbacks {
+		rtn = append(rtn, l.callback)
+	}
+	return rtn
+}
+
+// callAny calls the any callbacks that are registered to the socketID, or to the server
+// when the socket has none, with the event and the event arguments.
+func (v1 inSocketV1) callAny(anyEvents map[Namespace]map[SocketID][]*anyListener, namespace Namespace, socketID SocketID, event Event, args []interface{}) bool {
+	callbacks := v1.listAny(anyEvents, namespace, socketID)
+	if len(callbacks) == 0 {
+		callbacks = v1.listAny(anyEvents, namespace, serverEvent)
+	}
+	for _, fn := range callbacks {
+		fn(event, args...)
+	}
+	return len(callbacks) > 0
+}
+
+// onceCallback is registered in place of a callback that is removed after the first call
+type onceCallback struct {
+	once     *sync.Once
+	remove   func()
+	callback eventCallback
+}
+
+func (o *onceCallback) Callback(data ...interface{}) (err error) {
+	o.once.Do(func() {
+		o.remove()
+		err = o.callback.Callback(data...)
+	})
+	return err
+}
+
+// onceAckCallback is registered in place of a callback that can acknowledge the event
+type onceAckCallback struct{ *onceCallback }
+
+func (o onceAckCallback) CallbackAck(data ...interface{}) (rtn []interface{}) {
+	o.once.Do(func() {
+		o.remove()
+		rtn = o.callback.(eventCallbackAck).CallbackAck(data...)
+	})
+	return rtn
+}
+
+func (o onceAckCallback) CallbackAckErr(data ...interface{}) (rtn []interface{}, err error) {
+	o.once.Do(func() {
+		o.remove()
+		if ack, ok := o.callback.(eventCallbackAckErr); ok {
+			rtn, err = ack.CallbackAckErr(data...)
+			return
+		}
+		rtn = o.callback.(eventCallbackAck).CallbackAck(data...)
+	})
+	return rtn, err
+}
+
+// unwrapCallback returns the callback that was registered with Once
+func unwrapCallback(fn eventCallback) eventCallback {
+	switch once := fn.(type) {
+	case *onceCallback:
+		return once.callback
+	case onceAckCallback:
+		return once.callback
+	}
+	return fn
+}
+
+// useIncoming registers the middleware that runs before the callbacks of the
+// incoming events for the socket
+func (v1 inSocketV1) useIncoming(middleware eventMiddleware) {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	if _, ok := v1.incoming[v1.nsp()]; !ok {
+		v1.incoming[v1.nsp()] = make(map[SocketID][]eventMiddleware)
+	}
+	v1.incoming[v1.nsp()][v1._socketID] = append(v1.incoming[v1.nsp()][v1._socketID], middleware)
+}
+
+// incomingMiddleware runs the incoming event through all of the middleware that
+// is registered for the socket, and returns the first error that is passed to next.
+func (v1 inSocketV1) incomingMiddleware(ctx context.Context, namespace Namespace, socketID SocketID, event Event, args []interface{}) error {
+	v1.x.Lock()
+	middleware := v1.incoming[namespace][socketID]
+	v1.x.Unlock()
+
+	for _, fn := range middleware {
+		fn := fn
+		if err := waitNext(ctx, func(next func(error)) { fn(event, args, next) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitNext calls the middleware with the next func, and returns the error that is passed
+// to next. A middleware that doesn't call next is given up on once the ctx is done, which
+// is when the session of the socket has closed.
+func waitNext(ctx context.Context, middleware func(next func(error))) error {
+	next := make(chan error, 1)
+	middleware(func(err error) {
+		select {
+		case next <- err:
+		default: // next was already called
+		}
+	})
+
+	select {
+	case err := <-next:
+		return err
+	default:
+	}
+	select {
+	case err := <-next:
+		return err
+	case <-ctx.Done():
+		return ErrDisconnectedSocket
+	}
+}
+
+// removeIncoming removes all of the middleware that is registered for the socket
+func (v1 inSocketV1) removeIncoming(namespace Namespace, socketID SocketID) {
+	v1.x.Lock()
+	defer v1.x.Unlock()
+
+	delete(v1.incoming[namespace], socketID)
+}
+
+// cancelAcks removes all of the acknowledgements that are waiting on a response from
+// the socketID in the namespace. Any callback that is waiting is told why with the err.
+func (v1 inSocketV1) cancelAcks(namespace Namespace, socketID SocketID, err error) {
+	v1.x.Lock()
+	var cancel []ackCanceler
+	for event, callbacks := range v1.events[namespace] {
+		if !strings.HasPrefix(event, ackIDEventPrefix) {
+			continue
+		}
+		for _, l := range callbacks[socketID] {
+			if fn, ok := l.callback.(ackCanceler); ok {
+				cancel = append(cancel, fn)
+			}
+		}
+		delete(callbacks, socketID)
+		if len(callbacks) == 0 {
+			delete(v1.events[namespace], event)
+		}
 	}
+	v1.x.Unlock()
+
+	for _, fn := range cancel {
+		fn.cancelAck(err)
+	}
+}
 
-	v1.events[v1.nsp()][event][socketID] = callback
+// callDisconnect calls the disconnect (or disconnecting) callbacks that are registered to the socketID,
+// or to the server when the socket has none, with the reason. It returns false when there were none.
+func (v1 inSocketV1) callDisconnect(namespace Namespace, socketID SocketID, event Event, reason DisconnectReason) (bool, error) {
+	callbacks := v1.callbacks(namespace, event, socketID)
+	if len(callbacks) == 0 {
+		callbacks = v1.callbacks(namespace, event, serverEvent)
+	}
+
+	var err error
+	for _, fn := range callbacks {
+		if e := fn.Callback(reason.String()); e != nil && err == nil {
+			err = e
+		}
+	}
+	return len(callbacks) > 0, err
+}
+
+// disconnect sends a DISCONNECT packet for the namespace to the socket, removes the socket
+// from all of its rooms and calls the disconnect callbacks. When close is true the EngineIO
+// session is closed as well, which disconnects the client from every namespace.
+func (v1 inSocketV1) disconnect(close bool) error {
+	namespace, socketID := v1.nsp(), v1.socketID()
+
+	reason := ServerNamespaceDisconnect
+	if close {
+		reason = ServerShuttingDown
+	}
+
+	transport := v1.tr()
+	if err := transport.Send(socketID, nil, siop.WithType(siop.DisconnectPacket.Byte()), siop.WithNamespace(namespace)); err != nil {
+		return err
+	}
+
+	err := v1.disconnectSocket(namespace, socketID, reason, true)
+
+	if close {
+		if raw, ok := transport.(rawTransport); ok {
+			if t := raw.Transport(socketID); t != nil {
+				t.Shutdown()
+			}
+		}
+	}
+	return err
+}
+
+// disconnectSocket calls the disconnecting callbacks while the socket is still in its rooms,
+// removes the socket from all of its rooms when leave is true, then cancels the pending
+// acks and calls the disconnect callbacks before the socket listeners are removed.
+func (v1 inSocketV1) disconnectSocket(namespace Namespace, socketID SocketID, reason DisconnectReason, leave bool) error {
+	_, err := v1.callDisconnect(namespace, socketID, OnDisconnectingEvent, reason)
+
+	if leave {
+		v1.leaveAll(namespace, socketID)
+	}
+
+	v1.cancelAcks(namespace, socketID, ErrDisconnectedSocket)
+	v1.removeIncoming(namespace, socketID)
+	if _, e := v1.callDisconnect(namespace, socketID, OnDisconnectEvent, reason); e != nil && err == nil {
+		err = e
+	}
+	v1.removeListeners(namespace, socketID)
+	return err
+}
+
+// leaveAll removes the socket from all of its rooms in the namespace
+func (v1 inSocketV1) leaveAll(namespace Namespace, socketID SocketID) {
+	transport := v1.tr()
+	if emitter, ok := transport.(siot.Emitter); ok {
+		for _, room := range emitter.Rooms(namespace, socketID).Rooms {
+			transport.Leave(namespace, socketID, room)
+		}
+	}
 }
 
 // Of - sending to all clients in namespace, including sender
@@ -197,10 +647,8 @@ func (v1 inSocketV1) Emit(event Event, data ...Data) error {
 			}
 		}
 		// send to local server ... since this is not a broadcast
-		if ns, ok := v1.events[v1.nsp()]; ok {
-			if events, ok := ns[event][v1._socketID]; ok {
-				events.Callback(seri.Convert(data).ToInterface()...)
-			}
+		for _, fn := range v1.callbacks(v1.nsp(), event, v1._socketID) {
+			fn.Callback(seri.Convert(data).ToInterface()...)
 		}
 		return v1.emit(event, data...)
 	}
@@ -232,9 +680,30 @@ func (v1 inSocketV1) emit(event Event, data ...Data) error {
 		return err
 	}
 
+	v1.callAny(v1.anyOutgoing, v1.nsp(), v1.listenerID(), event, eventArgs(callbackData))
+
 	transport := v1.tr()
+	sender, volatile := transport.(siot.VolatileSender)
+	volatile = volatile && v1.volatile
+
+	// a volatile packet can be dropped without an error, so there is no listener for its
+	// acknowledgement, which would never be removed
+	ackCallback := eventCallback
+	if volatile {
+		ackCallback = nil
+	}
+
+	var acks *ackBroadcastCallback
+	if ackCallback != nil && v1.collectAcks {
+		acks = v1.ackBroadcast(ackCallback)
+		defer acks.start()
+	}
+
 	for _, id := range v1.id {
 		opts := []siop.Option{siop.WithNamespace(v1.nsp())}
+		if !v1.compress {
+			opts = append(opts, siop.WithCompress(false))
+		}
 		if hasBin {
 			if eventCallback != nil {
 				opts = append(opts, siop.WithType(siop.BinaryAckPacket.Byte()))
@@ -244,17 +713,277 @@ func (v1 inSocketV1) emit(event Event, data ...Data) error {
 		} else {
 			opts = append(opts, siop.WithType(siop.EventPacket.Byte()))
 		}
-		if eventCallback != nil {
+		if ackCallback != nil {
 			ackID := transport.AckID()
-			v1.on(fmt.Sprintf("%s%d", ackIDEventPrefix, ackID), eventCallback)
+			event := fmt.Sprintf("%s%d", ackIDEventPrefix, ackID)
+			switch {
+			case acks != nil:
+				v1.onSocket(id, event, acks.add(id, event))
+			case v1.timeout > 0:
+				v1.on(event, v1.ackTimeout(event, ackCallback))
+			default:
+				v1.on(event, ackCallback)
+			}
 			opts = append(opts, siop.WithAckID(ackID))
 		}
+		if volatile {
+			sender.SendVolatile(id, callbackData, opts...)
+			continue
+		}
 		transport.Send(id, callbackData, opts...)
 	}
 
 	return nil
 }
 
+// broadcast sends the event once through the transport, to the sockets that the options are
+// for on every server. There isn't an acknowledgement id for each socket, so it's not used
+// when there is an acknowledgement callback.
+func (v1 inSocketV1) broadcast(tr siot.Broadcaster, bopts siot.BroadcastOptions, event Event, data ...Data) error {
+	hasBin, callbackData, _, err := scrub(v1.binary, event, data)
+	if err != nil {
+		return err
+	}
+
+	v1.callAny(v1.anyOutgoing, v1.nsp(), v1.listenerID(), event, eventArgs(callbackData))
+
+	opts := []siop.Option{siop.WithNamespace(v1.nsp()), siop.WithType(siop.EventPacket.Byte())}
+	if hasBin {
+		opts[1] = siop.WithType(siop.BinaryEventPacket.Byte())
+	}
+	if !v1.compress {
+		opts = append(opts, siop.WithCompress(false))
+	}
+	return tr.Broadcast(bopts, callbackData, opts...)
+}
+
+// emitWithAck sends the event to the socket with an acknowledgement ID, then blocks until
+// the client acknowledges the event, the ctx is done or the socket disconnects.
+func (v1 inSocketV1) emitWithAck(ctx context.Context, event Event, data ...Data) ([]interface{}, error) {
+	hasBin, callbackData, _, err := scrub(v1.binary, event, data)
+	if err != nil {
+		return nil, err
+	}
+
+	v1.callAny(v1.anyOutgoing, v1.nsp(), v1.listenerID(), event, eventArgs(callbackData))
+
+	transport := v1.tr()
+
+	ackID := transport.AckID()
+	ackEvent := fmt.Sprintf("%s%d", ackIDEventPrefix, ackID)
+	ack := &ackWaitCallback{data: make(chan []interface{}, 1), err: make(chan error, 1)}
+
+	v1.on(ackEvent, ack)
+	defer v1.off(ackEvent)
+
+	packetType := siop.EventPacket.Byte()
+	if hasBin {
+		packetType = siop.BinaryEventPacket.Byte()
+	}
+
+	opts := []siop.Option{siop.WithNamespace(v1.nsp()), siop.WithType(packetType), siop.WithAckID(ackID)}
+	if err := transport.Send(v1.socketID(), callbackData, opts...); err != nil {
+		return nil, err
+	}
+
+	select {
+	case data := <-ack.data:
+		return data, nil
+	case err := <-ack.err:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ackCanceler is implemented by acknowledgement callbacks that need to know when
+// the socket has gone away before the client has acknowledged the event.
+type ackCanceler interface {
+	cancelAck(error)
+}
+
+// ackWaitCallback is the acknowledgement callback that is registered for emitWithAck.
+type ackWaitCallback struct {
+	data chan []interface{}
+	err  chan error
+}
+
+// Callback passes on the acknowledgement data, any binary data is read into memory as the
+// attachments are closed once the callback returns.
+func (ack *ackWaitCallback) Callback(data ...interface{}) error {
+	select {
+	case ack.data <- siop.ReadAttachments(data).([]interface{}):
+	default:
+	}
+	return nil
+}
+
+func (ack *ackWaitCallback) cancelAck(err error) {
+	select {
+	case ack.err <- err:
+	default:
+	}
+}
+
+// ackTimeout wraps the acknowledgement callback so that it is called exactly once, either
+// with a nil error and the client acknowledgement data, or with ErrAckTimeout when
+// the client has not acknowledged the event within the v1.timeout duration.
+func (v1 inSocketV1) ackTimeout(event Event, callback eventCallback) eventCallback {
+	ack := &ackTimeoutCallback{once: new(sync.Once), callback: callback}
+	ack.timer = time.AfterFunc(v1.timeout, func() {
+		ack.once.Do(func() {
+			v1.off(event)
+			ack.callback.Callback(ErrAckTimeout.F(event[len(ackIDEventPrefix):]))
+		})
+	})
+	ack.remove = func() { v1.off(event) }
+	return ack
+}
+
+// ackTimeoutCallback is the callback that is registered in place of an acknowledgement
+// callback that was sent with a timeout.
+type ackTimeoutCallback struct {
+	once     *sync.Once
+	timer    *time.Timer
+	remove   func()
+	callback eventCallback
+}
+
+func (ack *ackTimeoutCallback) Callback(data ...interface{}) (err error) {
+	ack.once.Do(func() {
+		ack.timer.Stop()
+		ack.remove()
+		err = ack.callback.Callback(append([]interface{}{nil}, data...)...)
+	})
+	return err
+}
+
+func (ack *ackTimeoutCallback) cancelAck(err error) {
+	ack.once.Do(func() {
+		ack.timer.Stop()
+		ack.callback.Callback(err)
+	})
+}
+
+// BroadcastAck is the acknowledgement data that is collected from every recipient of a
+// broadcast that was sent with a timeout. It is passed to the broadcast callback after
+// the error, which is not nil when any recipients have not acknowledged in time. A recipient
+// that disconnected before it acknowledged is in TimedOut.
+type BroadcastAck struct {
+	Responses map[SocketID][]interface{}
+	TimedOut  []SocketID
+}
+
+// ackBroadcast returns a collector that calls the callback once, after every recipient
+// has acknowledged the broadcast or the v1.timeout duration has passed.
+func (v1 inSocketV1) ackBroadcast(callback eventCallback) *ackBroadcastCallback {
+	return &ackBroadcastCallback{
+		ʟ:        new(sync.Mutex),
+		once:     new(sync.Once),
+		timeout:  v1.timeout,
+		prefix:   socketIDQuickPrefix(),
+		pending:  make(map[SocketID]Event),
+		data:     make(map[SocketID][]interface{}),
+		remove:   v1.offSocket,
+		callback: callback,
+	}
+}
+
+// ackBroadcastCallback collects the acknowledgements for each recipient of a broadcast
+type ackBroadcastCallback struct {
+	ʟ       *sync.Mutex
+	once    *sync.Once
+	timer   *time.Timer
+	timeout time.Duration
+	prefix  string
+
+	pending map[SocketID]Event
+	data    map[SocketID][]interface{}
+	failed  []SocketID // the recipients that were cancelled, when they disconnected
+
+	remove   func(SocketID, Event)
+	callback eventCallback
+}
+
+// add registers the socketID as a recipient and returns the ack callback for it
+func (ack *ackBroadcastCallback) add(socketID SocketID, event Event) eventCallback {
+	ack.ʟ.Lock()
+	defer ack.ʟ.Unlock()
+
+	ack.pending[socketID] = event
+	return &ackBroadcastRecipient{ack: ack, socketID: socketID}
+}
+
+// start begins the timeout after all of the recipients have been added
+func (ack *ackBroadcastCallback) start() {
+	ack.ʟ.Lock()
+	defer ack.ʟ.Unlock()
+
+	if len(ack.pending) == 0 {
+		go ack.done()
+		return
+	}
+	ack.timer = time.AfterFunc(ack.timeout, ack.done)
+}
+
+func (ack *ackBroadcastCallback) receive(socketID SocketID, data []interface{}, err error) {
+	ack.ʟ.Lock()
+	event, ok := ack.pending[socketID]
+	if !ok {
+		ack.ʟ.Unlock()
+		return
+	}
+	delete(ack.pending, socketID)
+	ack.remove(socketID, event)
+	if err == nil {
+		ack.data[SocketID(ack.prefix)+socketID] = data
+	} else {
+		ack.failed = append(ack.failed, SocketID(ack.prefix)+socketID)
+	}
+	finished := len(ack.pending) == 0 && ack.timer != nil
+	ack.ʟ.Unlock()
+
+	if finished {
+		ack.done()
+	}
+}
+
+func (ack *ackBroadcastCallback) done() {
+	ack.once.Do(func() {
+		ack.ʟ.Lock()
+		if ack.timer != nil {
+			ack.timer.Stop()
+		}
+
+		var err error
+		var rtn = BroadcastAck{Responses: ack.data, TimedOut: ack.failed}
+		for socketID, event := range ack.pending {
+			ack.remove(socketID, event)
+			rtn.TimedOut = append(rtn.TimedOut, SocketID(ack.prefix)+socketID)
+		}
+		if len(rtn.TimedOut) > 0 {
+			err = ErrBroadcastAckTimeout.F(len(rtn.TimedOut), len(rtn.TimedOut)+len(rtn.Responses))
+		}
+		ack.pending = map[SocketID]Event{}
+		ack.ʟ.Unlock()
+
+		ack.callback.Callback(err, rtn)
+	})
+}
+
+// ackBroadcastRecipient is the ack callback that is registered for a single recipient
+type ackBroadcastRecipient struct {
+	ack      *ackBroadcastCallback
+	socketID SocketID
+}
+
+func (r *ackBroadcastRecipient) Callback(data ...interface{}) error {
+	r.ack.receive(r.socketID, data, nil)
+	return nil
+}
+
+func (r *ackBroadcastRecipient) cancelAck(err error) { r.ack.receive(r.socketID, nil, err) }
+
 // SocketV1 is the returned socket
 type SocketV1 struct {
 	inSocketV1
@@ -282,6 +1011,21 @@ func (v1 *SocketV1) Leave(room Room) error {
 	return transport.Leave(v1.nsp(), v1.socketID(), room)
 }
 
-func (v1 *SocketV1) Broadcast() emit                      { v1.setIsSender(true); return v1.inSocketV1 }
-func (v1 *SocketV1) Volatile() broadcastEmit              { return v1 } // NOT IMPLEMENTED...
-func (v1 *SocketV1) Compress(compress bool) broadcastEmit { return v1 } // NOT IMPLEMENTED...
+func (v1 *SocketV1) Broadcast() emit { v1.setIsSender(true); return v1.inSocketV1 }
+
+// Volatile - the event data may be lost if the client is not ready to receive it, so an
+// acknowledgement callback is not called
+func (v1 *SocketV1) Volatile() broadcastEmit {
+	rtn := *v1
+	rtn.inSocketV1 = v1.clone()
+	rtn.setVolatile(true)
+	return &rtn
+}
+
+// Compress - sets the compress flag for the event data
+func (v1 *SocketV1) Compress(compress bool) broadcastEmit {
+	rtn := *v1
+	rtn.inSocketV1 = v1.clone()
+	rtn.setCompress(compress)
+	return &rtn
+}
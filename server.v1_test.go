@@ -794,6 +794,9 @@ func OnEventV1(t *testing.T) []testDataOptFunc {
 		})
 
 		v1.OnDisconnect(func(reason string) {
+			if reason != socketio.ClientNamespaceDisconnect.String() {
+				return // the session of the other clients times out later
+			}
 			defer wait.Done()
 
 			v1.In("room").Emit("say goodbye", serialize.String("disconnecting..."))
@@ -1,6 +1,7 @@
 package socketio
 
 import (
+	"context"
 	"net/http"
 	"sync"
 
@@ -14,7 +15,7 @@ import (
 type ServerV2 struct {
 	inSocketV2
 
-	doBinaryEventPacket func(SocketID, siot.Socket) error
+	doBinaryEventPacket func(SocketID, siot.Socket, *Request) error
 
 	prev *ServerV1
 }
@@ -27,6 +28,7 @@ func NewServerV2(opts ...Option) *ServerV2 {
 	v1.eio = eio.NewServerV3(
 		eio.WithPath(*v1.path),
 		eio.WithInitialPackets(autoConnect(v1)),
+		eio.WithSessionClose(sessionClose(v1)),
 	).(eio.EIOServer) // v2 uses the default engineio protocol v3
 	v1.eio.With(opts...)
 
@@ -77,4 +79,6 @@ func (v2 *ServerV2) To(room Room) inToEmit {
 	return rtn.To(room)
 }
 
+func (v2 *ServerV2) VolatileDropped() uint64                          { return v2.prev.VolatileDropped() }
 func (v2 *ServerV2) ServeHTTP(w http.ResponseWriter, r *http.Request) { v2.prev.ServeHTTP(w, r) }
+func (v2 *ServerV2) Shutdown(ctx context.Context) error               { return v2.prev.Shutdown(ctx) }
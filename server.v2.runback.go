@@ -1,6 +1,9 @@
 package socketio
 
 import (
+	"context"
+	"sync"
+
 	siop "github.com/njones/socketio/protocol"
 	siot "github.com/njones/socketio/transport"
 )
@@ -25,42 +28,25 @@ func doConnectPacketV2(v2 *ServerV2) func(SocketID, siot.Socket, *Request) error
 	}
 }
 
-func doBinaryEventPacket(v2 *ServerV2) func(SocketID, siot.Socket) error {
+func doBinaryEventPacket(v2 *ServerV2) func(SocketID, siot.Socket, *Request) error {
 	v1 := v2.prev
-	return func(socketID SocketID, socket siot.Socket) (err error) {
-		type callbackAck interface {
-			CallbackAck(...interface{}) []interface{}
-		}
-
+	return func(socketID SocketID, socket siot.Socket, req *Request) (err error) {
 		switch data := socket.Data.(type) {
 		case []interface{}:
 			event, ok := data[0].(string)
 			if !ok {
 				return ErrUnknownBinaryEventName.F(data)
 			}
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				if socket.AckID > 0 {
-					if fn, ok := fn.(callbackAck); ok {
-						vals := fn.CallbackAck(data[1:]...)
-						return v1.tr().Send(socketID, vals, siop.WithNamespace(socket.Namespace), siop.WithAckID(socket.AckID), siop.WithType(byte(siop.BinaryAckPacket)))
-					}
-				}
-				return fn.Callback(data[1:]...)
-			}
-			if fn, ok := v1.events[socket.Namespace][event][serverEvent]; ok {
-				if socket.AckID > 0 {
-					if fn, ok := fn.(callbackAck); ok {
-						vals := fn.CallbackAck(data[1:]...)
-						return v1.tr().Send(socketID, vals, siop.WithNamespace(socket.Namespace), siop.WithAckID(socket.AckID), siop.WithType(byte(siop.BinaryAckPacket)))
-					}
-				}
-				return fn.Callback(data[1:]...)
+			if err := v1.incomingMiddleware(req.sessionContext(), socket.Namespace, socketID, event, data[1:]); err != nil {
+				return v1.sendIncomingError(socketID, socket.Namespace, err)
 			}
+			_, err = v1.callEvent(socketID, socket, event, data[1:], siop.BinaryAckPacket.Byte())
 		case []string:
-			event := data[0]
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				err = fn.Callback(stoi(data[1:])...)
+			event, args := data[0], stoi(data[1:])
+			if err := v1.incomingMiddleware(req.sessionContext(), socket.Namespace, socketID, event, args); err != nil {
+				return v1.sendIncomingError(socketID, socket.Namespace, err)
 			}
+			_, err = v1.callEvent(socketID, socket, event, args, siop.BinaryAckPacket.Byte())
 		default:
 			return ErrUnexpectedBinaryData.F(socket.Data)
 		}
@@ -68,14 +54,23 @@ func doBinaryEventPacket(v2 *ServerV2) func(SocketID, siot.Socket) error {
 	}
 }
 
-func runV2(v2 *ServerV2) func(SocketID, *Request) error {
-	return func(socketID SocketID, req *Request) error {
+func runV2(v2 *ServerV2) func(SocketID, SessionID, *Request) error {
+	return func(socketID SocketID, sessionID SessionID, req *Request) error {
 		unlock := v2.prev.r()
 		tr := v2.tr()
 		unlock()
 
+		in := v2.prev.queues.session(sessionID)
+		req = req.withSession(in.ctx)
+		handle := closeAttachments(func(socketID SocketID, socket siot.Socket) error { return doV2(v2, socketID, socket, req) })
 		for socket := range tr.Receive(socketID) {
-			if err := doV2(v2, socketID, socket, req); err != nil {
+			if onReceive(socket.Type) {
+				if err := handle(socketID, socket); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := in.add(socketID, socket, handle); err != nil {
 				return err
 			}
 		}
@@ -83,10 +78,175 @@ func runV2(v2 *ServerV2) func(SocketID, *Request) error {
 	}
 }
 
+// closeAttachments closes the attachments of the packet once it's been handled. They are
+// streamed, so the transport can't receive the next packet until what hasn't been read
+// of them is thrown away.
+func closeAttachments(handle func(SocketID, siot.Socket) error) func(SocketID, siot.Socket) error {
+	return func(socketID SocketID, socket siot.Socket) error {
+		defer siop.CloseAttachments(socket.Data)
+		return handle(socketID, socket)
+	}
+}
+
+// onReceive is true for the packets that are handled on the receive loop instead of in
+// order with the events. These are the acknowledgements that a callback in EmitWithAck may
+// be waiting for, and the errors that end the receive loop.
+func onReceive(packetType byte) bool {
+	switch packetType {
+	case siop.AckPacket.Byte(), siop.BinaryAckPacket.Byte(), siop.ErrorPacket.Byte():
+		return true
+	}
+	return false
+}
+
+// sessionQueues holds the packets of each session that are handled in order. The queue is
+// shared by the requests of the session, so a callback that is waiting in EmitWithAck doesn't
+// hold up a polling request, as the acknowledgement comes in on the next one.
+type sessionQueues struct {
+	ṁ sync.Mutex
+	m map[SessionID]*inOrder
+}
+
+// session returns the queue of the session, a new one is started the first time
+func (q *sessionQueues) session(sessionID SessionID) *inOrder {
+	q.ṁ.Lock()
+	defer q.ṁ.Unlock()
+
+	if q.m == nil {
+		q.m = make(map[SessionID]*inOrder)
+	}
+	in, ok := q.m[sessionID]
+	if !ok {
+		in = handleInOrder()
+		q.m[sessionID] = in
+	}
+	return in
+}
+
+// close removes the queue of the ended session, it returns once the queued packets have
+// been handled.
+func (q *sessionQueues) close(sessionID SessionID) {
+	q.ṁ.Lock()
+	in, ok := q.m[sessionID]
+	delete(q.m, sessionID)
+	q.ṁ.Unlock()
+
+	if ok {
+		in.close()
+	}
+}
+
+// drainSession cancels the acknowledgements that the callbacks of the socket are waiting
+// for, then waits for the queued packets of the ended session to be handled, so that no
+// event is handled after the socket has been disconnected.
+func (v1 *ServerV1) drainSession(sessionID SessionID, socketID SocketID, namespaces []Namespace) {
+	for _, namespace := range namespaces {
+		v1.cancelAcks(namespace, socketID, ErrDisconnectedSocket)
+	}
+	v1.queues.close(sessionID)
+}
+
+// inOrder calls the handle function with the packets of a socket on its own goroutine, in
+// the order that the packets were added. Adding a packet never blocks, so the receive loop
+// keeps reading the acknowledgements that a callback in EmitWithAck is waiting for.
+type inOrder struct {
+	ṁ      sync.Mutex
+	queue  []queuedSocket
+	closed bool
+	err    error
+
+	// ctx is done when the queue is closed, so a middleware that never calls next doesn't
+	// hold up the close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+type queuedSocket struct {
+	id     SocketID
+	socket siot.Socket
+	handle func(SocketID, siot.Socket) error
+}
+
+func handleInOrder() *inOrder {
+	in := &inOrder{wake: make(chan struct{}, 1), done: make(chan struct{})}
+	in.ctx, in.cancel = context.WithCancel(context.Background())
+	go in.run()
+	return in
+}
+
+// add queues the packet, it returns the error of a packet that was handled before it
+func (in *inOrder) add(socketID SocketID, socket siot.Socket, handle func(SocketID, siot.Socket) error) error {
+	in.ṁ.Lock()
+	defer in.ṁ.Unlock()
+
+	if in.err != nil {
+		return in.err
+	}
+	if in.closed {
+		siop.CloseAttachments(socket.Data)
+		return nil
+	}
+	in.queue = append(in.queue, queuedSocket{id: socketID, socket: socket, handle: handle})
+	in.signal()
+	return nil
+}
+
+// close stops the goroutine once the queued packets have been handled, and waits for them,
+// so that nothing for the socket is handled after it has been disconnected.
+func (in *inOrder) close() {
+	in.ṁ.Lock()
+	in.closed = true
+	in.signal()
+	in.ṁ.Unlock()
+
+	in.cancel()
+	<-in.done
+}
+
+func (in *inOrder) signal() {
+	select {
+	case in.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (in *inOrder) run() {
+	defer close(in.done)
+
+	for {
+		in.ṁ.Lock()
+		if len(in.queue) == 0 {
+			closed := in.closed
+			in.ṁ.Unlock()
+			if closed {
+				return
+			}
+			<-in.wake
+			continue
+		}
+		next := in.queue[0]
+		in.queue = in.queue[1:]
+		in.ṁ.Unlock()
+
+		if err := next.handle(next.id, next.socket); err != nil {
+			in.ṁ.Lock()
+			for _, queued := range in.queue {
+				siop.CloseAttachments(queued.socket.Data)
+			}
+			in.err, in.queue = err, nil
+			in.ṁ.Unlock()
+			return
+		}
+	}
+}
+
 func doV2(v2 *ServerV2, socketID SocketID, socket siot.Socket, req *Request) error {
 	switch socket.Type {
 	case siop.BinaryEventPacket.Byte():
-		if err := v2.doBinaryEventPacket(socketID, socket); err != nil {
+		if err := v2.doBinaryEventPacket(socketID, socket, req); err != nil {
 			v2.tr().Send(socketID, serviceError(err), siop.WithType(byte(siop.ErrorPacket)))
 		}
 		return nil
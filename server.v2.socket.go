@@ -1,7 +1,9 @@
 package socketio
 
 import (
+	"context"
 	"strings"
+	"time"
 
 	siot "github.com/njones/socketio/transport"
 )
@@ -23,6 +25,10 @@ func (v2 *inSocketV2) setIsServer(isServer bool)     { v2.prev.setIsServer(isSer
 func (v2 *inSocketV2) setIsSender(isSender bool)     { v2.prev.setIsSender(isSender) }
 func (v2 *inSocketV2) setSocketID(socketID SocketID) { v2.prev.setSocketID(socketID) }
 func (v2 *inSocketV2) setPrefix()                    { v2.prev.setPrefix() }
+func (v2 *inSocketV2) setTimeout(d time.Duration)    { v2.prev.setTimeout(d) }
+func (v2 *inSocketV2) setCollectAcks(collect bool)   { v2.prev.setCollectAcks(collect) }
+func (v2 *inSocketV2) setVolatile(volatile bool)     { v2.prev.setVolatile(volatile) }
+func (v2 *inSocketV2) setCompress(compress bool)     { v2.prev.setCompress(compress) }
 func (v2 *inSocketV2) setNsp(namespace Namespace)    { v2.prev.setNsp(namespace) }
 func (v2 *inSocketV2) addID(id siot.SocketID)        { v2.prev.addID(id) }
 func (v2 *inSocketV2) addTo(room Room)               { v2.prev.addTo(room) }
@@ -35,8 +41,22 @@ func (v2 inSocketV2) socketID() SocketID   { return v2.prev.socketID() }
 func (v2 inSocketV2) OnConnect(callback onConnectCallbackVersion2) {
 	v2.onConnect[v2.nsp()] = callback
 }
-func (v2 inSocketV2) OnDisconnect(callback func(string))     { v2.prev.OnDisconnect(callback) }
+func (v2 inSocketV2) OnDisconnect(callback func(string)) { v2.prev.OnDisconnect(callback) }
+func (v2 inSocketV2) OnDisconnectReason(callback func(DisconnectReason)) {
+	v2.prev.OnDisconnectReason(callback)
+}
+func (v2 inSocketV2) OnDisconnecting(callback func(DisconnectReason)) {
+	v2.prev.OnDisconnecting(callback)
+}
 func (v2 inSocketV2) On(event Event, callback eventCallback) { v2.prev.On(event, callback) }
+func (v2 inSocketV2) OnWithOff(event Event, callback eventCallback) func() {
+	return v2.prev.OnWithOff(event, callback)
+}
+func (v2 inSocketV2) Once(event Event, callback eventCallback) func() {
+	return v2.prev.Once(event, callback)
+}
+func (v2 inSocketV2) Off(event Event)                       { v2.prev.Off(event) }
+func (v2 inSocketV2) Listeners(event Event) []eventCallback { return v2.prev.Listeners(event) }
 
 func (v2 inSocketV2) Of(namespace Namespace) inSocketV2 {
 	rtn := v2.clone()
@@ -73,6 +93,14 @@ func (v2 *SocketV2) Emit(event Event, data ...Data) error {
 	return v2.prev.emit(event, data...)
 }
 
+// EmitWithAck sends the event to the client and blocks until the client acknowledges
+// it, the ctx is done or the socket disconnects. It returns the acknowledgement data.
+// It can be called from an event callback, the acknowledgements are received while the
+// callback waits.
+func (v2 *SocketV2) EmitWithAck(ctx context.Context, event Event, data ...Data) ([]interface{}, error) {
+	return v2.prev.emitWithAck(ctx, event, data...)
+}
+
 func (v2 *SocketV2) Join(room Room) error {
 	room = strings.Replace(room, v2.prefix(), socketIDPrefix, 1)
 	return v2.tr().Join(v2.nsp(), v2.socketID(), room)
@@ -81,7 +109,21 @@ func (v2 *SocketV2) Leave(room Room) error {
 	return v2.tr().Leave(v2.nsp(), v2.socketID(), room)
 }
 
-func (v2 *SocketV2) Broadcast() emit             { v2.setIsSender(true); return v2.inSocketV2 }
-func (v2 *SocketV2) Volatile() emit              { return v2 } // NOT IMPLEMENTED...
-func (v2 *SocketV2) Compress(compress bool) emit { return v2 } // NOT IMPLEMENTED...
-func (v2 *SocketV2) Binary(binary bool) emit     { return v2 } // NOT IMPLEMENTED...
+func (v2 *SocketV2) Broadcast() emit         { v2.setIsSender(true); return v2.inSocketV2 }
+func (v2 *SocketV2) Binary(binary bool) emit { return v2 } // NOT IMPLEMENTED...
+
+// Volatile - the event data may be lost if the client is not ready to receive it
+func (v2 *SocketV2) Volatile() emit {
+	rtn := *v2
+	rtn.inSocketV2 = v2.clone()
+	rtn.setVolatile(true)
+	return &rtn
+}
+
+// Compress - sets the compress flag for the event data
+func (v2 *SocketV2) Compress(compress bool) emit {
+	rtn := *v2
+	rtn.inSocketV2 = v2.clone()
+	rtn.setCompress(compress)
+	return &rtn
+}
@@ -739,6 +739,9 @@ func OnEventV2(t *testing.T) []testDataOptFunc {
 		})
 
 		v2.OnDisconnect(func(reason string) {
+			if reason != socketio.ClientNamespaceDisconnect.String() {
+				return // the session of the other clients times out later
+			}
 			defer wait.Done()
 
 			v2.In("room").Emit("say goodbye", serialize.String("disconnecting..."))
@@ -1,6 +1,7 @@
 package socketio
 
 import (
+	"context"
 	"net/http"
 
 	nmem "github.com/njones/socketio/adaptor/transport/memory"
@@ -26,7 +27,7 @@ func NewServerV3(opts ...Option) *ServerV3 {
 
 	v2 := v3.prev
 	v1 := v2.prev
-	v1.eio = eio.NewServerV4(eio.WithPath(*v1.path)).(eio.EIOServer)
+	v1.eio = eio.NewServerV4(eio.WithPath(*v1.path), eio.WithSessionClose(sessionClose(v1))).(eio.EIOServer)
 	v1.eio.With(opts...)
 
 	v3.With(opts...)
@@ -79,4 +80,6 @@ func (v3 *ServerV3) To(room Room) inToEmit {
 	return rtn.To(room)
 }
 
+func (v3 *ServerV3) VolatileDropped() uint64                          { return v3.prev.VolatileDropped() }
 func (v3 *ServerV3) ServeHTTP(w http.ResponseWriter, r *http.Request) { v3.prev.ServeHTTP(w, r) }
+func (v3 *ServerV3) Shutdown(ctx context.Context) error               { return v3.prev.Shutdown(ctx) }
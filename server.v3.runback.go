@@ -33,16 +33,21 @@ func doBinaryAckPacket(v1 *ServerV1) func(SocketID, siot.Socket) error {
 
 		switch data := socket.Data.(type) {
 		case []interface{}:
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				return fn.Callback(data...)
+			callbacks := v1.callbacks(socket.Namespace, event, socketID)
+			if len(callbacks) == 0 {
+				callbacks = v1.callbacks(socket.Namespace, event, serverEvent)
 			}
-			if fn, ok := v1.events[socket.Namespace][event][serverEvent]; ok {
-				return fn.Callback(data...)
+			for _, fn := range callbacks {
+				if e := fn.Callback(data...); e != nil && err == nil {
+					err = e
+				}
 			}
 		case []string:
 			event := data[0]
-			if fn, ok := v1.events[socket.Namespace][event][socketID]; ok {
-				err = fn.Callback(stoi(data[1:])...)
+			for _, fn := range v1.callbacks(socket.Namespace, event, socketID) {
+				if e := fn.Callback(stoi(data[1:])...); e != nil && err == nil {
+					err = e
+				}
 			}
 		default:
 			return ErrUnexpectedBinaryData.F(socket.Data)
@@ -51,14 +56,23 @@ func doBinaryAckPacket(v1 *ServerV1) func(SocketID, siot.Socket) error {
 	}
 }
 
-func runV3(v3 *ServerV3) func(SocketID, *Request) error {
-	return func(socketID SocketID, req *Request) error {
+func runV3(v3 *ServerV3) func(SocketID, SessionID, *Request) error {
+	return func(socketID SocketID, sessionID SessionID, req *Request) error {
 		unlock := v3.prev.prev.r()
 		tr := v3.tr()
 		unlock()
 
+		in := v3.prev.prev.queues.session(sessionID)
+		req = req.withSession(in.ctx)
+		handle := closeAttachments(func(socketID SocketID, socket siot.Socket) error { return doV3(v3, socketID, socket, req) })
 		for socket := range tr.Receive(socketID) {
-			if err := doV3(v3, socketID, socket, req); err != nil {
+			if onReceive(socket.Type) {
+				if err := handle(socketID, socket); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := in.add(socketID, socket, handle); err != nil {
 				return err
 			}
 		}
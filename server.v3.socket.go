@@ -1,7 +1,9 @@
 package socketio
 
 import (
+	"context"
 	"strings"
+	"time"
 
 	siot "github.com/njones/socketio/transport"
 )
@@ -32,6 +34,10 @@ func (v3 *inSocketV3) setIsServer(isServer bool)     { v3.prev.setIsServer(isSer
 func (v3 *inSocketV3) setIsSender(isSender bool)     { v3.prev.setIsSender(isSender) }
 func (v3 *inSocketV3) setSocketID(socketID SocketID) { v3.prev.setSocketID(socketID) }
 func (v3 *inSocketV3) setPrefix()                    { v3.prev.setPrefix() }
+func (v3 *inSocketV3) setTimeout(d time.Duration)    { v3.prev.setTimeout(d) }
+func (v3 *inSocketV3) setCollectAcks(collect bool)   { v3.prev.setCollectAcks(collect) }
+func (v3 *inSocketV3) setVolatile(volatile bool)     { v3.prev.setVolatile(volatile) }
+func (v3 *inSocketV3) setCompress(compress bool)     { v3.prev.setCompress(compress) }
 func (v3 *inSocketV3) setNsp(namespace Namespace)    { v3.prev.setNsp(namespace) }
 func (v3 *inSocketV3) addID(id siot.SocketID)        { v3.prev.addID(id) }
 func (v3 *inSocketV3) addTo(room Room)               { v3.prev.addTo(room) }
@@ -45,8 +51,36 @@ func (v3 inSocketV3) OnConnect(callback onConnectCallbackVersion3) {
 	v3.onConnect[v3.nsp()] = callback
 }
 func (v3 inSocketV3) OnDisconnect(callback func(string)) { v3.prev.OnDisconnect(callback) }
+func (v3 inSocketV3) OnDisconnectReason(callback func(DisconnectReason)) {
+	v3.prev.OnDisconnectReason(callback)
+}
+func (v3 inSocketV3) OnDisconnecting(callback func(DisconnectReason)) {
+	v3.prev.OnDisconnecting(callback)
+}
 
 func (v3 inSocketV3) On(event Event, callback eventCallback) { v3.prev.On(event, callback) }
+func (v3 inSocketV3) OnWithOff(event Event, callback eventCallback) func() {
+	return v3.prev.OnWithOff(event, callback)
+}
+func (v3 inSocketV3) Once(event Event, callback eventCallback) func() {
+	return v3.prev.Once(event, callback)
+}
+func (v3 inSocketV3) Off(event Event)                       { v3.prev.Off(event) }
+func (v3 inSocketV3) Listeners(event Event) []eventCallback { return v3.prev.Listeners(event) }
+
+// OnAny - registers a callback that is called for every incoming event, before the event
+// callbacks, and returns a func that removes this registration
+func (v3 inSocketV3) OnAny(callback func(event Event, args ...interface{})) func() {
+	return v3.prev.prev.onAny(callback)
+}
+
+// OffAny - removes all of the any callbacks, a single one is removed with the func that OnAny returns
+func (v3 inSocketV3) OffAny() { v3.prev.prev.offAny() }
+
+// ListenersAny - returns the any callbacks in the order they were registered
+func (v3 inSocketV3) ListenersAny() []func(event Event, args ...interface{}) {
+	return v3.prev.prev.listenersAny()
+}
 
 // Of - sending to all clients in namespace, including sender
 func (v3 inSocketV3) Of(namespace Namespace) inSocketV3 {
@@ -87,6 +121,14 @@ func (v3 *SocketV3) Emit(event Event, data ...Data) error {
 	return v3.prev.Emit(event, data...)
 }
 
+// EmitWithAck sends the event to the client and blocks until the client acknowledges
+// it, the ctx is done or the socket disconnects. It returns the acknowledgement data.
+// Calling it from inside of an event callback is fine, the later events of the socket
+// wait for the callback to return.
+func (v3 *SocketV3) EmitWithAck(ctx context.Context, event Event, data ...Data) ([]interface{}, error) {
+	return v3.prev.prev.emitWithAck(ctx, event, data...)
+}
+
 func (v3 *SocketV3) Join(room Room) error {
 	return v3.tr().Join(v3.nsp(), v3.socketID(), strings.Replace(room, v3.prefix(), socketIDPrefix, 1))
 }
@@ -94,6 +136,21 @@ func (v3 *SocketV3) Leave(room Room) error {
 	return v3.tr().Leave(v3.nsp(), v3.socketID(), room)
 }
 
-func (v3 *SocketV3) Broadcast() emit             { v3.setIsSender(true); return v3.inSocketV3 }
-func (v3 *SocketV3) Volatile() emit              { return v3 } // NOT IMPLEMENTED...
-func (v3 *SocketV3) Compress(compress bool) emit { return v3 } // NOT IMPLEMENTED...
+func (v3 *SocketV3) Broadcast() emit { v3.setIsSender(true); return v3.inSocketV3 }
+
+// Volatile - the event data may be lost if the client is not ready to receive it, there
+// is no acknowledgement of it
+func (v3 *SocketV3) Volatile() emit {
+	rtn := *v3
+	rtn.inSocketV3 = v3.clone()
+	rtn.setVolatile(true)
+	return &rtn
+}
+
+// Compress - sets the compress flag for the event data
+func (v3 *SocketV3) Compress(compress bool) emit {
+	rtn := *v3
+	rtn.inSocketV3 = v3.clone()
+	rtn.setCompress(compress)
+	return &rtn
+}
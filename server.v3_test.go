@@ -2,6 +2,7 @@ package socketio_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -104,6 +105,7 @@ func TestServerV3(t *testing.T) {
 		"sending to a specific room in a specific namespace, including sender":    SendingToASpecificRoomInNamespaceMyNamespaceIncludingSenderV3,
 		"sending to individual socketid (private message)":                        SendingToIndividualSocketIDPrivateMessageV3,
 		"sending with acknowledgement":                                            SendingWithAcknowledgementV3,
+		"emit with acknowledgement":                                               EmitWithAcknowledgementV3,
 		"sending to all connected clients":                                        SendingToAllConnectedClientsV3,
 
 		// extra
@@ -737,6 +739,44 @@ func SendingWithAcknowledgementV3(t *testing.T) []testDataOptFunc {
 	}
 }
 
+func EmitWithAcknowledgementV3(t *testing.T) []testDataOptFunc {
+	var (
+		v3   = socketio.NewServerV3(testingOptionsV3...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"grab1": {{`421["question","do you think so?"]`}},
+			"send2": {{`431["answer",42]`}},
+		}
+		count = len(want["grab1"])
+	)
+
+	checkCount(t, count)
+
+	var question = serialize.String("do you think so?")
+
+	wait.Add(count)
+	v3.OnConnect(func(socket *socketio.SocketV3) error {
+		wait.Done()
+
+		go func() {
+			defer wait.Done()
+
+			have, err := socket.EmitWithAck(context.Background(), "question", question)
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"answer", float64(42)}, have)
+		}()
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v3 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
 func SendingToAllConnectedClientsV3(t *testing.T) []testDataOptFunc {
 	var (
 		v3   = socketio.NewServerV3(testingOptionsV3...)
@@ -839,6 +879,9 @@ func OnEventV3(t *testing.T) []testDataOptFunc {
 		})
 
 		v3.OnDisconnect(func(reason string) {
+			if reason != socketio.ClientNamespaceDisconnect.String() {
+				return // the session of the other clients times out later
+			}
 			defer wait.Done()
 
 			v3.In("room").Emit("say goodbye", serialize.String("disconnecting..."))
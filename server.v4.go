@@ -1,7 +1,12 @@
 package socketio
 
 import (
+	"context"
 	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
 
 	nmem "github.com/njones/socketio/adaptor/transport/memory"
 	eio "github.com/njones/socketio/engineio"
@@ -23,6 +28,12 @@ func (v4 *handshakeV4) init() {
 type ServerV4 struct {
 	inSocketV4
 
+	recovery  time.Duration // the max disconnection duration of the connection state recovery
+	recovered *sync.Map     // the restored session state waiting on the connect packet
+	expiring  *sync.Map     // the cleanup timers of the disconnected sockets waiting on recovery
+
+	parents []*ParentNamespaceV4
+
 	prev *ServerV3
 }
 
@@ -34,7 +45,7 @@ func NewServerV4(opts ...Option) *ServerV4 {
 	v2 := v3.prev
 	v1 := v2.prev
 
-	v1.eio = eio.NewServerV5(eio.WithPath(*v1.path)).(eio.EIOServer)
+	v1.eio = eio.NewServerV5(eio.WithPath(*v1.path), eio.WithSessionClose(sessionClose(v1))).(eio.EIOServer)
 	v1.eio.With(opts...)
 
 	v4.With(opts...)
@@ -44,6 +55,9 @@ func NewServerV4(opts ...Option) *ServerV4 {
 func (v4 *ServerV4) new(opts ...Option) Server {
 	v4.prev = (&ServerV3{}).new(opts...).(*ServerV3)
 	v4.onConnect = make(map[Namespace]onConnectCallbackVersion4)
+	v4.use = make(map[Namespace][]middlewareVersion4)
+	v4.recovered = new(sync.Map)
+	v4.expiring = new(sync.Map)
 
 	v3 := v4.prev
 	v2 := v3.prev
@@ -56,6 +70,7 @@ func (v4 *ServerV4) new(opts ...Option) Server {
 
 	v1.protectedEventName = v4ProtectedEventName
 	v1.doConnectPacket = doConnectPacketV4(v4)
+	v1.doSessionClose = doSessionCloseV4(v4)
 
 	v4.inSocketV4.prev = v3.inSocketV3.clone()
 
@@ -87,13 +102,122 @@ func (v4 *ServerV4) Of(namespace Namespace) inSocketV4 {
 	return rtn.Of(namespace)
 }
 
+// OfMatch - the child namespaces that match the regexp, see OfFunc
+func (v4 *ServerV4) OfMatch(re *regexp.Regexp) *ParentNamespaceV4 {
+	return v4.OfFunc(func(namespace Namespace, _ map[string]interface{}) bool {
+		return re.MatchString(namespace)
+	})
+}
+
+// OfFunc - the child namespaces that the function returns true for, the function gets the
+// namespace and the handshake auth. A child namespace is created when a client first connects
+// to it, and uses the OnConnect callback and middleware of the parent. The namespaces that
+// are registered with Of are used before any of the parent namespaces.
+func (v4 *ServerV4) OfFunc(match func(namespace Namespace, auth map[string]interface{}) bool) *ParentNamespaceV4 {
+	parent := &ParentNamespaceV4{server: v4, match: match, ʟ: new(sync.RWMutex), children: make(map[Namespace]struct{})}
+
+	defer v4.prev.prev.prev.l()()
+	v4.parents = append(v4.parents, parent)
+	return parent
+}
+
+// parent returns the first parent namespace that matches, or nil
+func (v4 *ServerV4) parent(namespace Namespace, auth map[string]interface{}) *ParentNamespaceV4 {
+	unlock := v4.prev.prev.prev.r()
+	parents := v4.parents
+	unlock()
+
+	for _, parent := range parents {
+		if parent.match(namespace, auth) {
+			return parent
+		}
+	}
+	return nil
+}
+
 func (v4 *ServerV4) To(room ...Room) innTooExceptEmit {
 	rtn := v4.clone()
 	rtn.setIsServer(true)
 	return rtn.To(room...)
 }
 
+func (v4 *ServerV4) Timeout(dur time.Duration) innTooExceptEmit {
+	rtn := v4.clone()
+	rtn.setIsServer(true)
+	return rtn.Timeout(dur)
+}
+
+func (v4 *ServerV4) VolatileDropped() uint64 { return v4.prev.VolatileDropped() }
+
 func (v4 *ServerV4) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	v1 := v4.prev.prev.prev
 	v1.ServeHTTP(w, r)
 }
+
+// Shutdown gracefully shuts down the server, see ServerV1.Shutdown
+func (v4 *ServerV4) Shutdown(ctx context.Context) error {
+	v1 := v4.prev.prev.prev
+	return v1.Shutdown(ctx)
+}
+
+// ParentNamespaceV4 is the group of the dynamic child namespaces that are matched by
+// ServerV4.OfMatch or ServerV4.OfFunc. Use ServerV4.Of to emit to only one child.
+type ParentNamespaceV4 struct {
+	server *ServerV4
+	match  func(Namespace, map[string]interface{}) bool
+
+	ʟ         *sync.RWMutex
+	onConnect onConnectCallbackVersion4
+	use       []middlewareVersion4
+	children  map[Namespace]struct{}
+}
+
+// OnConnect - the callback for the clients that connect to any of the child namespaces
+func (p *ParentNamespaceV4) OnConnect(callback onConnectCallbackVersion4) {
+	p.ʟ.Lock()
+	defer p.ʟ.Unlock()
+	p.onConnect = callback
+}
+
+// Use - registers a middleware for the clients that connect to any of the child namespaces
+func (p *ParentNamespaceV4) Use(middleware middlewareVersion4) {
+	p.ʟ.Lock()
+	defer p.ʟ.Unlock()
+	p.use = append(p.use, middleware)
+}
+
+// Children - the sorted names of the child namespaces that have been created
+func (p *ParentNamespaceV4) Children() []Namespace {
+	p.ʟ.RLock()
+	defer p.ʟ.RUnlock()
+
+	rtn := make([]Namespace, 0, len(p.children))
+	for namespace := range p.children {
+		rtn = append(rtn, namespace)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+// Emit - sending to all clients in all of the child namespaces
+func (p *ParentNamespaceV4) Emit(event Event, data ...Data) error {
+	for _, namespace := range p.Children() {
+		if err := p.server.Of(namespace).Emit(event, data...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handlers returns the OnConnect callback and middleware that the child namespaces use
+func (p *ParentNamespaceV4) handlers() (onConnectCallbackVersion4, []middlewareVersion4) {
+	p.ʟ.RLock()
+	defer p.ʟ.RUnlock()
+	return p.onConnect, p.use
+}
+
+func (p *ParentNamespaceV4) addChild(namespace Namespace) {
+	p.ʟ.Lock()
+	defer p.ʟ.Unlock()
+	p.children[namespace] = struct{}{}
+}
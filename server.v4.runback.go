@@ -3,6 +3,7 @@ package socketio
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	siop "github.com/njones/socketio/protocol"
 	siot "github.com/njones/socketio/transport"
@@ -14,9 +15,10 @@ func doConnectPacketV4(v4 *ServerV4) func(SocketID, siot.Socket, *Request) error
 		tr := v4.tr()
 		unlock()
 
-		tr.Join(socket.Namespace, socketID, socketID.Room(socketIDPrefix))
+		state, recovered := v4.recovered.LoadAndDelete(recoveredKey{socket.Namespace, socketID})
 
-		stopBuffer := tr.(rawTransport).Transport(socketID).StartBuffer()
+		transport := tr.(rawTransport).Transport(socketID)
+		stopBuffer := transport.StartBuffer()
 		defer stopBuffer()
 
 		v4.setPrefix()
@@ -31,22 +33,81 @@ func doConnectPacketV4(v4 *ServerV4) func(SocketID, siot.Socket, *Request) error
 			}
 		}
 
-		if fn, ok := v4.onConnect[socket.Namespace]; ok {
-			return fn(&SocketV4{inSocketV4: v4.inSocketV4.clone(), req: req, han: h})
+		fn, hasOnConnect := v4.onConnect[socket.Namespace]
+		use, hasMiddleware := v4.use[socket.Namespace]
+
+		var parent *ParentNamespaceV4
+		if !hasOnConnect && !hasMiddleware {
+			h.init()
+			if parent = v4.parent(socket.Namespace, h.Auth()); parent == nil {
+				return ErrNamespaceNotFound.F(socket.Namespace)
+			}
+			fn, use = parent.handlers()
+			hasOnConnect = fn != nil
+		}
+
+		var data map[string]interface{}
+		if recovered {
+			data, _ = state.(siot.SessionState).Details.Data.(map[string]interface{})
+		}
+
+		sock := &SocketV4{inSocketV4: v4.inSocketV4.clone(), req: req, han: h, data: newSocketData(data), recovered: recovered}
+		if err := v4.middleware(sock, use); err != nil {
+			return err
+		}
+
+		// the socket is only in the namespace once it's been let in by the middleware
+		tr.Join(socket.Namespace, socketID, socketID.Room(socketIDPrefix))
+
+		if parent != nil {
+			parent.addChild(socket.Namespace)
+		}
+
+		if recovered {
+			// the missed packets are buffered, so they are sent right after the connect packet
+			for _, missed := range state.(siot.SessionState).Missed {
+				opts := []siop.Option{siop.WithType(missed.Type), siop.WithNamespace(missed.Namespace)}
+				if missed.AckID > 0 {
+					opts = append(opts, siop.WithAckID(missed.AckID))
+				}
+				transport.Send(missed.Data, opts...)
+			}
+		}
+
+		if detailer, ok := tr.(siot.Detailer); ok {
+			auth := sock.Handshake().Auth()
+			sock.data.persist(func(data map[string]interface{}) {
+				detailer.SetDetails(socket.Namespace, socketID, siot.SocketDetails{Auth: auth, Data: data})
+			})
 		}
 
-		return ErrNamespaceNotFound.F(socket.Namespace)
+		if hasOnConnect {
+			return fn(sock)
+		}
+		return nil
 	}
 }
 
-func runV4(v4 *ServerV4) func(SocketID, *Request) error {
-	return func(socketID SocketID, req *Request) error {
+func runV4(v4 *ServerV4) func(SocketID, SessionID, *Request) error {
+	return func(socketID SocketID, sessionID SessionID, req *Request) error {
 		unlock := v4.prev.prev.prev.r()
 		tr := v4.tr()
 		unlock()
 
+		in := v4.prev.prev.prev.queues.session(sessionID)
+		req = req.withSession(in.ctx)
+		handle := closeAttachments(func(socketID SocketID, socket siot.Socket) error { return doV4(v4, socketID, socket, req) })
 		for socket := range tr.Receive(socketID) {
-			if err := doV4(v4, socketID, socket, req); err != nil {
+			if socket.Type == siop.ConnectPacket.Byte() {
+				socketID = restoreSessionV4(v4, socketID, socket)
+			}
+			if onReceive(socket.Type) {
+				if err := handle(socketID, socket); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := in.add(socketID, socket, handle); err != nil {
 				return err
 			}
 		}
@@ -63,19 +124,164 @@ func doV4(v4 *ServerV4, socketID SocketID, socket siot.Socket, req *Request) err
 		tr := v4.tr()
 		unlock()
 
+		pid := persistSessionV4(v4, socketID, socket)
+
 		if err := v1.doConnectPacket(socketID, socket, req); err != nil {
 			if errors.Is(err, ErrNamespaceNotFound) {
 				tr.Send(socketID, serviceError(fmt.Errorf("%valid namespace", "Inv")), siop.WithNamespace(socket.Namespace), siop.WithType(byte(siop.ConnectErrorPacket)))
 				return nil
 			}
-			tr.Send(socketID, serviceError(err), siop.WithType(byte(siop.ConnectErrorPacket)))
+			tr.Send(socketID, serviceError(err), siop.WithNamespace(socket.Namespace), siop.WithType(byte(siop.ConnectErrorPacket)))
 			return nil
 		}
 
 		connectResponse := map[string]interface{}{"sid": socketID.String()}
+		if pid != "" {
+			connectResponse["pid"] = pid.String()
+		}
 		tr.Send(socketID, connectResponse, siop.WithType(siop.ConnectPacket.Byte()), siop.WithNamespace(socket.Namespace))
 		tr.(rawTransport).Transport(socketID).SendBuffer()
 		return nil
 	}
 	return doV3(v4.prev, socketID, socket, req)
 }
+
+// doServerSideEmitV4 calls the server callbacks of an event that was sent by another server
+// with ServerSideEmit. The first callback that can acknowledge the event returns the ack.
+func doServerSideEmitV4(v4 *ServerV4) func(Namespace, []interface{}) []interface{} {
+	in := v4.prev.prev.prev.inSocketV1.clone() // the callbacks are shared by the clone
+	return func(ns Namespace, data []interface{}) (rtn []interface{}) {
+		if len(data) == 0 {
+			return nil
+		}
+		event, ok := data[0].(string)
+		if !ok {
+			return nil
+		}
+
+		var acked bool
+		for _, fn := range in.callbacks(ns, event, serverEvent) {
+			if ack, ok := fn.(eventCallbackAck); ok && !acked {
+				acked = true
+				if ackErr, ok := fn.(eventCallbackAckErr); ok {
+					if vals, err := ackErr.CallbackAckErr(data[1:]...); err == nil {
+						rtn = vals
+					}
+					continue
+				}
+				rtn = ack.CallbackAck(data[1:]...)
+				continue
+			}
+			fn.Callback(data[1:]...)
+		}
+		return rtn
+	}
+}
+
+// doRemoteDisconnectV4 disconnects the socket of this server from the namespace, when
+// another server has called Disconnect on the RemoteSocketV4 of the socket.
+func doRemoteDisconnectV4(v4 *ServerV4) func(Namespace, SocketID, bool) error {
+	in := v4.prev.prev.prev.inSocketV1.clone() // the callbacks are shared by the clone
+	return func(ns Namespace, socketID SocketID, close bool) error {
+		socket := in.clone()
+		socket.setNsp(ns)
+		socket.setSocketID(socketID)
+		return socket.disconnect(close)
+	}
+}
+
+// recoveredKey is the key for the restored session state of the socket in the namespace
+type recoveredKey struct {
+	ns Namespace
+	id SocketID
+}
+
+// restoreSessionV4 restores the session when the client is recovering the connection state
+// with a private id and offset. It returns the restored socket id, which is used for the rest
+// of the packets, otherwise the socketID is returned.
+func restoreSessionV4(v4 *ServerV4, socketID SocketID, socket siot.Socket) SocketID {
+	auth, _ := socket.Data.(map[string]interface{})
+	pid, _ := auth["pid"].(string)
+	offset, _ := auth["offset"].(string)
+	if v4.recovery <= 0 || pid == "" || offset == "" {
+		return socketID
+	}
+
+	unlock := v4.prev.prev.prev.r()
+	tr := v4.tr()
+	unlock()
+
+	recoverer, ok := tr.(siot.Recoverer)
+	if !ok {
+		return socketID
+	}
+
+	state, err := recoverer.RestoreSession(socket.Namespace, siot.PrivateID(pid), offset, socketID)
+	if err != nil {
+		return socketID // the client gets a new session
+	}
+
+	if timer, ok := v4.expiring.LoadAndDelete(recoveredKey{socket.Namespace, state.SocketID}); ok {
+		timer.(*time.Timer).Stop() // the socket stays in its rooms
+	}
+	v4.recovered.Store(recoveredKey{socket.Namespace, state.SocketID}, state)
+	return state.SocketID
+}
+
+// doSessionCloseV4 disconnects the socket of the ended session from all of the namespaces
+// that it's still in. When the connection state can be recovered the socket is kept in its
+// rooms until the max disconnection duration has passed without the session being restored.
+func doSessionCloseV4(v4 *ServerV4) func(SessionID, DisconnectReason) {
+	v1 := v4.prev.prev.prev
+	closeSession := doSessionClose(v1)
+
+	return func(sessionID SessionID, reason DisconnectReason) {
+		if v4.recovery <= 0 || !reason.recoverable() {
+			closeSession(sessionID, reason)
+			return
+		}
+
+		unlock := v1.r()
+		tr := v4.tr()
+		unlock()
+
+		closer, ok := tr.(siot.SessionCloser)
+		if !ok {
+			v1.queues.close(sessionID)
+			return
+		}
+
+		socketID, namespaces := closer.CloseSession(sessionID)
+		v1.drainSession(sessionID, socketID, namespaces)
+		for _, namespace := range namespaces {
+			v1.disconnectSocket(namespace, socketID, reason, false)
+
+			key := recoveredKey{namespace, socketID}
+			namespace := namespace
+			v4.expiring.Store(key, time.AfterFunc(v4.recovery, func() {
+				if _, ok := v4.expiring.LoadAndDelete(key); ok {
+					v1.leaveAll(namespace, socketID)
+				}
+			}))
+		}
+	}
+}
+
+// persistSessionV4 persists the session of the socket in the namespace, so that the event
+// packets are kept for the connection state recovery. It returns the private id.
+func persistSessionV4(v4 *ServerV4, socketID SocketID, socket siot.Socket) siot.PrivateID {
+	if v4.recovery <= 0 {
+		return ""
+	}
+
+	unlock := v4.prev.prev.prev.r()
+	tr := v4.tr()
+	unlock()
+
+	if recoverer, ok := tr.(siot.Recoverer); ok {
+		if pid, err := recoverer.PersistSession(socket.Namespace, socketID, v4.recovery); err == nil {
+			return pid
+		}
+	}
+	return ""
+}
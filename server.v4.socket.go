@@ -1,7 +1,11 @@
 package socketio
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	seri "github.com/njones/socketio/serialize"
@@ -21,11 +25,17 @@ type innTooExceptEmit interface {
 	In(...Room) innTooExceptEmit
 	To(...Room) innTooExceptEmit
 	Except(...Room) innTooExceptEmit
+	Timeout(time.Duration) innTooExceptEmit
+	FetchSockets() ([]*RemoteSocketV4, error)
+	SocketsJoin(...Room) error
+	SocketsLeave(...Room) error
+	DisconnectSockets(close bool) error
 	emit
 }
 
 type inSocketV4 struct {
 	onConnect map[Namespace]onConnectCallbackVersion4
+	use       map[Namespace][]middlewareVersion4
 
 	prev inSocketV3
 
@@ -35,7 +45,7 @@ type inSocketV4 struct {
 func (v4 *inSocketV4) clone() inSocketV4 {
 	rtn := *v4
 	rtn.prev.prev.prev = v4.prev.prev.prev.clone()
-	// rtn.onConnect is a map that gets copied by reference
+	// rtn.onConnect and rtn.use are maps that get copied by reference
 	return rtn
 }
 
@@ -43,6 +53,10 @@ func (v4 *inSocketV4) setIsServer(isServer bool)     { v4.prev.setIsServer(isSer
 func (v4 *inSocketV4) setIsSender(isSender bool)     { v4.prev.setIsSender(isSender) }
 func (v4 *inSocketV4) setSocketID(socketID SocketID) { v4.prev.setSocketID(socketID) }
 func (v4 *inSocketV4) setPrefix()                    { v4.prev.setPrefix() }
+func (v4 *inSocketV4) setTimeout(d time.Duration)    { v4.prev.setTimeout(d) }
+func (v4 *inSocketV4) setCollectAcks(collect bool)   { v4.prev.setCollectAcks(collect) }
+func (v4 *inSocketV4) setVolatile(volatile bool)     { v4.prev.setVolatile(volatile) }
+func (v4 *inSocketV4) setCompress(compress bool)     { v4.prev.setCompress(compress) }
 func (v4 *inSocketV4) setNsp(namespace Namespace)    { v4.prev.setNsp(namespace) }
 func (v4 *inSocketV4) addID(id siot.SocketID)        { v4.prev.addID(id) }
 func (v4 *inSocketV4) addTo(room Room)               { v4.prev.addTo(room) }
@@ -60,8 +74,64 @@ func (v4 inSocketV4) OnConnect(callback onConnectCallbackVersion4) {
 	v4.onConnect[v4.nsp()] = callback
 }
 func (v4 inSocketV4) OnDisconnect(callback func(string)) { v4.prev.OnDisconnect(callback) }
+func (v4 inSocketV4) OnDisconnectReason(callback func(DisconnectReason)) {
+	v4.prev.OnDisconnectReason(callback)
+}
+func (v4 inSocketV4) OnDisconnecting(callback func(DisconnectReason)) {
+	v4.prev.OnDisconnecting(callback)
+}
 
 func (v4 inSocketV4) On(event Event, callback eventCallback) { v4.prev.On(event, callback) }
+func (v4 inSocketV4) OnWithOff(event Event, callback eventCallback) func() {
+	return v4.prev.OnWithOff(event, callback)
+}
+func (v4 inSocketV4) Once(event Event, callback eventCallback) func() {
+	return v4.prev.Once(event, callback)
+}
+func (v4 inSocketV4) Off(event Event)                       { v4.prev.Off(event) }
+func (v4 inSocketV4) Listeners(event Event) []eventCallback { return v4.prev.Listeners(event) }
+
+func (v4 inSocketV4) OnAny(callback func(event Event, args ...interface{})) func() {
+	return v4.prev.OnAny(callback)
+}
+func (v4 inSocketV4) OffAny() { v4.prev.OffAny() }
+func (v4 inSocketV4) ListenersAny() []func(event Event, args ...interface{}) {
+	return v4.prev.ListenersAny()
+}
+
+// OnAnyOutgoing - registers a callback that is called for every outgoing event, before it is
+// sent, and returns a func that removes this registration
+func (v4 inSocketV4) OnAnyOutgoing(callback func(event Event, args ...interface{})) func() {
+	return v4.prev.prev.prev.onAnyOutgoing(callback)
+}
+
+// OffAnyOutgoing - removes all of the outgoing any callbacks, a single one is removed with the
+// func that OnAnyOutgoing returns
+func (v4 inSocketV4) OffAnyOutgoing() { v4.prev.prev.prev.offAnyOutgoing() }
+
+// ListenersAnyOutgoing - returns the outgoing any callbacks in the order they were registered
+func (v4 inSocketV4) ListenersAnyOutgoing() []func(event Event, args ...interface{}) {
+	return v4.prev.prev.prev.listenersAnyOutgoing()
+}
+
+// Use - registers a middleware that runs for every client connecting to the namespace,
+// in the order it was registered, before OnConnect is called. The middleware must
+// call next, a non-nil error rejects the connection with a CONNECT_ERROR packet.
+func (v4 inSocketV4) Use(middleware middlewareVersion4) {
+	v4.use[v4.nsp()] = append(v4.use[v4.nsp()], middleware)
+}
+
+// middleware runs all of the namespace middleware for the socket, and returns the
+// first error that is passed to next.
+func (v4 inSocketV4) middleware(socket *SocketV4, use []middlewareVersion4) error {
+	for _, fn := range use {
+		fn := fn
+		if err := waitNext(socket.req.sessionContext(), func(next func(error)) { fn(socket, next) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
 // Of - sending to all clients in namespace, including sender
 func (v4 inSocketV4) Of(namespace Namespace) inSocketV4 {
@@ -95,79 +165,275 @@ func (v4 inSocketV4) Except(rooms ...Room) innTooExceptEmit {
 	return rtn
 }
 
+// Timeout - the acknowledgement callback is called once, after every client has
+// acknowledged the broadcast or the duration has passed. The callback gets an error
+// when any of the clients timed out, followed by the collected BroadcastAck.
+func (v4 inSocketV4) Timeout(dur time.Duration) innTooExceptEmit {
+	rtn := v4.clone()
+	rtn.setTimeout(dur)
+	rtn.setCollectAcks(true)
+	return rtn
+}
+
 // Emit - sending to all connected clients
 func (v4 inSocketV4) Emit(event Event, data ...Data) error {
-	v3 := v4.prev
-	v2 := v3.prev
-	v1 := v2.prev
+	v1 := v4.prev.prev.prev
 
-	transport := v1.tr().(siot.Emitter)
+	// a transport that can broadcast is sent the rooms once, instead of each socket id
+	broadcaster, canBroadcast := v1.tr().(siot.Broadcaster)
+	canBroadcast = canBroadcast && len(v1.id) == 0 && !hasCallback(data)
 
-	if len(v1.id) == 0 && len(v1.to) == 0 {
-		for _, id := range transport.Sockets(v1.nsp()).IDs() {
-			if id == v1._socketID && v1.isSender {
-				continue // skip sending back to sender
-			}
+	broadcastAll := len(v1.id) == 0 && len(v1.to) == 0
+	if (broadcastAll || len(v1.to) > 0) && !canBroadcast {
+		ids, err := v4.targets()
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
 			v1.addID(id)
 		}
+	}
+
+	if broadcastAll {
 		// send to local server ... since this is not a broadcast
-		if ns, ok := v1.events[v1.nsp()]; ok {
-			if events, ok := ns[event][v1._socketID]; ok {
-				events.Callback(seri.Convert(data).ToInterface()...)
-			}
+		for _, fn := range v1.callbacks(v1.nsp(), event, v1._socketID) {
+			fn.Callback(seri.Convert(data).ToInterface()...)
 		}
-		return v1.emit(event, data...)
+	}
+	if canBroadcast {
+		return v1.broadcast(broadcaster, v4.broadcastOptions(), event, data...)
+	}
+	return v1.emit(event, data...)
+}
+
+// broadcastOptions returns the rooms and the except rooms of the broadcast, the sender is
+// skipped the same as it is by targets.
+func (v4 inSocketV4) broadcastOptions() siot.BroadcastOptions {
+	v1 := v4.prev.prev.prev
+
+	opts := siot.BroadcastOptions{Rooms: v1.to, Except: v4.except, Volatile: v1.volatile}
+	skipSender := v1.isSender
+	if len(v1.to) > 0 {
+		skipSender = !v1.isServer
+	}
+	if skipSender && v1._socketID != "" {
+		opts.Except = append(append([]Room{}, v4.except...), v1._socketID.String())
+	}
+	return opts
+}
+
+// targets returns the socket ids in the namespace that are in the rooms, or every socket
+// id when there are no rooms, without any of the sockets that are in the except rooms.
+func (v4 inSocketV4) targets() ([]SocketID, error) {
+	v1 := v4.prev.prev.prev
+	sockets := v1.tr().(siot.Emitter).Sockets(v1.nsp())
+	if err := sockets.Err(); err != nil {
+		return nil, ErrFromRoomFailed.F(err)
 	}
 
-	var uniqueID = map[SocketID]struct{}{}
+	var skip = map[SocketID]struct{}{}
 	for _, exceptRoom := range v4.except {
-		rooms, err := transport.Sockets(v1.nsp()).FromRoom(exceptRoom)
+		ids, err := sockets.FromRoom(exceptRoom)
 		if err != nil {
-			ErrFromRoomFailed.F(err)
+			return nil, ErrFromRoomFailed.F(err)
 		}
-		for _, id := range rooms {
-			uniqueID[id] = struct{}{}
+		for _, id := range ids {
+			skip[id] = struct{}{}
+		}
+	}
+
+	var rtn []SocketID
+	if len(v1.to) == 0 {
+		if v1.isSender {
+			skip[v1._socketID] = struct{}{} // skip sending back to sender
+		}
+		for _, id := range sockets.IDs() {
+			if _, inSet := skip[id]; !inSet {
+				rtn = append(rtn, id)
+				skip[id] = struct{}{}
+			}
 		}
+		return rtn, nil
+	}
+
+	if !v1.isServer {
+		skip[v1._socketID] = struct{}{} // skip sending back to sender
 	}
 	for _, toRoom := range v1.to {
-		ids, err := transport.Sockets(v1.nsp()).FromRoom(toRoom)
+		ids, err := sockets.FromRoom(toRoom)
 		if err != nil {
-			ErrFromRoomFailed.F(err)
+			return nil, ErrFromRoomFailed.F(err)
 		}
-
 		for _, id := range ids {
-			if id == v1._socketID && !v1.isServer {
-				continue // skip sending back to sender
+			if _, inSet := skip[id]; !inSet {
+				rtn = append(rtn, id)
+				skip[id] = struct{}{}
 			}
+		}
+	}
+	return rtn, nil
+}
 
-			if _, inSet := uniqueID[id]; !inSet {
-				v1.addID(id)
-				uniqueID[id] = struct{}{}
-			}
+// FetchSockets - returns the sockets that are in the rooms, or every socket in the namespace
+func (v4 inSocketV4) FetchSockets() ([]*RemoteSocketV4, error) {
+	ids, err := v4.targets()
+	if err != nil {
+		return nil, err
+	}
+
+	rtn := make([]*RemoteSocketV4, 0, len(ids))
+	for _, id := range ids {
+		rtn = append(rtn, v4.remote(id))
+	}
+	return rtn, nil
+}
+
+// SocketsJoin - makes the matching sockets join the rooms
+func (v4 inSocketV4) SocketsJoin(rooms ...Room) error {
+	sockets, err := v4.FetchSockets()
+	if err != nil {
+		return err
+	}
+	for _, socket := range sockets {
+		if err := socket.Join(rooms...); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return v1.emit(event, data...)
+// SocketsLeave - makes the matching sockets leave the rooms
+func (v4 inSocketV4) SocketsLeave(rooms ...Room) error {
+	sockets, err := v4.FetchSockets()
+	if err != nil {
+		return err
+	}
+	for _, socket := range sockets {
+		if err := socket.Leave(rooms...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisconnectSockets - disconnects the matching sockets, see SocketV4.Disconnect
+func (v4 inSocketV4) DisconnectSockets(close bool) error {
+	sockets, err := v4.FetchSockets()
+	if err != nil {
+		return err
+	}
+	for _, socket := range sockets {
+		if err := socket.Disconnect(close); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServerSideEmit - sends the event to the other servers that share the transport adaptor,
+// where it is received by the callbacks that are registered with On for the namespace
+func (v4 inSocketV4) ServerSideEmit(event Event, data ...Data) error {
+	emitter, args, err := v4.serverSide(event, data)
+	if err != nil {
+		return err
+	}
+	return emitter.ServerSideEmit(v4.nsp(), args)
+}
+
+// ServerSideEmitWithAck - sends the event the same as ServerSideEmit, and returns the
+// acknowledgement of each of the other servers. When a server has not answered before the
+// ctx is done, the acknowledgements that were received are returned with an error.
+func (v4 inSocketV4) ServerSideEmitWithAck(ctx context.Context, event Event, data ...Data) ([][]interface{}, error) {
+	emitter, args, err := v4.serverSide(event, data)
+	if err != nil {
+		return nil, err
+	}
+	return emitter.ServerSideEmitWithAck(ctx, v4.nsp(), args)
+}
+
+func (v4 inSocketV4) serverSide(event Event, data []Data) (siot.ServerSideEmitter, []interface{}, error) {
+	v1 := v4.prev.prev.prev
+	if _, ok := v1.protectedEventName[event]; ok {
+		return nil, nil, ErrUnsupportedEventName.F(event)
+	}
+
+	emitter, ok := v4.tr().(siot.ServerSideEmitter)
+	if !ok {
+		return nil, nil, ErrServerSideEmit
+	}
+
+	_, args, _, err := scrub(true, event, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return emitter, args.([]interface{}), nil
+}
+
+// remote returns the handle for the socketID, using the details that are kept by the transport
+func (v4 inSocketV4) remote(socketID SocketID) *RemoteSocketV4 {
+	rtn := &RemoteSocketV4{inSocketV4: v4.clone()}
+
+	// the handle only sends to the socket, so clear out the rooms and ids from the chain
+	v1 := &rtn.prev.prev.prev
+	v1.id, v1.to, v1._uniqID = nil, nil, nil
+	rtn.except = nil
+
+	rtn.setIsServer(false)
+	rtn.setIsSender(false)
+	rtn.setSocketID(socketID)
+
+	transport := v4.tr()
+	if emitter, ok := transport.(siot.Emitter); ok {
+		rtn.rooms = emitter.Rooms(v4.nsp(), socketID).Names()
+	}
+	if detailer, ok := transport.(siot.Detailer); ok {
+		if details, err := detailer.Details(v4.nsp(), socketID); err == nil {
+			rtn.han.Auth = func() map[string]interface{} { return details.Auth }
+			rtn.data, _ = details.Data.(map[string]interface{})
+		}
+	}
+	return rtn
 }
 
 type onConnectCallbackVersion4 = func(*SocketV4) error
+type middlewareVersion4 = func(*SocketV4, func(error))
 
 type SocketV4 struct {
 	inSocketV4
 
-	han handshakeV4
-	req *Request
+	han  handshakeV4
+	req  *Request
+	data *SocketData
+
+	recovered bool
 }
 
 func (v4 *SocketV4) ID() SocketID           { return SocketID(v4.prefix()) + v4.socketID() }
 func (v4 *SocketV4) Request() *Request      { return v4.req }
 func (v4 *SocketV4) Handshake() handshakeV4 { v4.han.init(); return v4.han }
 
+// Data - the arbitrary data of the socket, this is available in the middleware and is
+// kept by the transport adaptor, so that it can be read from the FetchSockets results
+func (v4 *SocketV4) Data() *SocketData { return v4.data }
+
+// Recovered - the socket was restored by the connection state recovery, with the same
+// id and rooms, and the missed event packets were sent to the client
+func (v4 *SocketV4) Recovered() bool { return v4.recovered }
+
 func (v4 *SocketV4) Emit(event Event, data ...Data) error {
 	v4.addID(v4.socketID())
 	return v4.prev.Emit(event, data...)
 }
 
+// EmitWithAck sends the event to the client and blocks until the client acknowledges
+// it, the ctx is done or the socket disconnects. It returns the acknowledgement data.
+// The event callbacks of a socket run in order on their own goroutine, while the
+// acknowledgements are handled as they arrive, so it may be called from inside of an
+// event callback. The next event of the socket is handled once the callback returns.
+func (v4 *SocketV4) EmitWithAck(ctx context.Context, event Event, data ...Data) ([]interface{}, error) {
+	return v4.prev.prev.prev.emitWithAck(ctx, event, data...)
+}
+
 func (v4 *SocketV4) Join(room Room) error {
 	return v4.tr().Join(v4.nsp(), v4.socketID(), strings.Replace(room, v4.prefix(), socketIDPrefix, 1))
 }
@@ -175,7 +441,228 @@ func (v4 *SocketV4) Leave(room Room) error {
 	return v4.tr().Leave(v4.nsp(), v4.socketID(), room)
 }
 
-func (v4 *SocketV4) Broadcast() emit                { v4.setIsSender(true); return v4.inSocketV4 }
-func (v4 *SocketV4) Volatile() emit                 { return v4 } // NOT IMPLEMENTED...
-func (v4 *SocketV4) Compress(compress bool) emit    { return v4 } // NOT IMPLEMENTED...
-func (v4 *SocketV4) Timeout(dur time.Duration) emit { return v4 } // NOT IMPLEMENTED...
+// Rooms - the rooms that the socket is in, which includes the room of the socket id. The
+// rooms are still there in the OnDisconnecting callback, but not in the OnDisconnect callback
+func (v4 *SocketV4) Rooms() []Room {
+	emitter, ok := v4.tr().(siot.Emitter)
+	if !ok {
+		return nil
+	}
+
+	rooms := emitter.Rooms(v4.nsp(), v4.socketID()).Rooms
+	rtn := make([]Room, len(rooms))
+	for i, room := range rooms {
+		rtn[i] = strings.Replace(room, socketIDPrefix, v4.prefix(), 1)
+	}
+	return rtn
+}
+
+func (v4 *SocketV4) Broadcast() emit { v4.setIsSender(true); return v4.inSocketV4 }
+
+// UseEvent - registers a middleware that runs, in the order it was registered, for every
+// event that is received on the socket before the event callback. The middleware must
+// call next, a non-nil error is emitted back to the client as an "error" event. It's
+// apart from Use, which registers the middleware of the namespace.
+func (v4 *SocketV4) UseEvent(middleware func(event Event, args []interface{}, next func(error))) {
+	v4.prev.prev.prev.useIncoming(middleware)
+}
+
+// Disconnect - disconnects the client from the namespace, and leaves all of its rooms. When
+// close is true the underlying connection is closed, which disconnects the client from all
+// namespaces. The OnDisconnect callback gets ServerNamespaceDisconnect or ServerShuttingDown.
+func (v4 *SocketV4) Disconnect(close bool) error {
+	return v4.prev.prev.prev.disconnect(close)
+}
+
+// Volatile - the event data may be lost if the client is not ready to receive it. A
+// volatile event is not acknowledged, as a dropped packet would leave the callback waiting
+func (v4 *SocketV4) Volatile() emit {
+	rtn := *v4
+	rtn.inSocketV4 = v4.clone()
+	rtn.setVolatile(true)
+	return &rtn
+}
+
+// Compress - sets the compress flag for the event data
+func (v4 *SocketV4) Compress(compress bool) emit {
+	rtn := *v4
+	rtn.inSocketV4 = v4.clone()
+	rtn.setCompress(compress)
+	return &rtn
+}
+
+// Timeout - the acknowledgement callback is called with an error as the first
+// argument if the client has not acknowledged the event within the duration,
+// otherwise it's called with a nil error followed by the client response.
+func (v4 *SocketV4) Timeout(dur time.Duration) emit {
+	rtn := *v4
+	rtn.inSocketV4 = v4.clone()
+	rtn.setTimeout(dur)
+	return &rtn
+}
+
+// RemoteSocketV4 is the socket that is returned from FetchSockets. It's made from what is
+// kept by the transport, so the socket can be connected to this server, or to another
+// server that shares the transport adaptor.
+type RemoteSocketV4 struct {
+	inSocketV4
+
+	han   handshakeV4
+	rooms []Room
+	data  map[string]interface{}
+}
+
+func (r *RemoteSocketV4) ID() SocketID           { return SocketID(r.prefix()) + r.socketID() }
+func (r *RemoteSocketV4) Handshake() handshakeV4 { r.han.init(); return r.han }
+
+// Data - a copy of the data of the socket when it was fetched, changes are not sent back to the socket
+func (r *RemoteSocketV4) Data() *SocketData { return newSocketData(r.data) }
+
+// Rooms - the rooms that the socket was in when it was fetched
+func (r *RemoteSocketV4) Rooms() []Room {
+	rtn := make([]Room, len(r.rooms))
+	for i, room := range r.rooms {
+		rtn[i] = strings.Replace(room, socketIDPrefix, r.prefix(), 1)
+	}
+	return rtn
+}
+
+func (r *RemoteSocketV4) Emit(event Event, data ...Data) error {
+	v1 := r.prev.prev.prev
+	v1.addID(r.socketID())
+	return v1.emit(event, data...)
+}
+
+func (r *RemoteSocketV4) Join(rooms ...Room) error {
+	for _, room := range rooms {
+		room = strings.Replace(room, r.prefix(), socketIDPrefix, 1)
+		if err := r.tr().Join(r.nsp(), r.socketID(), room); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RemoteSocketV4) Leave(rooms ...Room) error {
+	for _, room := range rooms {
+		room = strings.Replace(room, r.prefix(), socketIDPrefix, 1)
+		if err := r.tr().Leave(r.nsp(), r.socketID(), room); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Disconnect - disconnects the socket from the namespace, see SocketV4.Disconnect. A socket
+// on another server is disconnected by that server, when the transport adaptor can ask it to.
+func (r *RemoteSocketV4) Disconnect(close bool) error {
+	if disconnecter, ok := r.tr().(siot.RemoteDisconnecter); ok {
+		if remote, err := disconnecter.DisconnectRemote(r.nsp(), r.socketID(), close); remote || err != nil {
+			return err
+		}
+	}
+	return r.prev.prev.prev.disconnect(close)
+}
+
+// SocketData is the arbitrary data of a socket, like the authenticated user, it's safe to use
+// from multiple goroutines. The values should be able to be serialized to JSON, so that the
+// data can be shared by a transport adaptor across servers.
+type SocketData struct {
+	ʟ sync.RWMutex
+	m map[string]interface{}
+
+	save func(map[string]interface{}) // keeps a copy of the data with the transport adaptor
+}
+
+func newSocketData(m map[string]interface{}) *SocketData {
+	data := &SocketData{m: make(map[string]interface{}, len(m))}
+	for k, v := range m {
+		data.m[k] = v
+	}
+	return data
+}
+
+// persist keeps a copy of the data with the save function now, and each time the data changes
+func (d *SocketData) persist(save func(map[string]interface{})) {
+	d.ʟ.Lock()
+	defer d.ʟ.Unlock()
+
+	d.save = save
+	d.save(d.copy())
+}
+
+// copy returns a copy of the data, the lock must be held
+func (d *SocketData) copy() map[string]interface{} {
+	rtn := make(map[string]interface{}, len(d.m))
+	for k, v := range d.m {
+		rtn[k] = v
+	}
+	return rtn
+}
+
+func (d *SocketData) Get(key string) (interface{}, bool) {
+	d.ʟ.RLock()
+	defer d.ʟ.RUnlock()
+
+	val, ok := d.m[key]
+	return val, ok
+}
+
+func (d *SocketData) Set(key string, value interface{}) {
+	d.ʟ.Lock()
+	defer d.ʟ.Unlock()
+
+	if d.m == nil {
+		d.m = make(map[string]interface{})
+	}
+	d.m[key] = value
+	if d.save != nil {
+		d.save(d.copy())
+	}
+}
+
+func (d *SocketData) Delete(key string) {
+	d.ʟ.Lock()
+	defer d.ʟ.Unlock()
+
+	delete(d.m, key)
+	if d.save != nil {
+		d.save(d.copy())
+	}
+}
+
+// Keys - the sorted keys of the data
+func (d *SocketData) Keys() []string {
+	d.ʟ.RLock()
+	defer d.ʟ.RUnlock()
+
+	rtn := make([]string, 0, len(d.m))
+	for k := range d.m {
+		rtn = append(rtn, k)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+func (d *SocketData) MarshalJSON() ([]byte, error) {
+	d.ʟ.RLock()
+	defer d.ʟ.RUnlock()
+
+	return json.Marshal(d.m)
+}
+
+func (d *SocketData) UnmarshalJSON(b []byte) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	d.ʟ.Lock()
+	defer d.ʟ.Unlock()
+
+	d.m = m
+	if d.save != nil {
+		d.save(d.copy())
+	}
+	return nil
+}
@@ -2,10 +2,15 @@ package socketio_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -13,8 +18,11 @@ import (
 	"time"
 
 	"github.com/njones/socketio"
+	tmap "github.com/njones/socketio/adaptor/transport/memory"
 	"github.com/njones/socketio/callback"
+	"github.com/njones/socketio/client"
 	"github.com/njones/socketio/engineio"
+	siop "github.com/njones/socketio/protocol"
 	"github.com/njones/socketio/serialize"
 	"github.com/stretchr/testify/assert"
 )
@@ -73,6 +81,448 @@ func TestSocketIOPathV4(t *testing.T) {
 	}
 }
 
+func TestConnectionStateRecoveryV4(t *testing.T) {
+	var (
+		v4        = socketio.NewServerV4(append(testingOptionsV4, socketio.WithConnectionStateRecovery(5*time.Second))...)
+		connected = make(chan *socketio.SocketV4, 1)
+	)
+
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		if !socket.Recovered() {
+			socket.Join("news")
+			socket.Data().Set("user", "gopher")
+		}
+		connected <- socket
+		return nil
+	})
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	url := func(sid string) string {
+		return fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling&sid=%s", server.URL, sid)
+	}
+	post := func(sid, body string) {
+		rsp, err := server.Client().Post(url(sid), "text/plain", strings.NewReader(body))
+		if assert.NoError(t, err) {
+			rsp.Body.Close()
+		}
+	}
+	handshake := func() string {
+		rsp, err := server.Client().Get(fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling", server.URL))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer rsp.Body.Close()
+
+		var open struct{ SID string }
+		body, _ := io.ReadAll(rsp.Body)
+		assert.NoError(t, json.Unmarshal(bytes.TrimPrefix(body, []byte("0")), &open))
+		return open.SID
+	}
+	// grab polls until the packets that were received match the pattern, and returns the submatches
+	grab := func(sid string, pattern string) []string {
+		var have string
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			rsp, err := server.Client().Get(url(sid))
+			if !assert.NoError(t, err) {
+				return nil
+			}
+			body, _ := io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+
+			for _, packet := range strings.Split(string(body), "\x1e") {
+				if packet == "2" {
+					post(sid, "3")
+					continue
+				}
+				have += packet + "\x1e"
+			}
+			if match := regexp.MustCompile(pattern).FindStringSubmatch(have); match != nil {
+				return match
+			}
+		}
+		t.Fatalf("the packets %q do not match %q", have, pattern)
+		return nil
+	}
+
+	sid := handshake()
+	post(sid, "40")
+	first := <-connected
+	assert.False(t, first.Recovered())
+
+	connect := grab(sid, `40\{"pid":"([^"]+)","sid":"([^"]+)"\}`)
+	pid := connect[1]
+
+	assert.NoError(t, v4.In("news").Emit("headline", serialize.String("one")))
+	offset := grab(sid, `42\["headline","one","([^"]+)"\]`)[1]
+
+	// the client goes away without a disconnect packet, and misses the next headline
+	assert.NoError(t, v4.In("news").Emit("headline", serialize.String("two")))
+
+	sid = handshake()
+	post(sid, fmt.Sprintf(`40{"pid":%q,"offset":%q}`, pid, offset))
+	second := <-connected
+	assert.True(t, second.Recovered())
+	assert.Equal(t, first.ID(), second.ID())
+
+	user, _ := second.Data().Get("user")
+	assert.Equal(t, "gopher", user)
+
+	grab(sid, fmt.Sprintf(`40\{"pid":%q,"sid":%q\}\x1e42\["headline","two","[^"]+"\]`, pid, connect[2]))
+
+	sockets, err := v4.In("news").FetchSockets()
+	assert.NoError(t, err)
+	if assert.Len(t, sockets, 1) {
+		assert.Equal(t, first.ID(), sockets[0].ID())
+	}
+
+	// an offset that is not in the replay buffer gets a new session
+	sid = handshake()
+	post(sid, fmt.Sprintf(`40{"pid":%q,"offset":"unknown"}`, pid))
+	third := <-connected
+	assert.False(t, third.Recovered())
+	assert.NotEqual(t, first.ID(), third.ID())
+}
+
+func TestDisconnectReasonV4(t *testing.T) {
+	type disconnect struct {
+		reason socketio.DisconnectReason
+		rooms  []string
+	}
+
+	var (
+		v4            = socketio.NewServerV4(testingOptionsV4...)
+		connected     = make(chan *socketio.SocketV4, 1)
+		disconnecting = make(chan disconnect, 1)
+		disconnected  = make(chan disconnect, 1)
+	)
+
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		socket.Join("room")
+		socket.OnDisconnecting(func(reason socketio.DisconnectReason) {
+			rooms := socket.Rooms()
+			sort.Strings(rooms)
+			disconnecting <- disconnect{reason, rooms}
+		})
+		socket.OnDisconnectReason(func(reason socketio.DisconnectReason) {
+			disconnected <- disconnect{reason, socket.Rooms()}
+		})
+		connected <- socket
+		return nil
+	})
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	url := func(sid string) string {
+		return fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling&sid=%s", server.URL, sid)
+	}
+	get := func(sid string) {
+		rsp, err := server.Client().Get(url(sid))
+		if assert.NoError(t, err) {
+			io.Copy(io.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+	}
+	post := func(sid, body string) {
+		rsp, err := server.Client().Post(url(sid), "text/plain", strings.NewReader(body))
+		if assert.NoError(t, err) {
+			rsp.Body.Close()
+		}
+	}
+	handshake := func() string {
+		rsp, err := server.Client().Get(fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling", server.URL))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer rsp.Body.Close()
+
+		var open struct{ SID string }
+		body, _ := io.ReadAll(rsp.Body)
+		assert.NoError(t, json.Unmarshal(bytes.TrimPrefix(body, []byte("0")), &open))
+		return open.SID
+	}
+	wait := func(ch chan disconnect) disconnect {
+		select {
+		case d := <-ch:
+			return d
+		case <-time.After(5 * time.Second):
+			t.Fatal("the socket was not disconnected")
+		}
+		return disconnect{}
+	}
+
+	// the client closes the EngineIO session
+	sid := handshake()
+	post(sid, "40")
+	socket := <-connected
+	get(sid)
+
+	done := make(chan struct{})
+	go func() { defer close(done); get(sid) }()
+	time.Sleep(50 * time.Millisecond)
+	post(sid, "1")
+	<-done
+
+	assert.Equal(t, disconnect{socketio.TransportClose, []string{string(socket.ID()), "room"}}, wait(disconnecting))
+	assert.Equal(t, disconnect{socketio.TransportClose, []string{}}, wait(disconnected))
+
+	// the client stops responding to the pings
+	sid = handshake()
+	post(sid, "40")
+	<-connected
+	get(sid)
+
+	assert.Equal(t, socketio.PingTimeout, wait(disconnecting).reason)
+	assert.Equal(t, socketio.PingTimeout, wait(disconnected).reason)
+}
+
+func TestMiddlewareWithoutNextV4(t *testing.T) {
+	var (
+		v4           = socketio.NewServerV4(testingOptionsV4...)
+		used         = make(chan struct{}, 1)
+		disconnected = make(chan socketio.DisconnectReason, 1)
+	)
+
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		socket.UseEvent(func(event socketio.Event, args []interface{}, next func(error)) { used <- struct{}{} })
+		socket.OnDisconnectReason(func(reason socketio.DisconnectReason) { disconnected <- reason })
+		return nil
+	})
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	url := func(sid string) string {
+		return fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling&sid=%s", server.URL, sid)
+	}
+	get := func(sid string) {
+		rsp, err := server.Client().Get(url(sid))
+		if assert.NoError(t, err) {
+			io.Copy(io.Discard, rsp.Body)
+			rsp.Body.Close()
+		}
+	}
+	post := func(sid, body string) {
+		rsp, err := server.Client().Post(url(sid), "text/plain", strings.NewReader(body))
+		if assert.NoError(t, err) {
+			rsp.Body.Close()
+		}
+	}
+
+	rsp, err := server.Client().Get(fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling", server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var open struct{ SID string }
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	assert.NoError(t, json.Unmarshal(bytes.TrimPrefix(body, []byte("0")), &open))
+
+	post(open.SID, "40")
+	get(open.SID)
+	post(open.SID, `42["hello"]`)
+	<-used
+
+	// the middleware never calls next, which doesn't hold up the close of the session
+	post(open.SID, "1")
+	select {
+	case reason := <-disconnected:
+		assert.Equal(t, socketio.TransportClose, reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the socket was not disconnected")
+	}
+}
+
+func TestShutdownV4(t *testing.T) {
+	var (
+		v4           = socketio.NewServerV4(testingOptionsV4...)
+		connected    = make(chan *socketio.SocketV4, 1)
+		disconnected = make(chan socketio.DisconnectReason, 1)
+	)
+
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		socket.OnDisconnectReason(func(reason socketio.DisconnectReason) { disconnected <- reason })
+		connected <- socket
+		return nil
+	})
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	handshake := func() *http.Response {
+		rsp, err := server.Client().Get(fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling", server.URL))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return rsp
+	}
+	url := func(sid string) string {
+		return fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling&sid=%s", server.URL, sid)
+	}
+	get := func(sid string) string {
+		rsp, err := server.Client().Get(url(sid))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer rsp.Body.Close()
+		body, _ := io.ReadAll(rsp.Body)
+		return string(body)
+	}
+
+	rsp := handshake()
+	var open struct{ SID string }
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	assert.NoError(t, json.Unmarshal(bytes.TrimPrefix(body, []byte("0")), &open))
+
+	post, err := server.Client().Post(url(open.SID), "text/plain", strings.NewReader("40"))
+	if assert.NoError(t, err) {
+		post.Body.Close()
+	}
+	socket := <-connected
+	get(open.SID)
+
+	// the pending packets are flushed before the session is closed
+	assert.NoError(t, socket.Emit("bye", serialize.String("for now")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- v4.Shutdown(ctx) }()
+
+	assert.Equal(t, socketio.ServerShuttingDown, <-disconnected)
+
+	rsp = handshake()
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, rsp.StatusCode)
+
+	var have []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		have = append(have, strings.Split(get(open.SID), "\x1e")...)
+		if have[len(have)-1] == "1" {
+			break
+		}
+	}
+	assert.Equal(t, []string{`42["bye","for now"]`, `41`, `1`}, have)
+	assert.NoError(t, <-shutdown)
+}
+
+func TestSocketDataV4(t *testing.T) {
+	var (
+		data = new(socketio.SocketData)
+		wait = new(sync.WaitGroup)
+	)
+
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			data.Set(fmt.Sprintf("key%d", i), i)
+			data.Get("key0")
+		}(i)
+	}
+	wait.Wait()
+
+	assert.Len(t, data.Keys(), 10)
+	data.Delete("key0")
+
+	have, ok := data.Get("key0")
+	assert.False(t, ok)
+	assert.Nil(t, have)
+
+	b, err := json.Marshal(data)
+	assert.NoError(t, err)
+
+	var decoded socketio.SocketData
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, data.Keys(), decoded.Keys())
+
+	have, _ = decoded.Get("key9")
+	assert.Equal(t, float64(9), have)
+}
+
+func TestRejectedSocketsV4(t *testing.T) {
+	var (
+		tr = tmap.NewInMemoryTransport(siop.NewPacketV5)
+		v4 = socketio.NewServerV4(append(testingOptionsV4, socketio.WithAdaptor(tr))...)
+	)
+
+	v4.Of("/admin").Use(func(socket *socketio.SocketV4, next func(error)) {
+		next(&socketio.ConnectError{Message: "not authorized"})
+	})
+	v4.Of("/admin").OnConnect(func(socket *socketio.SocketV4) error { return nil })
+	v4.OfMatch(regexp.MustCompile(`^/tenant-\d+$`)).OnConnect(func(socket *socketio.SocketV4) error { return nil })
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := client.Dial(ctx, server.URL, client.WithUpgrade(false))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+
+	_, err = c.Connect(ctx, "/admin")
+	assert.Error(t, err)
+	_, err = c.Connect(ctx, "/unknown")
+	assert.Error(t, err)
+
+	// the sockets that were not let in are not in the namespaces, so they don't get broadcasts
+	assert.Empty(t, tr.Sockets("/admin").IDs())
+	assert.Empty(t, tr.Sockets("/unknown").IDs())
+
+	tenant, err := c.Connect(ctx, "/tenant-1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []socketio.SocketID{socketio.SocketID(tenant.ID())}, tr.Sockets("/tenant-1").IDs())
+	}
+}
+
+func TestListenersV4(t *testing.T) {
+	v4 := socketio.NewServerV4(testingOptionsV4...)
+
+	// the closures from the same func literal are told apart by the registration
+	var handlers []callback.FuncString
+	var offs []func()
+	for i := 0; i < 2; i++ {
+		handlers = append(handlers, callback.FuncString(func(string) {}))
+		offs = append(offs, v4.OnWithOff("x", handlers[i]))
+	}
+	v4.On("x", handlers[0])
+	assert.Len(t, v4.Listeners("x"), 3)
+
+	offs[1]()
+	offs[1]()
+	assert.Len(t, v4.Listeners("x"), 2)
+
+	// the same callback registered twice is removed once by the registration, or by Off
+	ptr := &handlers[0]
+	off := v4.OnWithOff("y", ptr)
+	v4.On("y", ptr)
+	off()
+	if have := v4.Listeners("y"); assert.Len(t, have, 1) {
+		assert.Same(t, ptr, have[0])
+	}
+	v4.Off("y")
+	assert.Len(t, v4.Listeners("y"), 0)
+
+	once := v4.Once("z", ptr)
+	once()
+	assert.Len(t, v4.Listeners("z"), 0)
+
+	offAny := v4.OnAny(func(socketio.Event, ...interface{}) {})
+	v4.OnAny(func(socketio.Event, ...interface{}) {})
+	offAny()
+	assert.Len(t, v4.ListenersAny(), 1)
+	v4.OffAny()
+	assert.Len(t, v4.ListenersAny(), 0)
+}
+
 func TestServerV4(t *testing.T) {
 	var opts = []func(*testing.T){}
 	var EIOv = 4
@@ -100,13 +550,28 @@ func TestServerV4(t *testing.T) {
 		"sending to a specific room in a specific namespace, including sender":    SendingToASpecificRoomInNamespaceMyNamespaceIncludingSenderV4,
 		"sending to individual socketid (private message)":                        SendingToIndividualSocketIDPrivateMessageV4,
 		"sending with acknowledgement":                                            SendingWithAcknowledgementV4,
+		"emit with acknowledgement":                                               EmitWithAcknowledgementV4,
+		"emit with acknowledgement and context done":                              EmitWithAcknowledgementContextDoneV4,
+		"sending with acknowledgement and timeout":                                SendingWithAcknowledgementAndTimeoutV4,
+		"sending with acknowledgement that times out":                             SendingWithAcknowledgementThatTimesOutV4,
+		"broadcast with acknowledgements":                                         BroadcastWithAcknowledgementsV4,
+		"broadcast with acknowledgements that times out":                          BroadcastWithAcknowledgementsThatTimesOutV4,
 		"sending to all connected clients":                                        SendingToAllConnectedClientsV4,
 
 		// extra
-		"on event":                                   OnEventV4,
-		"reject the client":                          RejectTheClientV4,
-		"sending a binary event from the client":     SendingBinaryEventFromClientV4,
-		"sending a binary ack event from the client": SendingBinaryAckFromClientV4,
+		"on event":                                      OnEventV4,
+		"reject the client":                             RejectTheClientV4,
+		"namespace middleware":                          NamespaceMiddlewareV4,
+		"socket middleware":                             SocketMiddlewareV4,
+		"event listeners":                               EventListenersV4,
+		"server disconnect":                             ServerDisconnectV4,
+		"server disconnect and close":                   ServerDisconnectAndCloseV4,
+		"fetch and manage sockets":                      FetchSocketsV4,
+		"dynamic namespaces":                            DynamicNamespacesV4,
+		"sending a binary event from the client":        SendingBinaryEventFromClientV4,
+		"sending a binary ack event from the client":    SendingBinaryAckFromClientV4,
+		"sending a nested binary event from the client": SendingNestedBinaryEventFromClientV4,
+		"typed event callback with an ack reply":        TypedEventCallbackV4,
 	}
 
 	for name, testParams := range integration {
@@ -694,34 +1159,42 @@ func SendingWithAcknowledgementV4(t *testing.T) []testDataOptFunc {
 	}
 }
 
-func SendingToAllConnectedClientsV4(t *testing.T) []testDataOptFunc {
+func SendingWithAcknowledgementAndTimeoutV4(t *testing.T) []testDataOptFunc {
 	var (
 		v4   = socketio.NewServerV4(testingOptionsV4...)
 		wait = new(sync.WaitGroup)
 
 		want = map[string][][]string{
-			"grab1": {
-				{`42["*","an event sent to all connected clients"]`},
-				{`42["*","an event sent to all connected clients"]`},
-				{`42["*","an event sent to all connected clients"]`},
-				{`42["*","an event sent to all connected clients"]`},
-				{`42["*","an event sent to all connected clients"]`},
-			},
+			"grab1": {{`421["question","do you think so?"]`}},
+			"send2": {{`431["answer",42]`}},
 		}
 		count = len(want["grab1"])
-		cnt   = int64(0)
 	)
 
 	checkCount(t, count)
 
+	var question = serialize.String("do you think so?")
+
 	wait.Add(count)
 	v4.OnConnect(func(socket *socketio.SocketV4) error {
-		defer wait.Done()
+		wait.Done()
 
-		if atomic.LoadInt64(&cnt) == int64(count-1) {
-			v4.Emit("*", serialize.String("an event sent to all connected clients"))
-		}
-		atomic.AddInt64(&cnt, 1)
+		err := socket.Timeout(5*time.Second).Emit("question", question, callback.Wrap{
+			Parameters: []serialize.Serializable{serialize.ErrParam, serialize.StrParam, serialize.IntParam},
+			Func: func() interface{} {
+				return func(err error, value1 string, value2 int) error {
+					wait.Done()
+
+					assert.NoError(t, err)
+					assert.Equal(t, "answer", value1)
+					assert.Equal(t, 42, value2)
+
+					return nil
+				}
+			},
+		})
+
+		assert.NoError(t, err)
 		return nil
 	})
 
@@ -733,65 +1206,36 @@ func SendingToAllConnectedClientsV4(t *testing.T) []testDataOptFunc {
 	}
 }
 
-func OnEventV4(t *testing.T) []testDataOptFunc {
+func SendingWithAcknowledgementThatTimesOutV4(t *testing.T) []testDataOptFunc {
 	var (
 		v4   = socketio.NewServerV4(testingOptionsV4...)
 		wait = new(sync.WaitGroup)
 
 		want = map[string][][]string{
-			"send1": {
-				{`42["chat message","an event sent to all connected clients #0"]`},
-				{`42["chat message","an event sent to all connected clients #1"]`},
-				{`42["chat message","an event sent to all connected clients #2"]`},
-				{`42["chat message","an event sent to all connected clients #3"]`},
-				{`42["chat message","an event sent to all connected clients #4"]`},
-			},
-			"send2": {
-				{`41`}, nil, nil, nil, nil,
-			},
-			"grab2": {
-				{`42["say goodbye","disconnecting..."]`},
-				nil,
-				{`42["say goodbye","disconnecting..."]`},
-				nil,
-				{`42["say goodbye","disconnecting..."]`},
-			},
+			"grab1": {{`421["question","do you think so?"]`}},
 		}
-		count = len(want["send1"])
-		n     = int64(0)
+		count = len(want["grab1"])
 	)
 
 	checkCount(t, count)
 
-	wait.Add(count)
-	v4.OnConnect(func(socket *socketio.SocketV4) error {
-		defer wait.Done()
-
-		socket.Join("room")
-		socket.On("chat message", callback.Wrap{
-			Parameters: []serialize.Serializable{serialize.StrParam},
-			Func: func() interface{} {
-
-				return func(msg string) error {
-					defer wait.Done()
-
-					if atomic.LoadInt64(&n)%2 != 0 {
-						socket.Leave("room")
-					}
+	var question = serialize.String("do you think so?")
 
-					assert.Equal(t, fmt.Sprintf("an event sent to all connected clients #%d", n), msg)
-					atomic.AddInt64(&n, 1)
-					return nil
-				}
-			},
-		})
+	wait.Add(count * 2) // the connection and the timeout
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		wait.Done()
 
-		v4.OnDisconnect(func(reason string) {
+		err := socket.Timeout(10*time.Millisecond).Emit("question", question, callback.FuncAny(func(v ...interface{}) error {
 			defer wait.Done()
 
-			v4.In("room").Emit("say goodbye", serialize.String("disconnecting..."))
-		})
+			if assert.Len(t, v, 1) {
+				err, _ := v[0].(error)
+				assert.ErrorIs(t, err, socketio.ErrAckTimeout)
+			}
+			return nil
+		}))
 
+		assert.NoError(t, err)
 		return nil
 	})
 
@@ -803,34 +1247,63 @@ func OnEventV4(t *testing.T) []testDataOptFunc {
 	}
 }
 
-func RejectTheClientV4(t *testing.T) []testDataOptFunc {
+func BroadcastWithAcknowledgementsV4(t *testing.T) []testDataOptFunc {
 	var (
 		v4   = socketio.NewServerV4(testingOptionsV4...)
 		wait = new(sync.WaitGroup)
 
 		want = map[string][][]string{
-			"connect_query": {{`access=true`}, {`access=false`}},
-			"grab1":         {{`42["hello",1]`}, {`44{"message":"not authorized"}`}},
+			"grab1": {
+				{`421["question","what is your player number?"]`},
+				{`422["question","what is your player number?"]`},
+				{`423["question","what is your player number?"]`},
+			},
+			"send2": {
+				{`431["answer",0]`},
+				{`432["answer",1]`},
+				{`433["answer",2]`},
+			},
 		}
-		count = len(want["connect_query"])
+		count = len(want["grab1"])
 		cnt   = int64(0)
+		ids   = make([]socketio.SocketID, count)
 	)
 
 	checkCount(t, count)
 
+	var question = serialize.String("what is your player number?")
+
 	wait.Add(count)
 	v4.OnConnect(func(socket *socketio.SocketV4) error {
 		defer wait.Done()
 
-		atomic.AddInt64(&cnt, 1)
-
-		tf := socket.Request().URL.Query().Get("access")
-		if tf == "true" {
-			socket.Emit("hello", serialize.Integer(1))
-			return nil
+		n := atomic.LoadInt64(&cnt)
+		ids[n] = socket.ID()
+		socket.Join(fmt.Sprintf("player%d", n))
+
+		if n == int64(count-1) {
+			err := v4.Timeout(5*time.Second).In("player0", "player1", "player2").Emit("question", question, callback.FuncAny(func(v ...interface{}) error {
+				if assert.Len(t, v, 2) {
+					assert.Nil(t, v[0])
+
+					have := v[1].(socketio.BroadcastAck)
+					assert.Empty(t, have.TimedOut)
+					assert.Equal(t, map[socketio.SocketID][]interface{}{
+						ids[0]: {"answer", float64(0)},
+						ids[1]: {"answer", float64(1)},
+						ids[2]: {"answer", float64(2)},
+					}, have.Responses)
+
+					for range have.Responses {
+						wait.Done()
+					}
+				}
+				return nil
+			}))
+			assert.NoError(t, err)
 		}
-
-		return fmt.Errorf("not authorized")
+		atomic.AddInt64(&cnt, 1)
+		return nil
 	})
 
 	return []testDataOptFunc{
@@ -841,19 +1314,735 @@ func RejectTheClientV4(t *testing.T) []testDataOptFunc {
 	}
 }
 
-func SendingBinaryEventFromClientV4(t *testing.T) []testDataOptFunc {
+func BroadcastWithAcknowledgementsThatTimesOutV4(t *testing.T) []testDataOptFunc {
 	var (
 		v4   = socketio.NewServerV4(testingOptionsV4...)
 		wait = new(sync.WaitGroup)
 
 		want = map[string][][]string{
-			"send1": {
-				{`451-["hello",{"_placeholder":true,"num":0}]`, `bAQIDBA==`},
+			"grab1": {
+				{`421["question","what is your player number?"]`},
+				{`422["question","what is your player number?"]`},
+				{`423["question","what is your player number?"]`},
+			},
+			"send2": {
+				nil,
+				{`432["answer",1]`},
+				nil,
 			},
 		}
-		count  = len(want["send1"])
-		cnt    = int64(0)
-		expect = []byte{0x01, 0x02, 0x03, 0x04}
+		count = len(want["grab1"])
+		cnt   = int64(0)
+		ids   = make([]socketio.SocketID, count)
+	)
+
+	checkCount(t, count)
+
+	var question = serialize.String("what is your player number?")
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		n := atomic.LoadInt64(&cnt)
+		ids[n] = socket.ID()
+		socket.Join(fmt.Sprintf("player%d", n))
+
+		if n == int64(count-1) {
+			err := v4.Timeout(time.Second).In("player0", "player1", "player2").Emit("question", question, callback.FuncAny(func(v ...interface{}) error {
+				if assert.Len(t, v, 2) {
+					err, _ := v[0].(error)
+					assert.ErrorIs(t, err, socketio.ErrBroadcastAckTimeout)
+
+					have := v[1].(socketio.BroadcastAck)
+					assert.ElementsMatch(t, []socketio.SocketID{ids[0], ids[2]}, have.TimedOut)
+					assert.Equal(t, map[socketio.SocketID][]interface{}{
+						ids[1]: {"answer", float64(1)},
+					}, have.Responses)
+
+					for range have.Responses {
+						wait.Done()
+					}
+				}
+				return nil
+			}))
+			assert.NoError(t, err)
+		}
+		atomic.AddInt64(&cnt, 1)
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func EmitWithAcknowledgementV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"grab1": {{`421["question","do you think so?"]`}},
+			"send2": {{`431["answer",42]`}},
+		}
+		count = len(want["grab1"])
+	)
+
+	checkCount(t, count)
+
+	var question = serialize.String("do you think so?")
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		wait.Done()
+
+		go func() {
+			defer wait.Done()
+
+			have, err := socket.EmitWithAck(context.Background(), "question", question)
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"answer", float64(42)}, have)
+		}()
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func EmitWithAcknowledgementContextDoneV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"grab1": {{`421["question","do you think so?"]`}},
+		}
+		count = len(want["grab1"])
+	)
+
+	checkCount(t, count)
+
+	var question = serialize.String("do you think so?")
+
+	wait.Add(count * 2) // the connection and the context deadline
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		wait.Done()
+
+		go func() {
+			defer wait.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			have, err := socket.EmitWithAck(ctx, "question", question)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Nil(t, have)
+		}()
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func SendingToAllConnectedClientsV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"grab1": {
+				{`42["*","an event sent to all connected clients"]`},
+				{`42["*","an event sent to all connected clients"]`},
+				{`42["*","an event sent to all connected clients"]`},
+				{`42["*","an event sent to all connected clients"]`},
+				{`42["*","an event sent to all connected clients"]`},
+			},
+		}
+		count = len(want["grab1"])
+		cnt   = int64(0)
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		if atomic.LoadInt64(&cnt) == int64(count-1) {
+			v4.Emit("*", serialize.String("an event sent to all connected clients"))
+		}
+		atomic.AddInt64(&cnt, 1)
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func OnEventV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`42["chat message","an event sent to all connected clients #0"]`},
+				{`42["chat message","an event sent to all connected clients #1"]`},
+				{`42["chat message","an event sent to all connected clients #2"]`},
+				{`42["chat message","an event sent to all connected clients #3"]`},
+				{`42["chat message","an event sent to all connected clients #4"]`},
+			},
+			"send2": {
+				{`41`}, nil, nil, nil, nil,
+			},
+			"grab2": {
+				{`42["say goodbye","disconnecting..."]`},
+				nil,
+				{`42["say goodbye","disconnecting..."]`},
+				nil,
+				{`42["say goodbye","disconnecting..."]`},
+			},
+		}
+		count = len(want["send1"])
+		n     = int64(0)
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		socket.Join("room")
+		socket.On("chat message", callback.Wrap{
+			Parameters: []serialize.Serializable{serialize.StrParam},
+			Func: func() interface{} {
+
+				return func(msg string) error {
+					defer wait.Done()
+
+					if atomic.LoadInt64(&n)%2 != 0 {
+						socket.Leave("room")
+					}
+
+					assert.Equal(t, fmt.Sprintf("an event sent to all connected clients #%d", n), msg)
+					atomic.AddInt64(&n, 1)
+					return nil
+				}
+			},
+		})
+
+		v4.OnDisconnectReason(func(reason socketio.DisconnectReason) {
+			if reason != socketio.ClientNamespaceDisconnect {
+				return // the session of the other clients times out later
+			}
+			defer wait.Done()
+
+			v4.In("room").Emit("say goodbye", serialize.String("disconnecting..."))
+		})
+
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func RejectTheClientV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"connect_query": {{`access=true`}, {`access=false`}},
+			"grab1":         {{`42["hello",1]`}, {`44{"message":"not authorized"}`}},
+		}
+		count = len(want["connect_query"])
+		cnt   = int64(0)
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		atomic.AddInt64(&cnt, 1)
+
+		tf := socket.Request().URL.Query().Get("access")
+		if tf == "true" {
+			socket.Emit("hello", serialize.Integer(1))
+			return nil
+		}
+
+		return fmt.Errorf("not authorized")
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func NamespaceMiddlewareV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"connect": {
+				{`40/admin,{"token":"abc"}`},
+				{`40/admin,{"token":"xyz"}`},
+			},
+			"grab1": {
+				{`42/admin,["hello","first","second"]`},
+				{`44/admin,{"data":{"content":"Please retry later"},"message":"not authorized"}`},
+			},
+		}
+		count = len(want["connect"])
+	)
+
+	checkCount(t, count)
+
+	type ctxKey string
+
+	wait.Add(count)
+	v4.Of("/admin").Use(func(socket *socketio.SocketV4, next func(error)) {
+		go next(nil) // next can be called from another goroutine
+	})
+	v4.Of("/admin").Use(func(socket *socketio.SocketV4, next func(error)) {
+		if socket.Handshake().Auth()["token"] != "abc" {
+			defer wait.Done()
+			next(&socketio.ConnectError{
+				Message: "not authorized",
+				Data:    map[string]interface{}{"content": "Please retry later"},
+			})
+			return
+		}
+		next(nil)
+	})
+	v4.Of("/admin").OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		socket.Emit("hello", serialize.String("first"), serialize.String("second"))
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func SocketMiddlewareV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`42["forbidden","secret"]`, `42["hello","world"]`},
+			},
+			"grab1": {
+				{`42["error",{"message":"not allowed"}]`},
+			},
+		}
+		count = len(want["send1"])
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		var seen []socketio.Event
+		socket.UseEvent(func(event socketio.Event, args []interface{}, next func(error)) {
+			seen = append(seen, event)
+			next(nil)
+		})
+		socket.UseEvent(func(event socketio.Event, args []interface{}, next func(error)) {
+			if event == "forbidden" {
+				assert.Equal(t, []interface{}{"secret"}, args)
+				next(fmt.Errorf("not allowed"))
+				return
+			}
+			next(nil)
+		})
+
+		socket.On("forbidden", callback.FuncAny(func(v ...interface{}) error {
+			assert.Fail(t, "the middleware should have stopped the event")
+			return nil
+		}))
+		socket.On("hello", callback.FuncAny(func(v ...interface{}) error {
+			defer wait.Done()
+
+			assert.Equal(t, []socketio.Event{"forbidden", "hello"}, seen)
+			assert.Equal(t, []interface{}{"world"}, v)
+			return nil
+		}))
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func EventListenersV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`42["tick","a"]`, `42["tick","b"]`},
+			},
+			"send2": {
+				{`42["gone","x"]`, `42["hello","world"]`},
+			},
+			"grab2": {
+				{`42["reply","ok"]`},
+			},
+		}
+		count = len(want["send1"])
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		var incoming, outgoing, order []string
+		var ticks int
+		socket.OnAny(func(event socketio.Event, args ...interface{}) {
+			incoming = append(incoming, event)
+			if event == "tick" && args[0] == "b" {
+				wait.Done()
+			}
+		})
+		socket.OnAnyOutgoing(func(event socketio.Event, args ...interface{}) {
+			outgoing = append(outgoing, event)
+			assert.Equal(t, []interface{}{"ok"}, args)
+		})
+
+		socket.Once("tick", callback.FuncAny(func(v ...interface{}) error {
+			ticks++
+			assert.Equal(t, []interface{}{"a"}, v)
+			return nil
+		}))
+
+		gone := callback.FuncAny(func(v ...interface{}) error {
+			assert.Fail(t, "the callback should have been removed")
+			return nil
+		})
+		offGone := socket.OnWithOff("gone", gone)
+		offGone()
+
+		socket.On("hello", callback.FuncAny(func(v ...interface{}) error {
+			order = append(order, "first")
+			return nil
+		}))
+		socket.On("hello", callback.FuncAny(func(v ...interface{}) error {
+			defer wait.Done()
+
+			order = append(order, "second")
+			assert.Equal(t, []string{"first", "second"}, order)
+			assert.Equal(t, []string{"tick", "tick", "gone", "hello"}, incoming)
+			assert.Equal(t, 1, ticks)
+			assert.Len(t, socket.Listeners("hello"), 2)
+			assert.Len(t, socket.Listeners("tick"), 0)
+			assert.Len(t, socket.Listeners("gone"), 0)
+			assert.Len(t, socket.ListenersAny(), 1)
+
+			socket.Emit("reply", serialize.String("ok"))
+			assert.Equal(t, []string{"reply"}, outgoing)
+			return nil
+		}))
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func ServerDisconnectV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`42["kick","me"]`},
+			},
+			"grab1": {
+				{`41`},
+			},
+		}
+		count = len(want["send1"])
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		var reason socketio.DisconnectReason
+		socket.Join("room1")
+		socket.OnDisconnectReason(func(r socketio.DisconnectReason) { reason = r })
+		socket.On("kick", callback.FuncAny(func(v ...interface{}) error {
+			defer wait.Done()
+
+			assert.NoError(t, socket.Disconnect(false))
+			assert.Equal(t, socketio.ServerNamespaceDisconnect, reason)
+			assert.NoError(t, v4.To("room1").Emit("after", serialize.String("disconnect")))
+			return nil
+		}))
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func ServerDisconnectAndCloseV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`42["kick","me"]`},
+			},
+			"grab1": {
+				{`41`, `1`},
+			},
+		}
+		count = len(want["send1"])
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		var reason socketio.DisconnectReason
+		socket.OnDisconnectReason(func(r socketio.DisconnectReason) { reason = r })
+		socket.On("kick", callback.FuncAny(func(v ...interface{}) error {
+			defer wait.Done()
+
+			assert.NoError(t, socket.Disconnect(true))
+			assert.Equal(t, socketio.ServerShuttingDown, reason)
+			return nil
+		}))
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func FetchSocketsV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"connect": {
+				{`40{"token":"p0"}`},
+				{`40{"token":"p1"}`},
+				{`40{"token":"p2"}`},
+			},
+			"grab1": {
+				{`42["prize","gold"]`, `41`},
+				{`42["prize","gold"]`},
+				nil,
+			},
+		}
+		count = len(want["connect"])
+		cnt   = int64(0)
+		ids   = make([]socketio.SocketID, count)
+	)
+
+	checkCount(t, count)
+
+	v4.Use(func(socket *socketio.SocketV4, next func(error)) {
+		socket.Data().Set("user", "user-"+socket.Handshake().Auth()["token"].(string))
+		next(nil)
+	})
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		n := atomic.LoadInt64(&cnt)
+		ids[n] = socket.ID()
+		socket.Data().Set("n", n)
+		socket.Join(fmt.Sprintf("player%d", n))
+		if n < 2 {
+			socket.Join("team")
+		}
+
+		if n == int64(count-1) {
+			sockets, err := v4.In("team").FetchSockets()
+			assert.NoError(t, err)
+			if assert.Len(t, sockets, 2) {
+				for _, s := range sockets {
+					i := 0
+					if s.ID() == ids[1] {
+						i = 1
+					}
+					assert.Equal(t, ids[i], s.ID())
+					assert.ElementsMatch(t, []socketio.Room{string(ids[i]), fmt.Sprintf("player%d", i), "team"}, s.Rooms())
+					assert.Equal(t, map[string]interface{}{"token": fmt.Sprintf("p%d", i)}, s.Handshake().Auth())
+
+					user, _ := s.Data().Get("user")
+					assert.Equal(t, fmt.Sprintf("user-p%d", i), user)
+					assert.Equal(t, []string{"n", "user"}, s.Data().Keys())
+				}
+			}
+
+			assert.NoError(t, v4.In("team").SocketsJoin("winners"))
+			assert.NoError(t, v4.In("winners").SocketsLeave("team"))
+
+			sockets, err = v4.In("team").FetchSockets()
+			assert.NoError(t, err)
+			assert.Len(t, sockets, 0)
+
+			sockets, err = v4.Except("winners").FetchSockets()
+			assert.NoError(t, err)
+			if assert.Len(t, sockets, 1) {
+				assert.Equal(t, ids[2], sockets[0].ID())
+			}
+
+			assert.NoError(t, v4.In("winners").Emit("prize", serialize.String("gold")))
+			assert.NoError(t, v4.In("player0").DisconnectSockets(false))
+
+			sockets, err = v4.FetchSockets()
+			assert.NoError(t, err)
+			assert.Len(t, sockets, 2)
+		}
+		atomic.AddInt64(&cnt, 1)
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func DynamicNamespacesV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"connect": {
+				{`40/tenant-1,{"plan":"free"}`},
+				{`40/tenant-2,{"plan":"paid"}`},
+				{`40/other,`},
+			},
+			"grab1": {
+				{`42/tenant-1,["welcome","free"]`, `42/tenant-1,["notice","maintenance"]`},
+				{`42/tenant-2,["welcome","paid"]`, `42/tenant-2,["notice","maintenance"]`, `42/tenant-2,["invoice","due"]`},
+				{`44/other,{"message":"Invalid namespace"}`},
+			},
+		}
+		count = len(want["connect"])
+		cnt   = int64(0)
+	)
+
+	checkCount(t, count)
+
+	tenants := v4.OfMatch(regexp.MustCompile(`^/tenant-\d+$`))
+	tenants.Use(func(socket *socketio.SocketV4, next func(error)) {
+		socket.Data().Set("plan", socket.Handshake().Auth()["plan"])
+		next(nil)
+	})
+
+	wait.Add(count - 1)
+	tenants.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		plan, _ := socket.Data().Get("plan")
+		socket.Emit("welcome", serialize.String(plan.(string)))
+
+		if atomic.AddInt64(&cnt, 1) == int64(count-1) {
+			assert.Equal(t, []socketio.Namespace{"/tenant-1", "/tenant-2"}, tenants.Children())
+			assert.NoError(t, tenants.Emit("notice", serialize.String("maintenance")))
+			assert.NoError(t, v4.Of("/tenant-2").Emit("invoice", serialize.String("due")))
+		}
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func SendingBinaryEventFromClientV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`451-["hello",{"_placeholder":true,"num":0}]`, `bAQIDBA==`},
+			},
+		}
+		count  = len(want["send1"])
+		cnt    = int64(0)
+		expect = []byte{0x01, 0x02, 0x03, 0x04}
 	)
 
 	checkCount(t, count)
@@ -937,3 +2126,309 @@ func SendingBinaryAckFromClientV4(t *testing.T) []testDataOptFunc {
 		func(d *testData) { d.syncOn = wait },
 	}
 }
+
+func SendingNestedBinaryEventFromClientV4(t *testing.T) []testDataOptFunc {
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`452-["upload",{"meta":{"name":"a.bin","parts":[{"_placeholder":true,"num":1}]},"file":{"_placeholder":true,"num":0}}]`, `bAQIDBA==`, `bBQY=`},
+			},
+		}
+		count = len(want["send1"])
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		socket.On("upload", callback.Func(func(upload map[string]interface{}) {
+			defer wait.Done()
+
+			meta := upload["meta"].(map[string]interface{})
+			assert.Equal(t, "a.bin", meta["name"])
+
+			// the placeholders are resolved by num, not by the order they are in, and
+			// they're read in the order that they are streamed
+			file, err := io.ReadAll(upload["file"].(io.Reader))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, file)
+
+			part, err := io.ReadAll(meta["parts"].([]interface{})[0].(io.Reader))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0x05, 0x06}, part)
+		}))
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func TypedEventCallbackV4(t *testing.T) []testDataOptFunc {
+	type message struct {
+		From string `json:"from"`
+		Text string `json:"text"`
+	}
+
+	var (
+		v4   = socketio.NewServerV4(testingOptionsV4...)
+		wait = new(sync.WaitGroup)
+
+		want = map[string][][]string{
+			"send1": {
+				{`421["chat",{"from":"tink","text":"hi"},"lagoon"]`},
+			},
+			"grab1": {
+				{`431[{"from":"lagoon","text":"hi tink"}]`},
+			},
+		}
+		count = len(want["send1"])
+	)
+
+	checkCount(t, count)
+
+	wait.Add(count)
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		defer wait.Done()
+
+		socket.On("chat", callback.Func(func(msg message, room string) (message, error) {
+			defer wait.Done()
+			return message{From: room, Text: msg.Text + " " + msg.From}, nil
+		}))
+		return nil
+	})
+
+	return []testDataOptFunc{
+		func(d *testData) { d.server = v4 },
+		func(d *testData) { d.count = count },
+		func(d *testData) { d.want = want },
+		func(d *testData) { d.syncOn = wait },
+	}
+}
+
+func TestMsgpackParserV4(t *testing.T) {
+	var (
+		v4        = socketio.NewServerV4(append(testingOptionsV4, socketio.WithMsgpackParser())...)
+		connected = make(chan *socketio.SocketV4, 1)
+		uploaded  = make(chan []byte, 1)
+	)
+
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		socket.On("upload", callback.Func(func(name string, file []byte) (string, error) {
+			uploaded <- file
+			return name + " saved", nil
+		}))
+		connected <- socket
+		return nil
+	})
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	url := func(sid string) string {
+		return fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling&sid=%s", server.URL, sid)
+	}
+	post := func(sid, body string) {
+		rsp, err := server.Client().Post(url(sid), "text/plain", strings.NewReader(body))
+		if assert.NoError(t, err) {
+			rsp.Body.Close()
+		}
+	}
+	// send posts the packet as a base64 encoded binary message
+	send := func(sid string, packet siop.Packet) {
+		b, err := io.ReadAll(packet.(io.Reader))
+		assert.NoError(t, err)
+		post(sid, "b"+base64.StdEncoding.EncodeToString(b))
+	}
+	// grab polls until a binary message is received, and returns it as a packet
+	grab := func(sid string) *siop.PacketV5Msgpack {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			rsp, err := server.Client().Get(url(sid))
+			if !assert.NoError(t, err) {
+				return nil
+			}
+			body, _ := io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+
+			for _, packet := range strings.Split(string(body), "\x1e") {
+				switch {
+				case packet == "2":
+					post(sid, "3")
+				case strings.HasPrefix(packet, "b"):
+					b, err := base64.StdEncoding.DecodeString(packet[1:])
+					assert.NoError(t, err)
+
+					pac := siop.NewPacketV5Msgpack().(*siop.PacketV5Msgpack)
+					_, err = pac.ReadFrom(bytes.NewReader(b))
+					assert.NoError(t, err)
+					return pac
+				}
+			}
+		}
+		t.Fatal("a binary message was not received")
+		return nil
+	}
+
+	rsp, err := server.Client().Get(fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling", server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var open struct{ SID string }
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	assert.NoError(t, json.Unmarshal(bytes.TrimPrefix(body, []byte("0")), &open))
+
+	send(open.SID, siop.NewPacketV5Msgpack().WithType(siop.ConnectPacket.Byte()).WithNamespace("/"))
+	<-connected
+
+	connect := grab(open.SID)
+	assert.Equal(t, siop.ConnectPacket.Byte(), connect.GetType())
+	if data, ok := connect.GetData().(map[string]interface{}); assert.True(t, ok) {
+		assert.NotEmpty(t, data["sid"])
+	}
+
+	send(open.SID, siop.NewPacketV5Msgpack().WithType(siop.EventPacket.Byte()).WithAckID(7).WithData(
+		[]interface{}{"upload", "photo.png", bytes.NewReader([]byte{0x01, 0x02, 0x03, 0x04})},
+	))
+	assert.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, <-uploaded)
+
+	ack := grab(open.SID)
+	assert.Equal(t, siop.AckPacket.Byte(), ack.GetType())
+	assert.Equal(t, uint64(7), ack.GetAckID())
+	assert.Equal(t, []interface{}{"photo.png saved"}, ack.GetData())
+}
+
+// testParser encodes each packet as a JSON text frame, with any binary data in the data
+// array sent as binary frames after it.
+type testParser struct{}
+
+type testParserFrame struct {
+	Type  byte          `json:"t"`
+	NS    string        `json:"n"`
+	AckID uint64        `json:"i,omitempty"`
+	Data  []interface{} `json:"d,omitempty"`
+	Bins  []int         `json:"b,omitempty"` // the data index of each binary frame
+}
+
+func (testParser) Encode(pac siop.Packet) ([]siop.Frame, error) {
+	v := testParserFrame{Type: pac.GetType(), NS: pac.GetNamespace(), AckID: pac.GetAckID()}
+	var bins []siop.Frame
+	switch data := pac.GetData().(type) {
+	case nil:
+	case []interface{}:
+		for i, x := range data {
+			if r, ok := x.(io.Reader); ok {
+				b, err := io.ReadAll(r)
+				if err != nil {
+					return nil, err
+				}
+				bins = append(bins, siop.Frame{Binary: true, Data: b})
+				v.Bins, x = append(v.Bins, i), nil
+			}
+			v.Data = append(v.Data, x)
+		}
+	default:
+		v.Data = []interface{}{data}
+	}
+	b, err := json.Marshal(v)
+	return append([]siop.Frame{{Data: b}}, bins...), err
+}
+
+func (testParser) Decode(frames []siop.Frame) (siop.Packet, error) {
+	var v testParserFrame
+	if err := json.Unmarshal(frames[0].Data, &v); err != nil {
+		return nil, err
+	}
+	if len(frames) < len(v.Bins)+1 {
+		return nil, nil // wait for the binary frames
+	}
+	for n, i := range v.Bins {
+		v.Data[i] = bytes.NewReader(frames[n+1].Data)
+	}
+	pac := siop.NewPacketV5().WithType(v.Type).WithNamespace(v.NS).WithAckID(v.AckID)
+	if v.Data != nil {
+		pac.WithData(v.Data)
+	}
+	return pac, nil
+}
+
+func TestParserV4(t *testing.T) {
+	var (
+		v4        = socketio.NewServerV4(append(testingOptionsV4, socketio.WithParser(testParser{}))...)
+		connected = make(chan *socketio.SocketV4, 1)
+		uploaded  = make(chan []byte, 1)
+	)
+
+	v4.OnConnect(func(socket *socketio.SocketV4) error {
+		socket.On("upload", callback.Func(func(name string, file []byte) (io.Reader, error) {
+			uploaded <- file
+			return strings.NewReader(name), nil
+		}))
+		connected <- socket
+		return nil
+	})
+
+	server := httptest.NewServer(v4)
+	defer server.Close()
+
+	url := func(sid string) string {
+		return fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling&sid=%s", server.URL, sid)
+	}
+	post := func(sid, body string) {
+		rsp, err := server.Client().Post(url(sid), "text/plain", strings.NewReader(body))
+		if assert.NoError(t, err) {
+			rsp.Body.Close()
+		}
+	}
+	// grab polls until the packets that were received match the want patterns
+	grab := func(sid string, want ...string) {
+		var have []string
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && len(have) < len(want); {
+			rsp, err := server.Client().Get(url(sid))
+			if !assert.NoError(t, err) {
+				return
+			}
+			body, _ := io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+
+			for _, packet := range strings.Split(string(body), "\x1e") {
+				if packet == "2" {
+					post(sid, "3")
+					continue
+				}
+				have = append(have, packet)
+			}
+		}
+		if assert.Len(t, have, len(want)) {
+			for i := range want {
+				assert.Regexp(t, "^"+want[i]+"$", have[i])
+			}
+		}
+	}
+
+	rsp, err := server.Client().Get(fmt.Sprintf("%s/socket.io/?EIO=4&transport=polling", server.URL))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var open struct{ SID string }
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	assert.NoError(t, json.Unmarshal(bytes.TrimPrefix(body, []byte("0")), &open))
+
+	post(open.SID, `4{"t":0,"n":"/"}`)
+	<-connected
+	grab(open.SID, `4\{"t":0,"n":"/","d":\[\{"sid":"[^"]+"\}\]\}`)
+
+	post(open.SID, `4{"t":2,"n":"/","i":7,"d":["upload","photo.png",null],"b":[2]}`+"\x1e"+`bAQIDBA==`)
+	assert.Equal(t, []byte{0x01, 0x02, 0x03, 0x04}, <-uploaded)
+	grab(open.SID, `4\{"t":3,"n":"/","i":7,"d":\[null\],"b":\[0\]\}`, `bcGhvdG8ucG5n`)
+}
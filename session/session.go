@@ -26,3 +26,16 @@ var GenerateID = func(string) ID {
 
 	return ID("sio-" + base64.RawURLEncoding.EncodeToString(b))
 }
+
+// PrivateID is the id that is only shared with the client of the socket, the
+// client sends it back when reconnecting so that the socket can be restored.
+type PrivateID string
+
+func (id PrivateID) String() string { return string(id) }
+
+var GeneratePrivateID = func() PrivateID {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return PrivateID(base64.RawURLEncoding.EncodeToString(b))
+}
@@ -6,6 +6,7 @@ type SocketArray struct {
 	namespace Namespace
 	socketIDs []SocketID
 	localIDs  [][]byte
+	err       error // the error from listing the sockets
 
 	filterOnRoom    func(Namespace, Room, SocketID) (bool, error)
 	filterToLocalID func(Namespace, SocketID) ([]byte, error)
@@ -29,9 +30,20 @@ func (a *SocketArray) With(opts ...option) {
 }
 
 func (a SocketArray) IDs() []SocketID { return a.socketIDs }
+
+// Err returns the error from listing the sockets, the IDs are incomplete when it's set
+func (a SocketArray) Err() error { return a.err }
+
 func (a SocketArray) FromRoom(rm Room) (rtn []SocketID, err error) {
+	if a.err != nil {
+		return nil, a.err
+	}
 	for _, id := range a.socketIDs {
-		if ok, _ := a.filterOnRoom(a.namespace, rm, id); ok {
+		ok, err := a.filterOnRoom(a.namespace, rm, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
 			rtn = append(rtn, id)
 		}
 	}
@@ -1,6 +1,12 @@
 package transport
 
-import eiot "github.com/njones/socketio/engineio/transport"
+import (
+	"context"
+	"time"
+
+	eiot "github.com/njones/socketio/engineio/transport"
+	siop "github.com/njones/socketio/protocol"
+)
 
 type packet interface {
 	GetType() byte
@@ -21,6 +27,101 @@ type Sender interface {
 	Send(SocketID, Data, ...Option) error
 }
 
+// VolatileSender sends data that can be dropped when the transport is not writable,
+// and keeps a count of the data that was dropped.
+type VolatileSender interface {
+	SendVolatile(SocketID, Data, ...Option) error
+	Dropped() uint64
+}
+
+// SocketDetails is what is known about a socket apart from the server that it's connected
+// to, so that the socket can be fetched from any server that shares the transport.
+type SocketDetails struct {
+	Auth map[string]interface{}
+	Data interface{}
+}
+
+// Detailer keeps the details of the sockets in a namespace. The details are removed
+// when the socket is no longer in the namespace.
+type Detailer interface {
+	SetDetails(Namespace, SocketID, SocketDetails) error
+	Details(Namespace, SocketID) (SocketDetails, error)
+}
+
+// SessionState is what is restored for a socket that reconnects with the connection
+// state recovery. The missed packets have the offset as the last data value.
+type SessionState struct {
+	SocketID SocketID
+	Details  SocketDetails
+	Missed   []Socket
+}
+
+// Recoverer keeps the event packets that are sent to a persisted socket, with an offset
+// added as the last data value, for up to the max disconnection duration. A client that
+// reconnects with the private id and the last offset it received can then be restored
+// to the same socket id, and be sent the packets that it missed.
+type Recoverer interface {
+	PersistSession(ns Namespace, socketID SocketID, maxDisconnection time.Duration) (PrivateID, error)
+	RestoreSession(ns Namespace, pid PrivateID, offset string, socketID SocketID) (SessionState, error)
+}
+
+// SessionCloser removes the EngineIO session of a socket after the session has ended. It
+// returns the socket id with the namespaces that the socket is still in, the socket id is
+// empty when the socket has since moved to another session.
+type SessionCloser interface {
+	CloseSession(SessionID) (SocketID, []Namespace)
+}
+
+// Namespacer lists the namespaces that have sockets in them.
+type Namespacer interface {
+	Namespaces() []Namespace
+}
+
+// PacketSetter changes the function that provides new packets for the sockets that are
+// added after, which decides how the packets are encoded on the wire.
+type PacketSetter interface {
+	SetNewPacket(siop.NewPacket)
+}
+
+// ParserSetter sets the parser that encodes and decodes the packets for the sockets that
+// are added after, in place of the packet codec.
+type ParserSetter interface {
+	SetParser(siop.Parser)
+}
+
+// ServerSideEmitter sends the events to the other servers that share the transport, the
+// data is the event name followed by the arguments. The receive function is called for the
+// events from the other servers, and what it returns is the acknowledgement of this server.
+type ServerSideEmitter interface {
+	ServerSideEmit(ns Namespace, data []interface{}) error
+	ServerSideEmitWithAck(ctx context.Context, ns Namespace, data []interface{}) ([][]interface{}, error)
+	OnServerSideEmit(receive func(ns Namespace, data []interface{}) []interface{})
+}
+
+// RemoteDisconnecter disconnects a socket that is on another server that shares the
+// transport. The server with the socket disconnects it with the function that is set with
+// OnRemoteDisconnect. It returns false when the socket is on this server.
+type RemoteDisconnecter interface {
+	DisconnectRemote(ns Namespace, socketID SocketID, close bool) (bool, error)
+	OnRemoteDisconnect(disconnect func(ns Namespace, socketID SocketID, close bool) error)
+}
+
+// BroadcastOptions are the rooms that a broadcast is for, or every socket in the namespace
+// when there are no rooms, without the sockets that are in the except rooms. A socket is
+// always in the room of its own socket id.
+type BroadcastOptions struct {
+	Rooms    []Room
+	Except   []Room
+	Volatile bool
+}
+
+// Broadcaster sends the data to the sockets of a broadcast on every server that shares the
+// transport. The other servers are sent the broadcast once, and each of them sends the data
+// on to its own sockets. The namespace is from the packet options.
+type Broadcaster interface {
+	Broadcast(BroadcastOptions, Data, ...Option) error
+}
+
 type SendReceiver interface {
 	Sender
 	Receive(socketID SocketID) <-chan Socket
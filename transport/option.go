@@ -12,3 +12,12 @@ func WithSocketRoomFilter(fn func(Namespace, Room, SocketID) (bool, error)) opti
 		}
 	}
 }
+
+// WithSocketError sets the error from listing the sockets, it's returned by Err and FromRoom
+func WithSocketError(err error) option {
+	return func(o optionWith) {
+		if ary, ok := o.(*SocketArray); ok {
+			ary.err = err
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"bytes"
 	"io"
 	"strings"
 
@@ -18,6 +19,9 @@ type (
 	// The SocketID session ID
 	SocketID = sios.ID
 
+	// The private ID that is used to recover a SocketID
+	PrivateID = sios.PrivateID
+
 	// The functional option that can be used with Packets
 	Option = siop.Option
 
@@ -62,6 +66,7 @@ type Transport struct {
 
 	receive      chan Socket
 	newPacket    siop.NewPacket
+	parser       siop.Parser // encodes and decodes the packets in place of the packet codec, when it's set
 	eioTransport eiot.Transporter
 }
 
@@ -75,8 +80,16 @@ func NewTransport(id SocketID, eioTransport eiot.Transporter, fn siop.NewPacket)
 	}
 }
 
+// SetParser sets the parser that encodes and decodes the packets as frames. It must
+// be set before the transport is used.
+func (t *Transport) SetParser(p siop.Parser) { t.parser = p }
+
 func (t *Transport) SendBuffer() {
 	for _, packet := range t.buffer.packets {
+		if packet.T == eiop.ClosePacket {
+			t.eioTransport.Shutdown()
+			continue
+		}
 		t.eioTransport.Send(packet)
 		t.sendBinary(packet)
 	}
@@ -85,7 +98,18 @@ func (t *Transport) SendBuffer() {
 
 func (t *Transport) Send(data Data, opts ...Option) {
 	sioPacket := t.newPacket().WithData(data).WithOption(opts...)
+	if t.parser != nil {
+		t.sendFrames(sioPacket)
+		return
+	}
+
 	eioPacket := eiop.Packet{T: eiop.MessagePacket, D: sioPacket}
+	if pac, ok := sioPacket.(interface{ IsBinaryFrame() bool }); ok && pac.IsBinaryFrame() {
+		eioPacket.T = eiop.BinaryPacket
+	}
+	if pac, ok := sioPacket.(interface{ GetCompress() bool }); ok {
+		eioPacket = eioPacket.WithCompress(pac.GetCompress())
+	}
 	if t.buffer.active {
 		t.buffer.packets = append(t.buffer.packets, eioPacket)
 		return
@@ -95,21 +119,72 @@ func (t *Transport) Send(data Data, opts ...Option) {
 	t.sendBinary(eioPacket)
 }
 
+// SendVolatile sends the data only when the EngineIO transport can write it out to
+// the client right away. It returns false when the data was dropped instead.
+func (t *Transport) SendVolatile(data Data, opts ...Option) bool {
+	if w, ok := t.eioTransport.(eiot.Writable); ok && !w.Writable() {
+		return false
+	}
+
+	t.Send(data, opts...)
+	return true
+}
+
+// Shutdown closes the EngineIO session after any buffered packets have been sent
+func (t *Transport) Shutdown() {
+	if t.buffer.active {
+		t.buffer.packets = append(t.buffer.packets, eiop.Packet{T: eiop.ClosePacket})
+		return
+	}
+	t.eioTransport.Shutdown()
+}
+
+// sendFrames sends each frame that the parser encodes the packet to as an EngineIO packet
+func (t *Transport) sendFrames(sioPacket siop.Packet) {
+	frames, err := t.parser.Encode(sioPacket)
+	if err != nil {
+		t.eioTransport.Send(eiop.Packet{T: eiop.NoopPacket, D: err})
+		return
+	}
+
+	var compress = true
+	if pac, ok := sioPacket.(interface{ GetCompress() bool }); ok {
+		compress = pac.GetCompress()
+	}
+
+	for _, frame := range frames {
+		eioPacket := eiop.Packet{T: eiop.MessagePacket, D: string(frame.Data)}
+		if frame.Binary {
+			eioPacket = eiop.Packet{T: eiop.BinaryPacket, D: bytes.NewReader(frame.Data)}
+		}
+		eioPacket = eioPacket.WithCompress(compress)
+
+		if t.buffer.active {
+			t.buffer.packets = append(t.buffer.packets, eioPacket)
+			continue
+		}
+		t.eioTransport.Send(eioPacket)
+	}
+}
+
 func (t *Transport) sendBinary(packet eiop.Packet) {
-	if pac, ok := packet.D.(siop.Packet).(interface{ GetData() interface{} }); ok {
-		objs, _ := pac.GetData().([]interface{})
-		for _, v := range objs {
-			if r, ok := v.(io.Reader); ok {
-				eioBinaryPacket := eiop.Packet{T: eiop.BinaryPacket, D: r}
-				t.eioTransport.Send(eioBinaryPacket)
-			}
+	if pac, ok := packet.D.(interface{ GetAttachments() []io.Reader }); ok {
+		for _, r := range pac.GetAttachments() {
+			eioBinaryPacket := eiop.Packet{T: eiop.BinaryPacket, D: r}.WithCompress(packet.ShouldCompress())
+			t.eioTransport.Send(eioBinaryPacket)
 		}
 	}
 }
 
 func (t *Transport) Receive() <-chan Socket {
 	go func() {
+		var frames []siop.Frame // the frames for the parser that are not a packet yet
+
 		for eioPacket := range t.eioTransport.Receive() {
+			if t.parser != nil && t.receiveFrame(eioPacket, &frames) {
+				continue
+			}
+
 			switch data := eioPacket.D.(type) {
 			case string:
 				pac := t.newPacket().(packet)
@@ -122,25 +197,49 @@ func (t *Transport) Receive() <-chan Socket {
 					if in, ok := pac.(interface{ ReadBinary() func(io.Reader) error }); ok {
 
 						t.receive <- packetToSocket(pac)
-						var cntPlaceholders int
-					EIOPacketData:
-						for eioPacket = range t.eioTransport.Receive() {
-							bin := in.ReadBinary()
-							if r, ok := eioPacket.D.(io.Reader); ok && bin != nil {
-								bin(r)
-							}
 
-							cntPlaceholders++
-							if cntPlaceholders >= len(pac.GetData().([]interface{}))-1 || // TODO(njones): base this off of the binary index...
-								eioPacket.T != eiop.BinaryPacket {
-								break EIOPacketData
+						var bins []func(io.Reader) error
+						for bin := in.ReadBinary(); bin != nil; bin = in.ReadBinary() {
+							bins = append(bins, bin)
+						}
+
+						// each attachment is fed to the placeholder with the same index, any
+						// attachments that are missing return an error when they are read. They
+						// are streamed, so the next one isn't received until the one before it
+						// has been read to the end or closed
+						var missing bool
+						for _, bin := range bins {
+							var r io.Reader = errReader{siop.ErrUnexpectedAttachmentEnd}
+							if !missing {
+								var ok bool
+								eioPacket, ok = <-t.eioTransport.Receive()
+								data, isReader := eioPacket.D.(io.Reader)
+								if missing = !ok || !isReader || eioPacket.T != eiop.BinaryPacket; !missing {
+									r = data
+								}
 							}
+							bin(r)
 						}
 						continue
 					}
 				}
 
 				t.receive <- packetToSocket(pac)
+			case io.Reader:
+				pac := t.newPacket().(packet)
+				if frame, ok := pac.(interface{ IsBinaryFrame() bool }); ok && frame.IsBinaryFrame() {
+					// the whole packet is in the binary data
+					if _, err := pac.(io.ReaderFrom).ReadFrom(data); err != nil {
+						t.eioTransport.Send(eiop.Packet{T: eiop.NoopPacket, D: err})
+						continue
+					}
+					t.receive <- packetToSocket(pac)
+					continue
+				}
+
+				// binary data without a binary packet is thrown away, it's still read so
+				// that a streaming transport can move on to the next packet
+				io.Copy(io.Discard, data)
 			}
 
 			switch eioPacket.T {
@@ -160,6 +259,58 @@ func (t *Transport) Receive() <-chan Socket {
 			}
 
 		}
+
+		// the EngineIO transport ended without a close packet, which is how a client session ends
+		close(t.receive)
 	}()
 	return t.receive
 }
+
+// receiveFrame adds the EngineIO packet to the frames for the parser, and sends on the packet
+// once the parser has all of the frames for it. It returns false for non-frame packets.
+func (t *Transport) receiveFrame(eioPacket eiop.Packet, frames *[]siop.Frame) bool {
+	frame, ok, err := toFrame(eioPacket)
+	if err != nil {
+		*frames = nil
+		t.eioTransport.Send(eiop.Packet{T: eiop.NoopPacket, D: err})
+		return true
+	}
+	if !ok {
+		return false
+	}
+
+	*frames = append(*frames, frame)
+	pac, err := t.parser.Decode(*frames)
+	if err != nil {
+		*frames = nil
+		t.eioTransport.Send(eiop.Packet{T: eiop.NoopPacket, D: err})
+		return true
+	}
+	if pac != nil {
+		*frames = nil
+		t.receive <- packetToSocket(pac)
+	}
+	return true
+}
+
+// toFrame returns the data of a message or binary EngineIO packet as a frame. The binary
+// data is read in full because the parser decodes the whole frame at once, its size is
+// capped by the max binary size of the EngineIO transport.
+func toFrame(eioPacket eiop.Packet) (siop.Frame, bool, error) {
+	switch data := eioPacket.D.(type) {
+	case string:
+		return siop.Frame{Data: []byte(data)}, eioPacket.T == eiop.MessagePacket, nil
+	case io.Reader:
+		b, err := io.ReadAll(data)
+		if err != nil {
+			return siop.Frame{}, false, err
+		}
+		return siop.Frame{Binary: true, Data: b}, true, nil
+	}
+	return siop.Frame{}, false, nil
+}
+
+// errReader returns the error for every read, it's used for attachments that are never received.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
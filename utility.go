@@ -1,8 +1,10 @@
 package socketio
 
 import (
+	"errors"
 	"io"
 
+	"github.com/njones/socketio/internal/binary"
 	seri "github.com/njones/socketio/serialize"
 )
 
@@ -18,9 +20,22 @@ func stoi(s []string) []interface{} {
 }
 
 func serviceError(err error) map[string]interface{} {
+	var connectErr *ConnectError
+	if errors.As(err, &connectErr) && connectErr.Data != nil {
+		return map[string]interface{}{"message": connectErr.Message, "data": connectErr.Data}
+	}
 	return map[string]interface{}{"message": err.Error()}
 }
 
+// hasCallback reports if the last data value is the acknowledgement callback
+func hasCallback(data []seri.Serializable) bool {
+	if len(data) == 0 {
+		return false
+	}
+	_, ok := data[len(data)-1].(eventCallback)
+	return ok
+}
+
 func scrub(useBinary bool, event Event, data []seri.Serializable) (hasBinary bool, out interface{}, cb eventCallback, err error) {
 	if !useBinary {
 		rtn := make([]string, len(data)+1)
@@ -56,9 +71,27 @@ func scrub(useBinary bool, event Event, data []seri.Serializable) (hasBinary boo
 			if err, ok := rtn[i+1].(error); ok {
 				rtn[i+1] = err.Error()
 			}
+			if !hasBinary {
+				hasBinary = binary.Has(rtn[i+1])
+			}
 			continue
 		}
 		rtn[i+1] = v
 	}
 	return hasBinary, rtn, nil, nil
 }
+
+// eventArgs returns the event arguments from the scrubbed event data, without the event name
+func eventArgs(data interface{}) []interface{} {
+	switch data := data.(type) {
+	case []string:
+		if len(data) > 0 {
+			return stoi(data[1:])
+		}
+	case []interface{}:
+		if len(data) > 0 {
+			return data[1:]
+		}
+	}
+	return nil
+}